@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/beneficiary"
+	"github.com/example/real_time_core_banking_v9/internal/customer"
+	"github.com/example/real_time_core_banking_v9/internal/eod"
+	"github.com/example/real_time_core_banking_v9/internal/gl"
+	"github.com/example/real_time_core_banking_v9/internal/limits"
+	"github.com/example/real_time_core_banking_v9/internal/privacy"
+	"github.com/example/real_time_core_banking_v9/internal/router"
+	"github.com/example/real_time_core_banking_v9/internal/standingorder"
+	"github.com/example/real_time_core_banking_v9/internal/statement"
+	"github.com/example/real_time_core_banking_v9/internal/transaction"
+)
+
+// apiHandlers are the handlers behind the API routes.
+type apiHandlers struct {
+	auth        *auth.AuthService
+	customer    *customer.Handler
+	account     *account.Handler
+	statement   *statement.Handler
+	transaction *transaction.Handler
+	privacy     *privacy.Handler
+	gl          *gl.Handler
+	eod         *eod.Handler
+	beneficiary *beneficiary.Handler
+	orders      *standingorder.Handler
+	limits      *limits.Handler
+}
+
+var (
+	staff = []string{auth.RoleTeller, auth.RoleAdmin}
+	admin = []string{auth.RoleAdmin}
+)
+
+// registerRoutes is the API's route table. Routes need a bearer token
+// unless Public; Roles restricts them further. Legacy flat paths stay as
+// deprecated aliases of the resource routes that replace them.
+func registerRoutes(rt *router.Router, h apiHandlers) {
+	const (
+		get   = http.MethodGet
+		post  = http.MethodPost
+		patch = http.MethodPatch
+		del   = http.MethodDelete
+	)
+	for _, r := range []router.Route{
+		// auth
+		{Method: post, Path: "/v1/register", Handler: h.auth.RegisterHandler, Public: true, Tag: "Auth", Summary: "Register a new user"},
+		{Method: post, Path: "/v1/login", Handler: h.auth.LoginHandler, Public: true, Tag: "Auth", Summary: "Log in and receive a JWT",
+			Middleware: []router.Middleware{router.NoStore}},
+
+		// customers
+		{Method: post, Path: "/v1/customers", Handler: h.customer.CreateCustomer, Tag: "Customer", Summary: "Onboard a customer"},
+		{Method: get, Path: "/v1/customers", Handler: h.customer.ListCustomers, Roles: staff, Tag: "Customer", Summary: "List customers"},
+		{Method: get, Path: "/v1/customers/search", Handler: h.customer.SearchCustomers, Roles: staff, Tag: "Customer", Summary: "Search customers"},
+		{Method: get, Path: "/v1/customers/{id}", Handler: h.customer.Profile, Tag: "Customer", Summary: "Get a customer profile"},
+		{Method: patch, Path: "/v1/customers/{id}", Handler: h.customer.Profile, Tag: "Customer", Summary: "Update a customer profile"},
+		{Method: get, Path: "/v1/customers/{id}/history", Handler: h.customer.History, Tag: "Customer", Summary: "List profile versions"},
+		{Method: get, Path: "/v1/customers/{id}/merges", Handler: h.customer.ListMerges, Roles: admin, Tag: "Customer", Summary: "List merges of a customer"},
+		{Method: get, Path: "/v1/customers/duplicates", Handler: h.customer.ListDuplicates, Roles: staff, Tag: "Customer", Summary: "List possible duplicates"},
+		{Method: post, Path: "/v1/customers/duplicates/dismiss", Handler: h.customer.DismissDuplicate, Roles: staff, Tag: "Customer", Summary: "Dismiss a possible duplicate"},
+		{Method: post, Path: "/v1/customers/merges", Handler: h.customer.MergeCustomers, Roles: admin, Tag: "Customer", Summary: "Merge two customers"},
+		{Method: get, Path: "/v1/customers/list", Handler: h.customer.ListCustomers, Roles: staff, Successor: "/v1/customers"},
+		{Method: get, Path: "/v1/customers/profile", Handler: h.customer.Profile, Successor: "/v1/customers/{id}"},
+		{Method: patch, Path: "/v1/customers/profile", Handler: h.customer.Profile, Successor: "/v1/customers/{id}"},
+		{Method: get, Path: "/v1/customers/history", Handler: h.customer.History, Successor: "/v1/customers/{id}/history"},
+		{Method: post, Path: "/v1/customers/merge", Handler: h.customer.MergeCustomers, Roles: admin, Successor: "/v1/customers/merges"},
+		{Method: get, Path: "/v1/customers/merges", Handler: h.customer.ListMerges, Roles: admin, Successor: "/v1/customers/{id}/merges"},
+
+		// accounts
+		{Method: post, Path: "/v1/accounts", Handler: h.account.CreateAccount, Tag: "Account", Summary: "Open an account"},
+		{Method: get, Path: "/v1/accounts/{number}", Handler: h.account.GetAccount, Tag: "Account", Summary: "Get an account"},
+		{Method: get, Path: "/v1/accounts/{number}/balance", Handler: h.account.GetBalance, Tag: "Account", Summary: "Get the current or a historical balance"},
+		{Method: post, Path: "/v1/accounts/{number}/deposits", Handler: h.account.Deposit, Tag: "Account", Summary: "Deposit into an account"},
+		{Method: post, Path: "/v1/accounts/{number}/withdrawals", Handler: h.account.Withdraw, Tag: "Account", Summary: "Withdraw from an account"},
+		{Method: post, Path: "/v1/accounts/{number}/adjustments", Handler: h.account.Adjust, Roles: staff, Tag: "Account", Summary: "Post a manual adjustment"},
+		{Method: get, Path: "/v1/accounts/{number}/snapshots", Handler: h.account.ListSnapshots, Tag: "Account", Summary: "List end-of-day balances"},
+		{Method: get, Path: "/v1/accounts/{number}/statement", Handler: h.statement.Export, Tag: "Account", Summary: "Export a statement",
+			Middleware: []router.Middleware{router.NoStore}},
+		{Method: get, Path: "/v1/accounts/{number}/transactions", Handler: h.transaction.ListTransactions, Tag: "Account", Summary: "List transactions"},
+		{Method: post, Path: "/v1/transfers", Handler: h.account.Transfer, Tag: "Account", Summary: "Transfer between accounts"},
+		{Method: get, Path: "/v1/accounts/balance", Handler: h.account.GetBalance, Successor: "/v1/accounts/{number}/balance"},
+		{Method: post, Path: "/v1/accounts/deposit", Handler: h.account.Deposit, Successor: "/v1/accounts/{number}/deposits"},
+		{Method: post, Path: "/v1/accounts/withdraw", Handler: h.account.Withdraw, Successor: "/v1/accounts/{number}/withdrawals"},
+		{Method: post, Path: "/v1/accounts/transfer", Handler: h.account.Transfer, Successor: "/v1/transfers"},
+		{Method: post, Path: "/v1/accounts/adjustments", Handler: h.account.Adjust, Roles: staff, Successor: "/v1/accounts/{number}/adjustments"},
+		{Method: get, Path: "/v1/accounts/snapshots", Handler: h.account.ListSnapshots, Successor: "/v1/accounts/{number}/snapshots"},
+		{Method: get, Path: "/v1/accounts/statement", Handler: h.statement.Export, Successor: "/v1/accounts/{number}/statement",
+			Middleware: []router.Middleware{router.NoStore}},
+		{Method: get, Path: "/v1/transactions/list", Handler: h.transaction.ListTransactions, Successor: "/v1/accounts/{number}/transactions"},
+
+		// the old v2 reads, now authenticated like their successors
+		{Method: get, Path: "/v2/customers/list", Handler: h.customer.ListCustomers, Roles: staff, Successor: "/v1/customers"},
+		{Method: get, Path: "/v2/balance", Handler: h.account.GetBalance, Successor: "/v1/accounts/{number}/balance"},
+		{Method: get, Path: "/v2/transactions/list", Handler: h.transaction.ListTransactions, Successor: "/v1/accounts/{number}/transactions"},
+
+		// data subject requests
+		{Method: get, Path: "/v1/privacy/export", Handler: h.privacy.Export, Tag: "Privacy", Summary: "Export a customer's personal data",
+			Middleware: []router.Middleware{router.NoStore}},
+		{Method: post, Path: "/v1/privacy/erasure", Handler: h.privacy.RequestErasure, Tag: "Privacy", Summary: "Request erasure"},
+		{Method: get, Path: "/v1/privacy/erasure/status", Handler: h.privacy.GetErasure, Tag: "Privacy", Summary: "Get an erasure request"},
+		{Method: post, Path: "/v1/privacy/erasure/execute", Handler: h.privacy.ExecuteErasure, Roles: admin, Tag: "Privacy", Summary: "Execute an erasure"},
+
+		// general ledger
+		{Method: post, Path: "/v1/gl/accounts", Handler: h.gl.CreateAccount, Roles: admin, Tag: "GL", Summary: "Add a GL account"},
+		{Method: get, Path: "/v1/gl/accounts", Handler: h.gl.ListAccounts, Tag: "GL", Summary: "Chart of accounts"},
+		{Method: post, Path: "/v1/gl/mappings", Handler: h.gl.SetMapping, Roles: admin, Tag: "GL", Summary: "Set a posting rule"},
+		{Method: get, Path: "/v1/gl/mappings", Handler: h.gl.ListMappings, Tag: "GL", Summary: "List posting rules"},
+		{Method: get, Path: "/v1/gl/trial-balance", Handler: h.gl.TrialBalance, Roles: staff, Tag: "GL", Summary: "Trial balance"},
+		{Method: get, Path: "/v1/gl/balance-sheet", Handler: h.gl.BalanceSheet, Roles: staff, Tag: "GL", Summary: "Balance sheet"},
+		{Method: get, Path: "/v1/gl/income-statement", Handler: h.gl.IncomeStatement, Roles: staff, Tag: "GL", Summary: "Income statement"},
+		{Method: get, Path: "/v1/gl/accounts/list", Handler: h.gl.ListAccounts, Successor: "/v1/gl/accounts"},
+		{Method: get, Path: "/v1/gl/mappings/list", Handler: h.gl.ListMappings, Successor: "/v1/gl/mappings"},
+
+		// end-of-day
+		{Method: post, Path: "/v1/eod/run", Handler: h.eod.StartRun, Roles: admin, Tag: "EOD", Summary: "Start or restart end-of-day"},
+		{Method: get, Path: "/v1/eod/status", Handler: h.eod.GetStatus, Tag: "EOD", Summary: "Latest end-of-day run"},
+		{Method: get, Path: "/v1/eod/business-date", Handler: h.eod.GetBusinessDate, Tag: "EOD", Summary: "Current business date"},
+
+		// beneficiaries
+		{Method: post, Path: "/v1/beneficiaries", Handler: h.beneficiary.CreateBeneficiary, Tag: "Beneficiary", Summary: "Add a payee"},
+		{Method: get, Path: "/v1/beneficiaries", Handler: h.beneficiary.ListBeneficiaries, Tag: "Beneficiary", Summary: "List payees"},
+		{Method: patch, Path: "/v1/beneficiaries/{id}", Handler: h.beneficiary.UpdateBeneficiary, Tag: "Beneficiary", Summary: "Rename a payee"},
+		{Method: del, Path: "/v1/beneficiaries/{id}", Handler: h.beneficiary.DeleteBeneficiary, Tag: "Beneficiary", Summary: "Delete a payee"},
+		{Method: get, Path: "/v1/beneficiaries/list", Handler: h.beneficiary.ListBeneficiaries, Successor: "/v1/beneficiaries"},
+		{Method: post, Path: "/v1/beneficiaries/update", Handler: h.beneficiary.UpdateBeneficiary, Successor: "/v1/beneficiaries/{id}"},
+		{Method: post, Path: "/v1/beneficiaries/delete", Handler: h.beneficiary.DeleteBeneficiary, Successor: "/v1/beneficiaries/{id}"},
+
+		// standing orders
+		{Method: post, Path: "/v1/standing-orders", Handler: h.orders.CreateOrder, Tag: "StandingOrder", Summary: "Create a standing order"},
+		{Method: get, Path: "/v1/standing-orders", Handler: h.orders.ListOrders, Tag: "StandingOrder", Summary: "List standing orders"},
+		{Method: get, Path: "/v1/standing-orders/{id}/executions", Handler: h.orders.ListExecutions, Tag: "StandingOrder", Summary: "List executions"},
+		{Method: post, Path: "/v1/standing-orders/{id}/skip", Handler: h.orders.SkipOrder, Tag: "StandingOrder", Summary: "Skip the next run"},
+		{Method: post, Path: "/v1/standing-orders/{id}/pause", Handler: h.orders.PauseOrder, Tag: "StandingOrder", Summary: "Pause"},
+		{Method: post, Path: "/v1/standing-orders/{id}/resume", Handler: h.orders.ResumeOrder, Tag: "StandingOrder", Summary: "Resume"},
+		{Method: post, Path: "/v1/standing-orders/{id}/cancel", Handler: h.orders.CancelOrder, Tag: "StandingOrder", Summary: "Cancel"},
+		{Method: get, Path: "/v1/standing-orders/list", Handler: h.orders.ListOrders, Successor: "/v1/standing-orders"},
+		{Method: get, Path: "/v1/standing-orders/executions", Handler: h.orders.ListExecutions, Successor: "/v1/standing-orders/{id}/executions"},
+		{Method: post, Path: "/v1/standing-orders/skip", Handler: h.orders.SkipOrder, Successor: "/v1/standing-orders/{id}/skip"},
+		{Method: post, Path: "/v1/standing-orders/pause", Handler: h.orders.PauseOrder, Successor: "/v1/standing-orders/{id}/pause"},
+		{Method: post, Path: "/v1/standing-orders/resume", Handler: h.orders.ResumeOrder, Successor: "/v1/standing-orders/{id}/resume"},
+		{Method: post, Path: "/v1/standing-orders/cancel", Handler: h.orders.CancelOrder, Successor: "/v1/standing-orders/{id}/cancel"},
+
+		// limits
+		{Method: post, Path: "/v1/limits", Handler: h.limits.SetLimit, Roles: admin, Tag: "Limits", Summary: "Create or update a limit"},
+		{Method: get, Path: "/v1/limits", Handler: h.limits.ListLimits, Tag: "Limits", Summary: "List limits"},
+		{Method: post, Path: "/v1/limits/increases", Handler: h.limits.RequestIncrease, Tag: "Limits", Summary: "Request a temporary increase"},
+		{Method: get, Path: "/v1/limits/increases", Handler: h.limits.ListIncreases, Roles: admin, Tag: "Limits", Summary: "List increase requests"},
+		{Method: post, Path: "/v1/limits/increases/{id}/decision", Handler: h.limits.DecideIncrease, Roles: admin, Tag: "Limits", Summary: "Approve or reject an increase"},
+		{Method: get, Path: "/v1/limits/list", Handler: h.limits.ListLimits, Successor: "/v1/limits"},
+		{Method: get, Path: "/v1/limits/increases/list", Handler: h.limits.ListIncreases, Roles: admin, Successor: "/v1/limits/increases"},
+		{Method: post, Path: "/v1/limits/increases/decide", Handler: h.limits.DecideIncrease, Roles: admin, Successor: "/v1/limits/increases/{id}/decision"},
+	} {
+		rt.Handle(r)
+	}
+}
@@ -0,0 +1,108 @@
+// Command privacy answers data subject requests from the command line.
+//
+//	privacy export -customer 42 -out customer-42.zip
+//	privacy erase -customer 42 -reason "customer request 2024-118"
+//
+// erase records an erasure request and executes it at once; it exits 1 when
+// the request was rejected because the customer still has obligations.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/config"
+	"github.com/example/real_time_core_banking_v9/internal/pii"
+	"github.com/example/real_time_core_banking_v9/internal/privacy"
+	"github.com/example/real_time_core_banking_v9/internal/redact"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: privacy export -customer ID [-out FILE] | privacy erase -customer ID -reason TEXT")
+	os.Exit(2)
+}
+
+func main() {
+	redact.Install(logrus.StandardLogger())
+	if len(os.Args) < 2 {
+		usage()
+	}
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	customerID := fs.Int("customer", 0, "customer id")
+	out := fs.String("out", "", "export: write the archive to this file (default customer-ID-export.zip)")
+	reason := fs.String("reason", "", "erase: reason recorded with the request")
+	fs.Parse(os.Args[2:])
+	if *customerID <= 0 {
+		usage()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(2)
+	}
+	dbConn, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(2)
+	}
+	defer dbConn.Close()
+	cipher, err := pii.Open(cfg.PII.Keyfile)
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(2)
+	}
+	svc := privacy.NewService(dbConn, cipher)
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "export":
+		path := *out
+		if path == "" {
+			path = fmt.Sprintf("customer-%d-export.zip", *customerID)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(2)
+		}
+		if err := svc.Export(ctx, *customerID, f); err != nil {
+			f.Close()
+			os.Remove(path)
+			logrus.Error("privacy export: ", err)
+			os.Exit(2)
+		}
+		if err := f.Close(); err != nil {
+			logrus.Error(err)
+			os.Exit(2)
+		}
+		logrus.Infof("privacy: wrote %s", path)
+	case "erase":
+		if *reason == "" {
+			usage()
+		}
+		req, err := svc.RequestErasure(*customerID, 0, *reason)
+		if err == nil {
+			req, err = svc.ExecuteErasure(ctx, req.ID, 0)
+		}
+		if err != nil {
+			logrus.Error("privacy erase: ", err)
+			os.Exit(2)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(req)
+		if req.Status != privacy.StatusCompleted {
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,84 @@
+// Command reconcile checks ledger integrity and writes a JSON discrepancy
+// report. It exits 0 when the ledger is consistent, 1 when discrepancies were
+// found and 2 when the checks could not be run.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/config"
+	"github.com/example/real_time_core_banking_v9/internal/reconcile"
+	"github.com/example/real_time_core_banking_v9/internal/redact"
+)
+
+func main() {
+	redact.Install(logrus.StandardLogger())
+	out := flag.String("out", "", "write the report to this file instead of stdout")
+	alert := flag.Bool("alert", false, "queue an alert notification in Redis when discrepancies are found")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(2)
+	}
+	dbConn, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(2)
+	}
+	defer dbConn.Close()
+
+	ctx := context.Background()
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			logrus.Error(err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		w = f
+	}
+	rep, code := run(ctx, reconcile.NewChecker(dbConn), w)
+	if rep != nil && *alert {
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr, Password: cfg.Redis.Password, DB: cfg.Redis.DB})
+		if err := reconcile.Alert(ctx, rdb, rep); err != nil {
+			logrus.Warn("reconcile: raise alert: ", err)
+		}
+		rdb.Close()
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// run checks the ledger, writes the report to w and returns it with the
+// exit code. The report is nil when the checks could not be run.
+func run(ctx context.Context, c *reconcile.Checker, w io.Writer) (*reconcile.Report, int) {
+	rep, err := c.Run(ctx)
+	if err != nil {
+		logrus.Error("reconcile: ", err)
+		return nil, 2
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		logrus.Error(err)
+		return nil, 2
+	}
+	if !rep.Passed {
+		logrus.Warnf("reconcile: %d discrepancies found", rep.Count())
+		return rep, 1
+	}
+	return rep, 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/example/real_time_core_banking_v9/internal/reconcile"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	mismatch := sqltest.Reply{Match: "FROM accounts a LEFT JOIN transactions", Cols: []string{"id", "account_number", "journal", "balance"},
+		Rows: [][]driver.Value{{int64(1), "ACC1", 50.0, 100.0}}}
+	cases := []struct {
+		name    string
+		replies []sqltest.Reply
+		code    int
+		passed  bool
+	}{
+		{"consistent", []sqltest.Reply{{}}, 0, true},
+		{"discrepancies", []sqltest.Reply{mismatch, {}}, 1, false},
+		{"database error", []sqltest.Reply{{Err: errors.New("connection refused")}}, 2, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			rep, code := run(context.Background(), reconcile.NewChecker(sqltest.Open(c.replies...)), &out)
+			if code != c.code {
+				t.Fatalf("exit code %d, want %d", code, c.code)
+			}
+			if code == 2 {
+				if rep != nil || out.Len() != 0 {
+					t.Fatalf("report written after a failed run: %s", out.String())
+				}
+				return
+			}
+			var written reconcile.Report
+			if err := json.Unmarshal(out.Bytes(), &written); err != nil {
+				t.Fatal(err)
+			}
+			if written.Passed != c.passed || len(written.Checks) != 4 {
+				t.Fatalf("report %s", out.String())
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ toolchain go1.24.9
 require (
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang-jwt/jwt/v5 v5.0.0
+	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.6
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.43.0
@@ -15,6 +16,5 @@ require (
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 )
@@ -4,198 +4,325 @@
 package account
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/limits"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/redact"
+	"github.com/example/real_time_core_banking_v9/internal/request"
 )
 
 // Handler manages HTTP requests related to account operations.
-type Handler struct{ repo *Repo }
+type Handler struct {
+	repo *Repo
+	svc  *Service
+}
 
-// CreateCustomer handles POST /v1/customers to create a new customer.
+// CreateAccount handles POST /v1/accounts to open an account. A balance in
+// the request is posted to the journal as the opening balance.
 func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
 	var a Account
-	_ = json.NewDecoder(r.Body).Decode(&a)
-	logrus.Infof("CreateAccount %v", a)
-	if a.CustomerID == 0 || a.AccountNumber == "" {
-		http.Error(w, "customer info. missing", http.StatusBadRequest)
+	if err := request.Decode(w, r, &a); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	logging.From(r.Context()).WithFields(redact.Fields(a)).Info("CreateAccount")
+	if err := h.svc.Open(r.Context(), &a); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	if err := h.repo.Create(&a); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(a)
+}
+
+// GetAccount handles GET /v1/accounts/{number}.
+func (h *Handler) GetAccount(w http.ResponseWriter, r *http.Request) {
+	a, err := h.repo.GetByAccountNumber(r.Context(), r.PathValue("number"))
+	if err != nil {
+		problem.Write(w, r, notFound(err))
 		return
 	}
 	json.NewEncoder(w).Encode(a)
 }
 
-// GetBalance handles GET /v1/accounts/balance to fetch the balance for a given account number.
+// GetBalance handles GET /v1/accounts/{number}/balance, and the legacy
+// /v1/accounts/balance?account_number=, to fetch the balance of an account.
+// With as_of (RFC 3339 timestamp, or YYYY-MM-DD for the end of that day) it
+// returns the historical balance at that point in time.
 func (h *Handler) GetBalance(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
-	acct := q.Get("account_number")
+	acct := request.Param(r, "number", "account_number")
 	if acct == "" {
-		http.Error(w, "missing", http.StatusBadRequest)
+		problem.Write(w, r, problem.Invalid(problem.Field("account_number", "is required")))
 		return
 	}
-	a, err := h.repo.GetByAccountNumber(acct)
+	a, err := h.repo.GetByAccountNumber(r.Context(), acct)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, notFound(err))
+		return
+	}
+	if v := q.Get("as_of"); v != "" {
+		asOf, err := h.parseAsOf(v)
+		if err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("as_of", "must be an RFC 3339 timestamp or YYYY-MM-DD")))
+			return
+		}
+		bal, err := h.repo.BalanceAsOf(a, asOf)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		json.NewEncoder(w).Encode(bal)
 		return
 	}
 	json.NewEncoder(w).Encode(map[string]float64{"balance": a.Balance})
 }
 
-// Deposit handles POST /v1/accounts/deposit to deposit an amount into an account.
+// parseAsOf accepts a timestamp, or a date meaning the end of that day in
+// the bank's time zone.
+func (h *Handler) parseAsOf(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation(calendar.DateLayout, v, h.svc.dates.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// ListSnapshots handles GET /v1/accounts/{number}/snapshots?from=&to=
+// returning end-of-day balances between two business dates.
+func (h *Handler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	a, err := h.repo.GetByAccountNumber(r.Context(), request.Param(r, "number", "account_number"))
+	if err != nil {
+		problem.Write(w, r, notFound(err))
+		return
+	}
+	to := time.Now()
+	from := to.AddDate(0, -1, 0)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("from", "must be YYYY-MM-DD")))
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("to", "must be YYYY-MM-DD")))
+			return
+		}
+	}
+	list, err := h.repo.ListSnapshots(a.ID, from, to)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// Deposit handles POST /v1/accounts/{number}/deposits to deposit an amount
+// into an account. The legacy /v1/accounts/deposit names it in the body.
 func (h *Handler) Deposit(w http.ResponseWriter, r *http.Request) {
 	type req struct {
-		AccountNumber string  `json:"account_number"`
-		Amount        float64 `json:"amount"`
+		AccountNumber string  `json:"account_number" validate:"required"`
+		Amount        float64 `json:"amount" validate:"required,positive"`
 	}
 	var rr req
-	_ = json.NewDecoder(r.Body).Decode(&rr)
-	if rr.AccountNumber == "" || rr.Amount <= 0 {
-		http.Error(w, "bad", http.StatusBadRequest)
+	if !decodeFor(w, r, &rr, &rr.AccountNumber) {
+		return
+	}
+	channel, err := h.svc.limits.Channel(r)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	// simple transactional update
-	tx, err := h.repo.db.Begin()
+	tx, err := h.repo.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	a, err := h.repo.GetByAccountNumber(rr.AccountNumber)
+	accs, err := h.repo.LockTx(r.Context(), tx, rr.AccountNumber)
 	if err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, notFound(err))
 		return
 	}
-	newBal := a.Balance + rr.Amount
-	if err := h.repo.UpdateBalanceTx(tx, a.ID, newBal); err != nil {
+	a := accs[rr.AccountNumber]
+	if err := h.repo.AddBalanceTx(r.Context(), tx, a.ID, rr.Amount); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	if _, err := h.repo.CreateTransactionTx(tx, a.ID, 0, rr.Amount, "deposit", "deposit"); err != nil {
+	if err := h.svc.post(r.Context(), tx, a, 0, rr.Amount, "deposit", "deposit", "deposit", channel); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 	if err := tx.Commit(); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	logrus.Infof("deposited %.2f to %s", rr.Amount, rr.AccountNumber)
+	posted(a, "deposit", rr.Amount)
+	logging.From(r.Context()).WithFields(logrus.Fields{"account_number": rr.AccountNumber, "amount": rr.Amount}).Info("deposited")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// Withdraw handles POST /v1/accounts/withdraw to withdraw funds from an account.
+// Withdraw handles POST /v1/accounts/{number}/withdrawals to withdraw funds
+// from an account. The legacy /v1/accounts/withdraw names it in the body.
 func (h *Handler) Withdraw(w http.ResponseWriter, r *http.Request) {
 	type req struct {
-		AccountNumber string  `json:"account_number"`
-		Amount        float64 `json:"amount"`
+		AccountNumber string  `json:"account_number" validate:"required"`
+		Amount        float64 `json:"amount" validate:"required,positive"`
 	}
 	var rr req
-	_ = json.NewDecoder(r.Body).Decode(&rr)
-	if rr.AccountNumber == "" || rr.Amount <= 0 {
-		http.Error(w, "bad", http.StatusBadRequest)
+	if !decodeFor(w, r, &rr, &rr.AccountNumber) {
+		return
+	}
+	channel, err := h.svc.limits.Channel(r)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	tx, err := h.repo.db.Begin()
+	tx, err := h.repo.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	a, err := h.repo.GetByAccountNumber(rr.AccountNumber)
+	accs, err := h.repo.LockTx(r.Context(), tx, rr.AccountNumber)
 	if err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusNotFound)
+		problem.Write(w, r, notFound(err))
 		return
 	}
+	a := accs[rr.AccountNumber]
 	if a.Balance < rr.Amount {
 		tx.Rollback()
-		http.Error(w, "insufficient", http.StatusBadRequest)
+		problem.Write(w, r, ErrInsufficientFunds)
+		return
+	}
+	usage := limits.Usage{CustomerID: a.CustomerID, AccountNumber: a.AccountNumber, Product: a.Product,
+		Channel: channel, TxnType: limits.TypeWithdraw, Amount: rr.Amount}
+	res, err := h.svc.limits.Reserve(r.Context(), usage)
+	if err != nil {
+		tx.Rollback()
+		problem.Write(w, r, err)
 		return
 	}
-	newBal := a.Balance - rr.Amount
-	if err := h.repo.UpdateBalanceTx(tx, a.ID, newBal); err != nil {
+	if err := h.repo.AddBalanceTx(r.Context(), tx, a.ID, -rr.Amount); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		res.Release(r.Context())
+		problem.Write(w, r, err)
 		return
 	}
-	if _, err := h.repo.CreateTransactionTx(tx, a.ID, 0, rr.Amount, "withdraw", "withdraw"); err != nil {
+	if err := h.svc.post(r.Context(), tx, a, 0, rr.Amount, "withdraw", "withdraw", "withdraw", usage.Channel); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		res.Release(r.Context())
+		problem.Write(w, r, err)
 		return
 	}
 	if err := tx.Commit(); err != nil {
 		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		res.Release(r.Context())
+		problem.Write(w, r, err)
 		return
 	}
+	posted(a, "withdraw", rr.Amount)
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// Transfer handles POST /v1/accounts/transfer to move funds between two accounts.
+// Transfer handles POST /v1/transfers to move funds between two accounts.
 func (h *Handler) Transfer(w http.ResponseWriter, r *http.Request) {
 	type req struct {
-		From   string  `json:"from"`
-		To     string  `json:"to"`
-		Amount float64 `json:"amount"`
+		From   string  `json:"from" validate:"required"`
+		To     string  `json:"to" validate:"required"`
+		Amount float64 `json:"amount" validate:"required,positive"`
 	}
 	var rr req
-	_ = json.NewDecoder(r.Body).Decode(&rr)
-	if rr.From == "" || rr.To == "" || rr.Amount <= 0 {
-		http.Error(w, "bad", http.StatusBadRequest)
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	// use db transaction to make atomic transfer
-	tx, err := h.repo.db.Begin()
+	channel, err := h.svc.limits.Channel(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	fromAcc, err := h.repo.GetByAccountNumber(rr.From)
+	err = h.svc.Transfer(r.Context(), TransferRequest{From: rr.From, To: rr.To, Amount: rr.Amount, Channel: channel})
 	if err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusNotFound)
+		logging.From(r.Context()).WithError(err).WithFields(logrus.Fields{"from": rr.From, "to": rr.To, "amount": rr.Amount}).Warn("transfer rejected")
+		problem.Write(w, r, err)
 		return
 	}
-	toAcc, err := h.repo.GetByAccountNumber(rr.To)
-	if err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Adjust handles POST /v1/accounts/{number}/adjustments to post a manual
+// credit or debit. The route is limited to tellers and admins. Tellers may
+// adjust the open business date; back-dating into a closed date needs the
+// admin role.
+func (h *Handler) Adjust(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		AccountNumber string  `json:"account_number" validate:"required"`
+		Amount        float64 `json:"amount" validate:"required,positive"`
+		Direction     string  `json:"direction" validate:"required,oneof=credit debit"`
+		BookingDate   string  `json:"booking_date"`
+		Narration     string  `json:"narration" validate:"required,max=140"`
 	}
-	if fromAcc.Balance < rr.Amount {
-		tx.Rollback()
-		http.Error(w, "insufficient", http.StatusBadRequest)
+	var rr req
+	if !decodeFor(w, r, &rr, &rr.AccountNumber) {
 		return
 	}
-	if err := h.repo.UpdateBalanceTx(tx, fromAcc.ID, fromAcc.Balance-rr.Amount); err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	adj := AdjustmentRequest{AccountNumber: rr.AccountNumber, Amount: rr.Amount, Credit: rr.Direction == "credit", Narration: rr.Narration}
+	if rr.BookingDate != "" {
+		d, err := time.Parse(calendar.DateLayout, rr.BookingDate)
+		if err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("booking_date", "must be YYYY-MM-DD")))
+			return
+		}
+		adj.BookingDate = d
 	}
-	if err := h.repo.UpdateBalanceTx(tx, toAcc.ID, toAcc.Balance+rr.Amount); err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.svc.Adjust(r.Context(), adj, auth.HasRole(r, auth.RoleAdmin)); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	if _, err := h.repo.CreateTransactionTx(tx, fromAcc.ID, toAcc.ID, rr.Amount, "transfer_debit", "transfer out"); err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	logging.From(r.Context()).WithFields(logrus.Fields{"account_number": rr.AccountNumber, "amount": rr.Amount, "direction": rr.Direction}).Info("adjustment")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// decodeFor decodes a request on an account into dst. On a resource route
+// the account number comes from the path into *number; a body that names
+// a different account is refused. It writes the problem and reports false
+// when the request is bad.
+func decodeFor(w http.ResponseWriter, r *http.Request, dst interface{}, number *string) bool {
+	path := r.PathValue("number")
+	*number = path
+	if err := request.Decode(w, r, dst); err != nil {
+		problem.Write(w, r, err)
+		return false
 	}
-	if _, err := h.repo.CreateTransactionTx(tx, toAcc.ID, fromAcc.ID, rr.Amount, "transfer_credit", "transfer in"); err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if path != "" && *number != path {
+		problem.Write(w, r, problem.Invalid(problem.Field("account_number", "must match the account in the path")))
+		return false
 	}
-	if err := tx.Commit(); err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	return true
+}
+
+// notFound maps a missing account to a 404 naming it.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAccountNotFound.Wrap(err)
 	}
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	return err
 }
@@ -0,0 +1,216 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+// eodChannel is the channel of postings made by end-of-day jobs.
+const eodChannel = "eod"
+
+// due is an amount an end-of-day job posts to an account.
+type due struct {
+	accountID int
+	amount    float64
+}
+
+// AccrualJob returns the EOD step that accrues interest for the closing date
+// at the annual rates, in percent, given by product. An accrual covers the
+// days up to the next business day of cal, so weekends and holidays earn
+// interest on the balance of the business day before them. On the last
+// business day of a month the accrued interest is credited to each account
+// as one interest posting. The step runs in one transaction, so a failed run
+// can repeat it.
+func (r *Repo) AccrualJob(cal *calendar.Calendar, rates map[string]float64) func(context.Context, time.Time) (interface{}, error) {
+	products, values := productArrays(rates)
+	return func(ctx context.Context, date time.Time) (interface{}, error) {
+		next := cal.NextBusinessDay(date)
+		days := int(math.Round(next.Sub(date).Hours() / 24))
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO interest_accruals(account_id, business_date, balance, rate, days, amount)
+			SELECT a.id, $1, b.balance, p.rate, $2, ROUND(b.balance * p.rate / 100 * $2 / 365, 6)
+			FROM accounts a
+			JOIN unnest($3::text[], $4::numeric[]) AS p(product, rate) ON p.product = COALESCE(a.product, 'savings')
+			CROSS JOIN LATERAL (SELECT a.balance - (
+				SELECT COALESCE(SUM(`+SignedAmountSQL+`), 0) FROM transactions
+				WHERE account_id = a.id AND booking_date > $1) AS balance) b
+			WHERE p.rate > 0 AND b.balance > 0
+			ON CONFLICT (account_id, business_date) DO NOTHING`,
+			date, days, pq.Array(products), pq.Array(values))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		accrued, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		var credited int64
+		if next.Month() != date.Month() {
+			if credited, err = r.creditInterestTx(ctx, tx, date); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return map[string]int64{"accrued": accrued, "credited": credited}, nil
+	}
+}
+
+// creditInterestTx posts the interest accrued up to date and not yet
+// credited, rounded to the cent, and marks those accruals as credited.
+func (r *Repo) creditInterestTx(ctx context.Context, tx *sql.Tx, date time.Time) (int64, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT account_id, ROUND(SUM(amount), 2) FROM interest_accruals
+		WHERE capitalized_on IS NULL AND business_date <= $1 GROUP BY account_id ORDER BY account_id`, date)
+	if err != nil {
+		return 0, err
+	}
+	var all []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.accountID, &d.amount); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		all = append(all, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var credited int64
+	for _, d := range all {
+		var txnID int
+		if d.amount > 0 {
+			if err := r.AddBalanceTx(ctx, tx, d.accountID, d.amount); err != nil {
+				return 0, err
+			}
+			txnID, err = r.CreateTransactionTx(ctx, tx, Entry{
+				AccountID:   d.accountID,
+				Amount:      d.amount,
+				Type:        "interest",
+				Narration:   "interest " + date.Format("January 2006"),
+				Channel:     eodChannel,
+				BookingDate: date,
+				ValueDate:   date,
+			})
+			if err != nil {
+				return 0, err
+			}
+			credited++
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE interest_accruals SET capitalized_on = $1, transaction_id = NULLIF($2::int, 0)
+			WHERE account_id = $3 AND capitalized_on IS NULL AND business_date <= $1`, date, txnID, d.accountID); err != nil {
+			return 0, err
+		}
+	}
+	return credited, nil
+}
+
+// FeeJob returns the EOD step that charges every account the monthly fee of
+// its product, given by product, on the last business day of the month.
+// Accounts opened after the closing date, and accounts whose balance cannot
+// cover the fee, are not charged. An account is charged at most once a
+// month, so a failed run can repeat the step.
+func (r *Repo) FeeJob(cal *calendar.Calendar, fees map[string]float64) func(context.Context, time.Time) (interface{}, error) {
+	products, values := productArrays(fees)
+	return func(ctx context.Context, date time.Time) (interface{}, error) {
+		if cal.NextBusinessDay(date).Month() == date.Month() {
+			return map[string]int64{"charged": 0}, nil
+		}
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := tx.QueryContext(ctx, `
+			INSERT INTO fee_charges(account_id, period, amount)
+			SELECT a.id, $1, p.fee FROM accounts a
+			JOIN unnest($2::text[], $3::numeric[]) AS p(product, fee) ON p.product = COALESCE(a.product, 'savings')
+			WHERE p.fee > 0 AND a.created_at::date <= $4 AND a.balance >= p.fee
+			FOR UPDATE OF a
+			ON CONFLICT (account_id, period) DO NOTHING
+			RETURNING account_id, amount`,
+			date.Format("2006-01"), pq.Array(products), pq.Array(values), date)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		var charged []due
+		for rows.Next() {
+			var d due
+			if err := rows.Scan(&d.accountID, &d.amount); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return nil, err
+			}
+			charged = append(charged, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		for _, d := range charged {
+			if err := r.chargeFeeTx(ctx, tx, d.accountID, d.amount, date); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return map[string]int64{"charged": int64(len(charged))}, nil
+	}
+}
+
+// chargeFeeTx debits a monthly fee and links it to its fee_charges row.
+func (r *Repo) chargeFeeTx(ctx context.Context, tx *sql.Tx, accountID int, amount float64, date time.Time) error {
+	if err := r.AddBalanceTx(ctx, tx, accountID, -amount); err != nil {
+		return err
+	}
+	txnID, err := r.CreateTransactionTx(ctx, tx, Entry{
+		AccountID:   accountID,
+		Amount:      amount,
+		Type:        "fee",
+		Narration:   "monthly fee " + date.Format("January 2006"),
+		Channel:     eodChannel,
+		BookingDate: date,
+		ValueDate:   date,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE fee_charges SET transaction_id = $1 WHERE account_id = $2 AND period = $3",
+		txnID, accountID, date.Format("2006-01"))
+	return err
+}
+
+// productArrays splits values by product into two parallel arrays, in
+// product order, for unnest.
+func productArrays(byProduct map[string]float64) ([]string, []float64) {
+	products := make([]string, 0, len(byProduct))
+	for p := range byProduct {
+		products = append(products, p)
+	}
+	sort.Strings(products)
+	values := make([]float64, len(products))
+	for i, p := range products {
+		values[i] = byProduct[p]
+	}
+	return products, values
+}
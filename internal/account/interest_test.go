@@ -0,0 +1,86 @@
+package account
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestAccrualJob(t *testing.T) {
+	var accrueArgs, balanceArgs, markArgs []driver.Value
+	repo := NewRepo(sqltest.Open(
+		sqltest.Reply{Match: "INSERT INTO interest_accruals", Rows: make([][]driver.Value, 2), Args: &accrueArgs},
+		sqltest.Reply{Match: "FROM interest_accruals", Cols: []string{"account_id", "round"}, Rows: [][]driver.Value{{int64(7), 1.23}, {int64(8), 0.0}}},
+		sqltest.Reply{Match: "SET balance = balance + $1", Args: &balanceArgs},
+		sqltest.Reply{Match: "INSERT INTO transactions", Cols: []string{"id"}, Rows: [][]driver.Value{{int64(11)}}},
+		sqltest.Reply{Match: "INSERT INTO ledger_entries"},
+		sqltest.Reply{Match: "UPDATE interest_accruals", Args: &markArgs},
+	))
+	job := repo.AccrualJob(calendar.New("USD"), map[string]float64{"savings": 2.5, "current": 0})
+
+	// a Friday accrues for the weekend and credits nothing mid-month
+	res, err := job(context.Background(), time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.(map[string]int64); got["accrued"] != 2 || got["credited"] != 0 {
+		t.Fatalf("result %v", got)
+	}
+	if len(accrueArgs) != 4 || accrueArgs[1] != int64(3) || accrueArgs[2] != "{\"current\",\"savings\"}" {
+		t.Fatalf("accrual args %v", accrueArgs)
+	}
+	if balanceArgs != nil {
+		t.Fatalf("credited mid-month: %v", balanceArgs)
+	}
+
+	// the last business day of March credits what accrued
+	res, err = job(context.Background(), time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.(map[string]int64); got["credited"] != 1 {
+		t.Fatalf("result %v", got)
+	}
+	if len(balanceArgs) != 2 || balanceArgs[0] != 1.23 || balanceArgs[1] != int64(7) {
+		t.Fatalf("balance args %v", balanceArgs)
+	}
+	// an account whose accruals round to nothing is marked without a posting
+	if len(markArgs) != 3 || markArgs[1] != int64(0) || markArgs[2] != int64(8) {
+		t.Fatalf("mark args %v", markArgs)
+	}
+}
+
+func TestFeeJob(t *testing.T) {
+	var chargeArgs, balanceArgs, linkArgs []driver.Value
+	repo := NewRepo(sqltest.Open(
+		sqltest.Reply{Match: "INSERT INTO fee_charges", Cols: []string{"account_id", "amount"}, Rows: [][]driver.Value{{int64(7), 5.0}}, Args: &chargeArgs},
+		sqltest.Reply{Match: "SET balance = balance + $1", Args: &balanceArgs},
+		sqltest.Reply{Match: "INSERT INTO transactions", Cols: []string{"id"}, Rows: [][]driver.Value{{int64(11)}}},
+		sqltest.Reply{Match: "INSERT INTO ledger_entries"},
+		sqltest.Reply{Match: "UPDATE fee_charges", Args: &linkArgs},
+	))
+	job := repo.FeeJob(calendar.New("USD"), map[string]float64{"current": 5})
+
+	res, err := job(context.Background(), time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil || res.(map[string]int64)["charged"] != 0 || chargeArgs != nil {
+		t.Fatalf("mid-month: %v, %v, %v", res, err, chargeArgs)
+	}
+
+	res, err = job(context.Background(), time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC))
+	if err != nil || res.(map[string]int64)["charged"] != 1 {
+		t.Fatalf("month end: %v, %v", res, err)
+	}
+	if len(chargeArgs) != 4 || chargeArgs[0] != "2024-03" {
+		t.Fatalf("charge args %v", chargeArgs)
+	}
+	if len(balanceArgs) != 2 || balanceArgs[0] != -5.0 {
+		t.Fatalf("balance args %v", balanceArgs)
+	}
+	if len(linkArgs) != 3 || linkArgs[0] != int64(11) || linkArgs[2] != "2024-03" {
+		t.Fatalf("link args %v", linkArgs)
+	}
+}
@@ -0,0 +1,42 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/example/real_time_core_banking_v9/internal/beneficiary"
+	"github.com/example/real_time_core_banking_v9/internal/limits"
+	"github.com/example/real_time_core_banking_v9/internal/metrics"
+)
+
+var (
+	postings = metrics.Default.NewCounter("rtcb_postings_total",
+		"Journal entries committed, by transaction type and currency.", "type", "currency")
+	postedAmount = metrics.Default.NewCounter("rtcb_posted_amount_total",
+		"Amount committed to the journal, by transaction type and currency.", "type", "currency")
+	failedTransfers = metrics.Default.NewCounter("rtcb_transfers_failed_total",
+		"Transfers that were rejected or failed, by reason.", "reason")
+)
+
+// posted counts a journal entry once its transaction has committed.
+func posted(acc *Account, typ string, amount float64) {
+	postings.Inc(typ, acc.Currency)
+	postedAmount.Add(amount, typ, acc.Currency)
+}
+
+// failureReason classifies a transfer error for the failed transfer metric.
+func failureReason(err error) string {
+	var breach *limits.Breach
+	var rejection *beneficiary.Rejection
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "account_not_found"
+	case errors.Is(err, ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.As(err, &breach):
+		return "limit_exceeded"
+	case errors.As(err, &rejection):
+		return "beneficiary_rejected"
+	}
+	return "error"
+}
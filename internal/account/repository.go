@@ -1,61 +1,118 @@
 package account
 
 import (
+	"context"
 	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/gl"
 )
 
 type Repo struct {
 	db *sql.DB
 }
 
-func NewHandler(r *Repo) *Handler { return &Handler{repo: r} }
-func NewRepo(db *sql.DB) *Repo    { return &Repo{db: db} }
+func NewHandler(r *Repo, svc *Service) *Handler { return &Handler{repo: r, svc: svc} }
+func NewRepo(db *sql.DB) *Repo                  { return &Repo{db: db} }
 
 type Account struct {
 	ID            int       `json:"id"`
-	CustomerID    int       `json:"customer_id"`
-	AccountNumber string    `json:"account_number"`
-	Currency      string    `json:"currency"`
-	Balance       float64   `json:"balance"`
+	CustomerID    int       `json:"customer_id" validate:"required,min=1"`
+	AccountNumber string    `json:"account_number" validate:"required,max=34"`
+	Currency      string    `json:"currency" validate:"min=3,max=3"`
+	Product       string    `json:"product" validate:"max=32"`
+	Balance       float64   `json:"balance" validate:"min=0"`
 	CreatedAt     time.Time `json:"created_at"`
 }
 
-func (r *Repo) Create(a *Account) error {
-	return r.db.QueryRow("INSERT INTO accounts(customer_id, account_number, currency, balance) VALUES($1,$2,$3,$4) RETURNING id, created_at", a.CustomerID, a.AccountNumber, a.Currency, a.Balance).Scan(&a.ID, &a.CreatedAt)
+// CreateTx inserts a inside tx. The balance is stored as given; Service.Open
+// posts the matching journal entry.
+func (r *Repo) CreateTx(ctx context.Context, tx *sql.Tx, a *Account) error {
+	if a.Product == "" {
+		a.Product = "savings"
+	}
+	return tx.QueryRowContext(ctx, "INSERT INTO accounts(customer_id, account_number, currency, product, balance) VALUES($1,$2,$3,$4,$5) RETURNING id, created_at", a.CustomerID, a.AccountNumber, a.Currency, a.Product, a.Balance).Scan(&a.ID, &a.CreatedAt)
 }
 
 func (r *Repo) Get(id int) (*Account, error) {
 	a := &Account{}
-	if err := r.db.QueryRow("SELECT id, customer_id, account_number, currency, balance, created_at FROM accounts WHERE id=$1", id).
-		Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Balance, &a.CreatedAt); err != nil {
+	if err := r.db.QueryRow("SELECT id, customer_id, account_number, currency, COALESCE(product,'savings'), balance, created_at FROM accounts WHERE id=$1", id).
+		Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Product, &a.Balance, &a.CreatedAt); err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
-func (r *Repo) GetByAccountNumber(acct string) (*Account, error) {
+func (r *Repo) GetByAccountNumber(ctx context.Context, acct string) (*Account, error) {
 	a := &Account{}
-	if err := r.db.QueryRow("SELECT id, customer_id, account_number, currency, balance, created_at FROM accounts WHERE account_number=$1", acct).
-		Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Balance, &a.CreatedAt); err != nil {
+	if err := r.db.QueryRowContext(ctx, "SELECT id, customer_id, account_number, currency, COALESCE(product,'savings'), balance, created_at FROM accounts WHERE account_number=$1", acct).
+		Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Product, &a.Balance, &a.CreatedAt); err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
-func (r *Repo) UpdateBalanceTx(tx *sql.Tx, accountID int, newBal float64) error {
-	_, err := tx.Exec("UPDATE accounts SET balance=$1 WHERE id=$2", newBal, accountID)
+// LockTx reads the accounts with the given numbers inside tx and locks
+// their rows until it ends. Rows are locked in id order, so two postings
+// touching the same accounts cannot deadlock. It returns sql.ErrNoRows
+// unless every number exists.
+func (r *Repo) LockTx(ctx context.Context, tx *sql.Tx, numbers ...string) (map[string]*Account, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id, customer_id, account_number, currency, COALESCE(product,'savings'), balance, created_at FROM accounts WHERE account_number = ANY($1) ORDER BY id FOR UPDATE", pq.Array(numbers))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]*Account{}
+	for rows.Next() {
+		a := &Account{}
+		if err := rows.Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Product, &a.Balance, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out[a.AccountNumber] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, n := range numbers {
+		if out[n] == nil {
+			return nil, sql.ErrNoRows
+		}
+	}
+	return out, nil
+}
+
+// AddBalanceTx adds delta, which may be negative, to an account's balance.
+func (r *Repo) AddBalanceTx(ctx context.Context, tx *sql.Tx, accountID int, delta float64) error {
+	_, err := tx.ExecContext(ctx, "UPDATE accounts SET balance = balance + $1 WHERE id=$2", delta, accountID)
 	return err
 }
 
-func (r *Repo) CreateTransactionTx(tx *sql.Tx, accountID int, related int, amount float64, typ, narr string) (int, error) {
+// Entry is a row written to the transactions journal.
+type Entry struct {
+	AccountID        int
+	RelatedAccountID int
+	Amount           float64
+	Type             string
+	Narration        string
+	Channel          string
+	BookingDate      time.Time
+	ValueDate        time.Time
+}
+
+func (r *Repo) CreateTransactionTx(ctx context.Context, tx *sql.Tx, e Entry) (int, error) {
 	var id int
-	err := tx.QueryRow("INSERT INTO transactions(account_id, related_account_id, amount, type, narration) VALUES($1,$2,$3,$4,$5) RETURNING id", accountID, related, amount, typ, narr).Scan(&id)
-	return id, err
+	err := tx.QueryRowContext(ctx, "INSERT INTO transactions(account_id, related_account_id, amount, type, narration, channel, booking_date, value_date) VALUES($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id",
+		e.AccountID, e.RelatedAccountID, e.Amount, e.Type, e.Narration, e.Channel, e.BookingDate, e.ValueDate).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, gl.PostTx(ctx, tx, id, e.AccountID, e.Type, e.Amount, e.BookingDate)
 }
 
 func (r *Repo) ListAccountsByCustomer(customerID int) ([]*Account, error) {
-	rows, err := r.db.Query("SELECT id,customer_id,account_number,currency,balance,created_at FROM accounts WHERE customer_id=$1", customerID)
+	rows, err := r.db.Query("SELECT id,customer_id,account_number,currency,COALESCE(product,'savings'),balance,created_at FROM accounts WHERE customer_id=$1", customerID)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +120,7 @@ func (r *Repo) ListAccountsByCustomer(customerID int) ([]*Account, error) {
 	var out []*Account
 	for rows.Next() {
 		a := &Account{}
-		if err := rows.Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Balance, &a.CreatedAt); err != nil {
+		if err := rows.Scan(&a.ID, &a.CustomerID, &a.AccountNumber, &a.Currency, &a.Product, &a.Balance, &a.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, a)
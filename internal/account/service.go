@@ -0,0 +1,275 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/beneficiary"
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/limits"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// ErrAccountNotFound is returned when an account number is unknown.
+var ErrAccountNotFound = problem.NotFound("account not found")
+
+// ErrInsufficientFunds is returned when the debit account cannot cover a posting.
+var ErrInsufficientFunds = problem.New(http.StatusUnprocessableEntity, problem.CodeInsufficientFunds, "insufficient funds")
+
+// ErrDateClosed is returned when posting to a business date that end-of-day
+// has closed without the privilege to adjust closed dates.
+var ErrDateClosed = problem.New(http.StatusForbidden, "business_date_closed", "business date is closed")
+
+// ErrSameAccount is returned for a transfer whose two sides are one account.
+var ErrSameAccount = problem.Invalid(problem.Field("to", "must differ from the from account"))
+
+// ErrFutureDate is returned when booking on a date after the current business date.
+var ErrFutureDate = problem.New(http.StatusUnprocessableEntity, "future_booking_date", "booking date is after the current business date")
+
+// Service holds the posting logic shared by the HTTP handlers and background
+// jobs so every transfer goes through the same checks.
+type Service struct {
+	repo     *Repo
+	limits   *limits.Service
+	payees   *beneficiary.Service
+	dates    *calendar.ValueDater
+	business BusinessDates
+}
+
+// BusinessDates tells the posting path which business date is open and
+// which dates have been closed by end-of-day processing. CurrentTx holds
+// the open date until tx ends so end-of-day cannot close it under a posting.
+type BusinessDates interface {
+	CurrentTx(ctx context.Context, tx *sql.Tx) (time.Time, error)
+	IsClosed(d time.Time) (bool, error)
+}
+
+// NewService creates an account service.
+func NewService(r *Repo, lim *limits.Service, payees *beneficiary.Service, dates *calendar.ValueDater, business BusinessDates) *Service {
+	return &Service{repo: r, limits: lim, payees: payees, dates: dates, business: business}
+}
+
+// post writes a journal entry for acc booked on the current business date,
+// with a value date following the cut-off and holiday rules.
+func (s *Service) post(ctx context.Context, tx *sql.Tx, acc *Account, related int, amount float64, typ, dateType, narr, channel string) error {
+	booked, err := s.business.CurrentTx(ctx, tx)
+	if err != nil {
+		return err
+	}
+	value := s.dates.ValueDate(acc.Currency, dateType, time.Now())
+	if value.Before(booked) {
+		value = booked
+	}
+	_, err = s.repo.CreateTransactionTx(ctx, tx, Entry{
+		AccountID:        acc.ID,
+		RelatedAccountID: related,
+		Amount:           amount,
+		Type:             typ,
+		Narration:        narr,
+		Channel:          channel,
+		BookingDate:      booked,
+		ValueDate:        value,
+	})
+	return err
+}
+
+// Open creates an account. A non-zero opening balance is posted as an
+// opening_balance journal entry, with its GL lines, in the same
+// transaction, so the balance agrees with the journal and the ledger.
+func (s *Service) Open(ctx context.Context, a *Account) error {
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.repo.CreateTx(ctx, tx, a); err != nil {
+		return err
+	}
+	if a.Balance != 0 {
+		if err := s.post(ctx, tx, a, 0, a.Balance, "opening_balance", "deposit", "opening balance", limits.DefaultChannel); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TransferRequest describes a transfer between two accounts.
+type TransferRequest struct {
+	From      string
+	To        string
+	Amount    float64
+	Channel   string
+	Narration string
+	// InTx, when set, runs in the transfer's database transaction after
+	// the postings and before the commit; an error rolls the transfer back.
+	InTx func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Transfer atomically moves funds between two accounts after applying
+// limits and beneficiary rules. Both accounts are locked for the duration
+// and their balances changed by the amount, so concurrent postings cannot
+// overwrite each other. It returns sql.ErrNoRows when either account is
+// unknown, ErrSameAccount, ErrInsufficientFunds, a *limits.Breach or a
+// *beneficiary.Rejection for rejected transfers.
+func (s *Service) Transfer(ctx context.Context, t TransferRequest) (err error) {
+	var res *limits.Reservation
+	defer func() {
+		if err != nil {
+			res.Release(ctx)
+			failedTransfers.Inc(failureReason(err))
+		}
+	}()
+	if t.From == t.To {
+		return ErrSameAccount
+	}
+	if t.Channel == "" {
+		t.Channel = limits.DefaultChannel
+	}
+	out, in := "transfer out", "transfer in"
+	if t.Narration != "" {
+		out, in = t.Narration, t.Narration
+	}
+	// use db transaction to make atomic transfer
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	accs, err := s.repo.LockTx(ctx, tx, t.From, t.To)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	fromAcc, toAcc := accs[t.From], accs[t.To]
+	if fromAcc.Balance < t.Amount {
+		tx.Rollback()
+		return ErrInsufficientFunds
+	}
+	usage := limits.Usage{CustomerID: fromAcc.CustomerID, AccountNumber: fromAcc.AccountNumber, Product: fromAcc.Product,
+		Channel: t.Channel, TxnType: limits.TypeTransfer, Amount: t.Amount}
+	if res, err = s.limits.Reserve(ctx, usage); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.payees.CheckTransfer(ctx, fromAcc.CustomerID, toAcc.AccountNumber, t.Amount); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.repo.AddBalanceTx(ctx, tx, fromAcc.ID, -t.Amount); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.repo.AddBalanceTx(ctx, tx, toAcc.ID, t.Amount); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.post(ctx, tx, fromAcc, toAcc.ID, t.Amount, "transfer_debit", "transfer", out, t.Channel); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := s.post(ctx, tx, toAcc, fromAcc.ID, t.Amount, "transfer_credit", "transfer", in, t.Channel); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if t.InTx != nil {
+		if err := t.InTx(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	posted(fromAcc, "transfer_debit", t.Amount)
+	posted(toAcc, "transfer_credit", t.Amount)
+	logging.From(ctx).WithFields(logrus.Fields{"from": t.From, "to": t.To, "amount": t.Amount, "channel": t.Channel}).Info("transfer posted")
+	return nil
+}
+
+// AdjustmentRequest describes a manual adjustment entry.
+type AdjustmentRequest struct {
+	AccountNumber string
+	Amount        float64
+	Credit        bool
+	BookingDate   time.Time
+	Narration     string
+}
+
+// Adjust posts an adjustment entry booked and valued on BookingDate, which
+// defaults to the current business date. Only privileged callers may book
+// on a date that end-of-day has already closed.
+func (s *Service) Adjust(ctx context.Context, a AdjustmentRequest, privileged bool) error {
+	tx, err := s.repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	cur, err := s.business.CurrentTx(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	booked := a.BookingDate
+	if booked.IsZero() {
+		booked = cur
+	}
+	if booked.After(cur) {
+		tx.Rollback()
+		return ErrFutureDate
+	}
+	closed, err := s.business.IsClosed(booked)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if closed && !privileged {
+		tx.Rollback()
+		return ErrDateClosed
+	}
+	typ, delta := "adjustment_credit", a.Amount
+	if !a.Credit {
+		typ, delta = "adjustment_debit", -a.Amount
+	}
+	accs, err := s.repo.LockTx(ctx, tx, a.AccountNumber)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	acc := accs[a.AccountNumber]
+	if acc.Balance+delta < 0 {
+		tx.Rollback()
+		return ErrInsufficientFunds
+	}
+	if err := s.repo.AddBalanceTx(ctx, tx, acc.ID, delta); err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = s.repo.CreateTransactionTx(ctx, tx, Entry{
+		AccountID:   acc.ID,
+		Amount:      a.Amount,
+		Type:        typ,
+		Narration:   a.Narration,
+		Channel:     "adjustment",
+		BookingDate: booked,
+		ValueDate:   booked,
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if closed {
+		if err := s.repo.AdjustSnapshotsTx(tx, acc.ID, booked, delta); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	posted(acc, typ, a.Amount)
+	return nil
+}
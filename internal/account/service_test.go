@@ -0,0 +1,95 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestTransferSameAccount(t *testing.T) {
+	s := &Service{}
+	err := s.Transfer(context.Background(), TransferRequest{From: "ACC1", To: "ACC1", Amount: 10})
+	if !errors.Is(err, ErrSameAccount) {
+		t.Fatalf("Transfer = %v", err)
+	}
+}
+
+func TestLockTx(t *testing.T) {
+	cols := []string{"id", "customer_id", "account_number", "currency", "product", "balance", "created_at"}
+	now := time.Now()
+	db := sqltest.Open(sqltest.Reply{Match: "ORDER BY id FOR UPDATE", Cols: cols, Rows: [][]driver.Value{
+		{int64(1), int64(5), "ACC1", "USD", "savings", 100.0, now},
+		{int64(2), int64(6), "ACC2", "USD", "savings", 50.0, now},
+	}})
+	repo := NewRepo(db)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accs, err := repo.LockTx(context.Background(), tx, "ACC2", "ACC1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accs["ACC1"].ID != 1 || accs["ACC2"].Balance != 50 {
+		t.Fatalf("locked %+v", accs)
+	}
+	if _, err := repo.LockTx(context.Background(), tx, "ACC1", "ACC9"); err != sql.ErrNoRows {
+		t.Fatalf("unknown account: %v", err)
+	}
+}
+
+func TestAddBalanceTxAppliesDelta(t *testing.T) {
+	var args []driver.Value
+	db := sqltest.Open(sqltest.Reply{Match: "SET balance = balance + $1", Args: &args})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRepo(db).AddBalanceTx(context.Background(), tx, 7, -25); err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[0] != -25.0 || args[1] != int64(7) {
+		t.Fatalf("args %v", args)
+	}
+}
+
+// openDates is a business calendar with one open date.
+type openDates time.Time
+
+func (d openDates) CurrentTx(context.Context, *sql.Tx) (time.Time, error) { return time.Time(d), nil }
+func (openDates) IsClosed(time.Time) (bool, error)                        { return false, nil }
+
+func TestOpenPostsOpeningBalance(t *testing.T) {
+	for _, balance := range []float64{0, 250} {
+		var journal, ledger []driver.Value
+		db := sqltest.Open(
+			sqltest.Reply{Match: "INSERT INTO accounts", Cols: []string{"id", "created_at"}, Rows: [][]driver.Value{{int64(3), time.Now()}}},
+			sqltest.Reply{Match: "INSERT INTO transactions", Cols: []string{"id"}, Rows: [][]driver.Value{{int64(11)}}, Args: &journal},
+			sqltest.Reply{Match: "INSERT INTO ledger_entries", Args: &ledger},
+		)
+		today := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		s := NewService(NewRepo(db), nil, nil, calendar.NewValueDater(nil, nil, nil), openDates(today))
+		a := &Account{CustomerID: 5, AccountNumber: "ACC1", Currency: "USD", Balance: balance}
+		if err := s.Open(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+		if balance == 0 {
+			if journal != nil {
+				t.Errorf("zero balance posted %v", journal)
+			}
+			continue
+		}
+		if len(journal) < 4 || journal[0] != int64(3) || journal[2] != balance || journal[3] != "opening_balance" {
+			t.Fatalf("journal args %v", journal)
+		}
+		if len(ledger) == 0 || ledger[0] != int64(11) {
+			t.Fatalf("ledger args %v", ledger)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+// DebitTypes are the transaction types that reduce an account balance; every
+// other type increases it.
+var DebitTypes = []string{"withdraw", "transfer_debit", "adjustment_debit", "fee"}
+
+// SignedAmountSQL is a SQL expression over the transactions table that gives
+// each row's amount signed by its effect on the account balance.
+var SignedAmountSQL = "CASE WHEN type IN ('" + strings.Join(DebitTypes, "','") + "') THEN -amount ELSE amount END"
+
+// Snapshot is an account balance at the end of a business date.
+type Snapshot struct {
+	AccountID    int       `json:"account_id"`
+	BusinessDate string    `json:"business_date"`
+	Balance      float64   `json:"balance"`
+	TakenAt      time.Time `json:"taken_at"`
+}
+
+// PointInTimeBalance is a balance computed for a past instant.
+type PointInTimeBalance struct {
+	AccountNumber string    `json:"account_number"`
+	AsOf          time.Time `json:"as_of"`
+	Balance       float64   `json:"balance"`
+	SnapshotDate  string    `json:"snapshot_date,omitempty"`
+}
+
+// TakeSnapshots stores every account's balance at the end of date. Postings
+// booked on later dates (for example while EOD is running) are backed out of
+// the live balance, so the snapshot reflects only postings booked up to date.
+func (r *Repo) TakeSnapshots(date time.Time) (int64, error) {
+	res, err := r.db.Exec(`
+		INSERT INTO balance_snapshots(account_id, business_date, balance)
+		SELECT a.id, $1, a.balance - (
+			SELECT COALESCE(SUM(`+SignedAmountSQL+`), 0) FROM transactions
+			WHERE account_id = a.id AND booking_date > $1)
+		FROM accounts a
+		ON CONFLICT (account_id, business_date) DO UPDATE SET balance = EXCLUDED.balance, taken_at = now()`, date)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SnapshotJob is the EOD step that snapshots balances for the closing date.
+func (r *Repo) SnapshotJob(ctx context.Context, date time.Time) (interface{}, error) {
+	n, err := r.TakeSnapshots(date)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"accounts": n}, nil
+}
+
+// AdjustSnapshotsTx shifts the snapshots of an account from date onwards by
+// delta, used when an adjustment is booked into a closed date.
+func (r *Repo) AdjustSnapshotsTx(tx *sql.Tx, accountID int, date time.Time, delta float64) error {
+	_, err := tx.Exec("UPDATE balance_snapshots SET balance = balance + $1 WHERE account_id=$2 AND business_date >= $3", delta, accountID, date)
+	return err
+}
+
+// ListSnapshots returns an account's snapshots between two business dates.
+func (r *Repo) ListSnapshots(accountID int, from, to time.Time) ([]*Snapshot, error) {
+	rows, err := r.db.Query(`SELECT account_id, to_char(business_date,'YYYY-MM-DD'), balance, taken_at FROM balance_snapshots
+		WHERE account_id=$1 AND business_date BETWEEN $2 AND $3 ORDER BY business_date`, accountID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Snapshot
+	for rows.Next() {
+		s := &Snapshot{}
+		if err := rows.Scan(&s.AccountID, &s.BusinessDate, &s.Balance, &s.TakenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// BalanceAsOf returns the balance of a at instant asOf. It starts from the
+// latest snapshot taken before asOf and adds the entries booked after that
+// snapshot's date and created by asOf. Without a usable snapshot it works
+// back from the live balance instead.
+func (r *Repo) BalanceAsOf(a *Account, asOf time.Time) (*PointInTimeBalance, error) {
+	out := &PointInTimeBalance{AccountNumber: a.AccountNumber, AsOf: asOf}
+	var snapDate time.Time
+	var snapBal float64
+	err := r.db.QueryRow(`SELECT business_date, balance FROM balance_snapshots
+		WHERE account_id=$1 AND taken_at <= $2 ORDER BY business_date DESC LIMIT 1`, a.ID, asOf).Scan(&snapDate, &snapBal)
+	switch {
+	case err == sql.ErrNoRows:
+		var later float64
+		if err := r.db.QueryRow(`SELECT COALESCE(SUM(`+SignedAmountSQL+`), 0) FROM transactions
+			WHERE account_id=$1 AND created_at > $2`, a.ID, asOf).Scan(&later); err != nil {
+			return nil, err
+		}
+		out.Balance = a.Balance - later
+		return out, nil
+	case err != nil:
+		return nil, err
+	}
+	var since float64
+	if err := r.db.QueryRow(`SELECT COALESCE(SUM(`+SignedAmountSQL+`), 0) FROM transactions
+		WHERE account_id=$1 AND booking_date > $2 AND created_at <= $3`, a.ID, snapDate, asOf).Scan(&since); err != nil {
+		return nil, err
+	}
+	out.Balance = snapBal + since
+	out.SnapshotDate = snapDate.Format(calendar.DateLayout)
+	return out, nil
+}
@@ -0,0 +1,65 @@
+package account
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestSignedAmountSQL(t *testing.T) {
+	want := "CASE WHEN type IN ('withdraw','transfer_debit','adjustment_debit','fee') THEN -amount ELSE amount END"
+	if SignedAmountSQL != want {
+		t.Fatalf("SignedAmountSQL = %s", SignedAmountSQL)
+	}
+}
+
+func TestTakeSnapshots(t *testing.T) {
+	var args []driver.Value
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	repo := NewRepo(sqltest.Open(sqltest.Reply{Match: "INSERT INTO balance_snapshots", Rows: make([][]driver.Value, 3), Args: &args}))
+	n, err := repo.TakeSnapshots(date)
+	if err != nil || n != 3 {
+		t.Fatalf("TakeSnapshots = %d, %v", n, err)
+	}
+	if len(args) != 1 || args[0] != date {
+		t.Fatalf("args %v", args)
+	}
+}
+
+func TestBalanceAsOf(t *testing.T) {
+	acc := &Account{ID: 7, AccountNumber: "ACC1", Balance: 200}
+	asOf := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	snapDate := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+	// from the latest snapshot, adding entries booked after its date
+	var sinceArgs []driver.Value
+	repo := NewRepo(sqltest.Open(
+		sqltest.Reply{Match: "FROM balance_snapshots", Cols: []string{"business_date", "balance"}, Rows: [][]driver.Value{{snapDate, 150.0}}},
+		sqltest.Reply{Match: "booking_date > $2", Cols: []string{"sum"}, Rows: [][]driver.Value{{-25.5}}, Args: &sinceArgs},
+	))
+	got, err := repo.BalanceAsOf(acc, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Balance != 124.5 || got.SnapshotDate != "2024-03-04" {
+		t.Fatalf("got %+v", got)
+	}
+	if len(sinceArgs) != 3 || sinceArgs[1] != snapDate || sinceArgs[2] != asOf {
+		t.Fatalf("since args %v", sinceArgs)
+	}
+
+	// without a snapshot, backing later entries out of the live balance
+	repo = NewRepo(sqltest.Open(
+		sqltest.Reply{Match: "FROM balance_snapshots", Cols: []string{"business_date", "balance"}},
+		sqltest.Reply{Match: "created_at > $2", Cols: []string{"sum"}, Rows: [][]driver.Value{{30.0}}},
+	))
+	got, err = repo.BalanceAsOf(acc, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Balance != 170 || got.SnapshotDate != "" {
+		t.Fatalf("got %+v", got)
+	}
+}
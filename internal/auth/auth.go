@@ -10,6 +10,9 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
 )
 
 // AuthService handles authentication-related operations such as registering and logging in users.
@@ -25,17 +28,19 @@ func NewAuthService(db *sql.DB, secret string) *AuthService {
 
 // RegisterHandler handles POST /v1/register requests to register a new user.
 func (a *AuthService) RegisterHandler(w http.ResponseWriter, r *http.Request) {
-	type req struct{ Email, Password string }
+	type req struct {
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required,min=8,max=72"`
+	}
 	var rr req
-	_ = json.NewDecoder(r.Body).Decode(&rr)
-	if rr.Email == "" || rr.Password == "" {
-		http.Error(w, "missing", http.StatusBadRequest)
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	ph, _ := bcrypt.GenerateFromPassword([]byte(rr.Password), bcrypt.DefaultCost)
 	_, err := a.db.Exec("INSERT INTO users(email,password_hash) VALUES($1,$2)", rr.Email, string(ph))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
@@ -43,25 +48,28 @@ func (a *AuthService) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 // LoginHandler handles POST /v1/login requests and returns a JWT token on successful authentication.
 func (a *AuthService) LoginHandler(w http.ResponseWriter, r *http.Request) {
-	type req struct{ Email, Password string }
+	type req struct {
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
 	var rr req
-	_ = json.NewDecoder(r.Body).Decode(&rr)
-	if rr.Email == "" || rr.Password == "" {
-		http.Error(w, "missing", http.StatusBadRequest)
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	var id int
-	var hash string
-	row := a.db.QueryRow("SELECT id,password_hash FROM users WHERE email=$1", rr.Email)
-	if err := row.Scan(&id, &hash); err != nil {
-		http.Error(w, "invalid", http.StatusUnauthorized)
+	var hash, role string
+	row := a.db.QueryRow("SELECT id,password_hash,COALESCE(role,'user') FROM users WHERE email=$1", rr.Email)
+	err := row.Scan(&id, &hash, &role)
+	if err != nil && err != sql.ErrNoRows {
+		problem.Write(w, r, err)
 		return
 	}
-	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(rr.Password)) != nil {
-		http.Error(w, "invalid", http.StatusUnauthorized)
+	if err == sql.ErrNoRows || bcrypt.CompareHashAndPassword([]byte(hash), []byte(rr.Password)) != nil {
+		problem.Write(w, r, problem.Unauthorized("invalid email or password"))
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": id, "exp": time.Now().Add(24 * time.Hour).Unix()})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": id, "role": role, "exp": time.Now().Add(24 * time.Hour).Unix()})
 	s, _ := token.SignedString([]byte(a.secret))
 	_ = json.NewEncoder(w).Encode(map[string]string{"token": s})
 }
@@ -3,12 +3,22 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Roles stored in users.role and carried in the JWT "role" claim.
+const (
+	RoleUser   = "user"
+	RoleTeller = "teller"
+	RoleAdmin  = "admin"
 )
 
 // WithAuth is middleware that validates JWT tokens from the Authorization header
@@ -17,30 +27,117 @@ func WithAuth(next http.HandlerFunc, secret string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		h := r.Header.Get("Authorization")
 		if h == "" {
-			http.Error(w, " is null unauth", http.StatusUnauthorized)
+			unauthorized(w, r, "missing bearer token")
 			return
 		}
-		logrus.Infof("header: %v", h)
 		parts := strings.SplitN(h, " ", 2)
-		logrus.Infof("parts: %v", parts)
 		if len(parts) != 2 {
-			http.Error(w, "length unauth", http.StatusUnauthorized)
+			unauthorized(w, r, "malformed Authorization header")
 			return
 		}
 		tok := parts[1]
 		parsed, err := jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) { return []byte(secret), nil })
 		if err != nil || !parsed.Valid {
-			http.Error(w, "parse unauth", http.StatusUnauthorized)
+			unauthorized(w, r, "invalid or expired token")
 			return
 		}
 		// attach claims
 		ctx := context.WithValue(r.Context(), "claims", parsed.Claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		r = r.WithContext(ctx)
+		logging.SetUserID(ctx, UserID(r))
+		next.ServeHTTP(w, r)
+	}
+}
+
+// RequireRole is middleware that refuses authenticated users without one of
+// the given roles. It must run inside WithAuth.
+func RequireRole(next http.HandlerFunc, roles ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !HasRole(r, roles...) {
+			problem.Write(w, r, problem.Forbidden("this action needs the "+strings.Join(roles, " or ")+" role"))
+			return
+		}
+		next.ServeHTTP(w, r)
 	}
 }
 
+// Claims returns the JWT claims attached to the request by WithAuth, or nil
+// when the request was not authenticated.
+func Claims(r *http.Request) jwt.MapClaims {
+	c, _ := r.Context().Value("claims").(jwt.MapClaims)
+	return c
+}
+
+// UserID returns the authenticated user id from the "sub" claim, or 0.
+func UserID(r *http.Request) int {
+	c := Claims(r)
+	if c == nil {
+		return 0
+	}
+	if sub, ok := c["sub"].(float64); ok {
+		return int(sub)
+	}
+	return 0
+}
+
+// Role returns the role of the authenticated user, defaulting to "user".
+func Role(r *http.Request) string {
+	c := Claims(r)
+	if c == nil {
+		return ""
+	}
+	if role, ok := c["role"].(string); ok && role != "" {
+		return role
+	}
+	return RoleUser
+}
+
+// HasRole reports whether the authenticated user has one of the given roles.
+func HasRole(r *http.Request, roles ...string) bool {
+	role := Role(r)
+	for _, want := range roles {
+		if role == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Owners looks up the login linked to a customer. OwnerUserID returns 0
+// when no login is linked and sql.ErrNoRows when there is no such
+// customer; customer.Repo implements it.
+type Owners interface {
+	OwnerUserID(customerID int) (int, error)
+}
+
+// AllowCustomer returns nil when the caller may act for a customer: when
+// they have one of roles or are the customer's own login. Otherwise it
+// returns a not found problem for an unknown customer, a forbidden problem
+// or the lookup error.
+func AllowCustomer(r *http.Request, owners Owners, customerID int, roles ...string) error {
+	if HasRole(r, roles...) {
+		return nil
+	}
+	owner, err := owners.OwnerUserID(customerID)
+	if err == sql.ErrNoRows {
+		return problem.NotFound("customer not found")
+	}
+	if err != nil {
+		return err
+	}
+	if owner == 0 || owner != UserID(r) {
+		return problem.Forbidden("")
+	}
+	return nil
+}
+
 // JSON writes the provided value as a JSON response with the appropriate headers.
 func JSON(w http.ResponseWriter, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	problem.Write(w, r, problem.Unauthorized(detail))
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+func TestWithAuthDoesNotLogToken(t *testing.T) {
+	var buf bytes.Buffer
+	out, level := logrus.StandardLogger().Out, logrus.GetLevel()
+	logrus.SetOutput(&buf)
+	logrus.SetLevel(logrus.TraceLevel)
+	defer func() {
+		logrus.SetOutput(out)
+		logrus.SetLevel(level)
+	}()
+
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 1, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := WithAuth(func(w http.ResponseWriter, r *http.Request) {}, "secret")
+	for _, header := range []string{"Bearer " + tok, "Bearer " + tok + "x", tok} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/accounts/balance", nil)
+		req.Header.Set("Authorization", header)
+		h(httptest.NewRecorder(), req)
+	}
+	if strings.Contains(buf.String(), tok) {
+		t.Fatalf("token logged:\n%s", buf.String())
+	}
+}
+
+// owners maps customer ids to their login; missing customers are unknown.
+type owners map[int]int
+
+func (o owners) OwnerUserID(customerID int) (int, error) {
+	id, ok := o[customerID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+
+func TestAllowCustomer(t *testing.T) {
+	o := owners{1: 7, 2: 0}
+	cases := []struct {
+		user     int
+		role     string
+		customer int
+		status   int
+	}{
+		{7, RoleUser, 1, 0},
+		{8, RoleUser, 1, http.StatusForbidden},
+		{7, RoleUser, 2, http.StatusForbidden},
+		{7, RoleUser, 3, http.StatusNotFound},
+		{8, RoleTeller, 1, 0},
+		{8, RoleTeller, 3, 0},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "claims", jwt.MapClaims{"sub": float64(c.user), "role": c.role}))
+		err := AllowCustomer(req, o, c.customer, RoleTeller, RoleAdmin)
+		var p *problem.Error
+		if (c.status == 0 && err != nil) || (c.status != 0 && (!errors.As(err, &p) || p.Status != c.status)) {
+			t.Errorf("user %d (%s) on customer %d: %v, want status %d", c.user, c.role, c.customer, err, c.status)
+		}
+	}
+}
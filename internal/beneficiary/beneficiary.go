@@ -0,0 +1,132 @@
+// Package beneficiary manages the payees customers register before sending
+// transfers to them. Newly added payees go through a cooling-off period with
+// a lower transfer limit, and large transfers can be restricted to registered
+// payees only.
+package beneficiary
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Policy configures how beneficiaries constrain transfers.
+type Policy struct {
+	// CoolingOff is how long a new payee stays restricted after being added.
+	CoolingOff time.Duration
+	// CoolingOffLimit is the largest single transfer allowed to a payee that is
+	// still cooling off.
+	CoolingOffLimit float64
+	// RequiredAbove, when positive, rejects transfers above this amount unless
+	// the destination is a registered beneficiary.
+	RequiredAbove float64
+}
+
+// unregisteredLimit returns the largest transfer allowed to an account that
+// is not a registered payee; ok is false when there is no limit. While a
+// cooling-off period applies the limit never exceeds CoolingOffLimit, or
+// paying the account unregistered would bypass the period.
+func (p Policy) unregisteredLimit() (limit float64, ok bool) {
+	limit, ok = p.RequiredAbove, p.RequiredAbove > 0
+	if p.CoolingOff > 0 && (!ok || p.CoolingOffLimit < limit) {
+		limit, ok = p.CoolingOffLimit, true
+	}
+	return limit, ok
+}
+
+// Rejection is returned by CheckTransfer when a transfer is not allowed.
+type Rejection struct {
+	Code    string     `json:"error"`
+	Message string     `json:"message"`
+	Limit   float64    `json:"limit,omitempty"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+func (e *Rejection) Error() string { return e.Message }
+
+// Service applies the beneficiary policy to transfers.
+type Service struct {
+	repo   *Repo
+	policy Policy
+	now    func() time.Time
+}
+
+// NewService creates a beneficiary service.
+func NewService(repo *Repo, policy Policy) *Service {
+	return &Service{repo: repo, policy: policy, now: time.Now}
+}
+
+// CheckTransfer returns a *Rejection if the customer may not send amount to
+// the destination account under the current policy.
+func (s *Service) CheckTransfer(ctx context.Context, customerID int, to string, amount float64) error {
+	b, err := s.repo.FindActive(ctx, customerID, to)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		if limit, ok := s.policy.unregisteredLimit(); ok && amount > limit {
+			return &Rejection{
+				Code:    "beneficiary_required",
+				Message: fmt.Sprintf("transfers above %.2f must go to a registered beneficiary", limit),
+				Limit:   limit,
+			}
+		}
+		return nil
+	}
+	if s.now().Before(b.ActiveFrom) && amount > s.policy.CoolingOffLimit {
+		until := b.ActiveFrom
+		return &Rejection{
+			Code:    "beneficiary_cooling_off",
+			Message: fmt.Sprintf("beneficiary %q is in its cooling-off period; transfers are limited to %.2f", b.Nickname, s.policy.CoolingOffLimit),
+			Limit:   s.policy.CoolingOffLimit,
+			Until:   &until,
+		}
+	}
+	return nil
+}
+
+// Problem reports a transfer that needs a registered payee as a 403, and one
+// over the cooling-off limit as a 422.
+func (e *Rejection) Problem() *problem.Error {
+	status := http.StatusUnprocessableEntity
+	if e.Code == "beneficiary_required" {
+		status = http.StatusForbidden
+	}
+	p := problem.New(status, e.Code, e.Message)
+	p.Extra = map[string]interface{}{"limit": e.Limit}
+	if e.Until != nil {
+		p.Extra["until"] = e.Until
+	}
+	return p
+}
+
+// NameMatches reports whether the name a customer typed for a payee matches
+// the account holder's name, ignoring case, punctuation and word order.
+func NameMatches(expected, actual string) bool {
+	a, b := nameTokens(expected), nameTokens(actual)
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, t := range a {
+		seen[t]++
+	}
+	for _, t := range b {
+		if seen[t] == 0 {
+			return false
+		}
+		seen[t]--
+	}
+	return true
+}
+
+func nameTokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,97 @@
+package beneficiary
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestNameMatches(t *testing.T) {
+	cases := []struct {
+		expected, actual string
+		want             bool
+	}{
+		{"Jane Doe", "Jane Doe", true},
+		{"doe, jane", "Jane Doe", true},
+		{"JANE  DOE.", "Jane Doe", true},
+		{"Jane", "Jane Doe", false},
+		{"John Doe", "Jane Doe", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		if got := NameMatches(c.expected, c.actual); got != c.want {
+			t.Errorf("NameMatches(%q, %q) = %v, want %v", c.expected, c.actual, got, c.want)
+		}
+	}
+}
+
+func TestListByCustomerPages(t *testing.T) {
+	now := time.Now()
+	row := func(id int64, nick string) []driver.Value {
+		return []driver.Value{id, int64(5), nick, "ACC" + nick, "", false, now, nil, now}
+	}
+	var args []driver.Value
+	repo := NewRepo(sqltest.Open(sqltest.Reply{
+		Match: "FROM beneficiaries",
+		Cols:  []string{"id", "customer_id", "nickname", "account_number", "account_name", "name_verified", "active_from", "deleted_at", "created_at"},
+		Rows:  [][]driver.Value{row(3, "Bob"), row(1, "Carol"), row(2, "Dan")},
+		Args:  &args,
+	}), nil)
+
+	p, err := page.FromQuery(url.Values{"limit": {"2"}}, page.Asc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := repo.ListByCustomer(5, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := page.New(list, p, (*Beneficiary).Key)
+	if !env.Pagination.HasMore || len(env.Data.([]*Beneficiary)) != 2 {
+		t.Fatalf("pagination %+v", env.Pagination)
+	}
+	if len(args) != 2 || args[1] != int64(3) {
+		t.Fatalf("first page args %v", args)
+	}
+
+	p, err = page.FromQuery(url.Values{"limit": {"2"}, "cursor": {env.Pagination.NextCursor}}, page.Asc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ListByCustomer(5, p); err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 4 || args[2] != "Carol" || args[3] != int64(1) {
+		t.Fatalf("next page args %v", args)
+	}
+}
+
+func TestCheckTransferUnregistered(t *testing.T) {
+	cases := []struct {
+		policy Policy
+		amount float64
+		ok     bool
+	}{
+		{Policy{CoolingOff: 24 * time.Hour, CoolingOffLimit: 1000}, 1000, true},
+		{Policy{CoolingOff: 24 * time.Hour, CoolingOffLimit: 1000}, 5000, false},
+		{Policy{CoolingOff: 24 * time.Hour, CoolingOffLimit: 1000, RequiredAbove: 500}, 800, false},
+		{Policy{CoolingOff: 24 * time.Hour, CoolingOffLimit: 1000, RequiredAbove: 5000}, 2000, false},
+		{Policy{CoolingOff: 24 * time.Hour}, 1, false},
+		{Policy{RequiredAbove: 5000}, 2000, true},
+		{Policy{}, 1e9, true},
+	}
+	for _, c := range cases {
+		db := sqltest.Open(sqltest.Reply{Match: "FROM beneficiaries", Cols: []string{"id"}})
+		err := NewService(NewRepo(db, nil), c.policy).CheckTransfer(context.Background(), 1, "ACC9", c.amount)
+		var rej *Rejection
+		if c.ok && err != nil || !c.ok && (!errors.As(err, &rej) || rej.Code != "beneficiary_required") {
+			t.Errorf("%+v, %.2f to an unregistered account: %v", c.policy, c.amount, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package beneficiary
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for beneficiaries.
+type Handler struct {
+	repo   *Repo
+	svc    *Service
+	owners auth.Owners
+}
+
+// NewHandler creates a beneficiary handler. owners resolves the login of
+// the customer a payee belongs to.
+func NewHandler(r *Repo, s *Service, owners auth.Owners) *Handler {
+	return &Handler{repo: r, svc: s, owners: owners}
+}
+
+// allowed reports whether the caller is staff or the customer themselves.
+// It returns a problem when the customer does not exist or the caller may
+// not act for them.
+func (h *Handler) allowed(r *http.Request, customerID int) error {
+	return auth.AllowCustomer(r, h.owners, customerID, auth.RoleTeller, auth.RoleAdmin)
+}
+
+// owned returns the beneficiary with the given id if the caller may manage
+// it.
+func (h *Handler) owned(r *http.Request, id int) (*Beneficiary, error) {
+	b, err := h.repo.Get(id)
+	if err == sql.ErrNoRows {
+		return nil, problem.NotFound("beneficiary not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := h.allowed(r, b.CustomerID); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateBeneficiary handles POST /v1/beneficiaries. The payee name supplied
+// by the customer is checked against the account holder; a mismatch is
+// rejected unless the customer explicitly confirms it. The holder's name is
+// only stored and returned when it matched, so the endpoint cannot be used
+// to look up who owns an account.
+func (h *Handler) CreateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		CustomerID    int    `json:"customer_id" validate:"required,positive"`
+		Nickname      string `json:"nickname" validate:"required,max=100"`
+		AccountNumber string `json:"account_number" validate:"required,max=50"`
+		Name          string `json:"name" validate:"required,max=200"`
+		Confirm       bool   `json:"confirm"`
+	}
+	var rr req
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := h.allowed(r, rr.CustomerID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	holder, err := h.repo.AccountHolderName(rr.AccountNumber)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("account not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	matched := NameMatches(rr.Name, holder)
+	if !matched && !rr.Confirm {
+		p := problem.New(http.StatusConflict, "name_mismatch", "the name does not match the account holder; resend with confirm to register anyway")
+		p.Extra = map[string]interface{}{"name_verified": false}
+		problem.Write(w, r, p)
+		return
+	}
+	name := rr.Name
+	if matched {
+		name = holder
+	}
+	b := &Beneficiary{
+		CustomerID:    rr.CustomerID,
+		Nickname:      rr.Nickname,
+		AccountNumber: rr.AccountNumber,
+		AccountName:   name,
+		NameVerified:  matched,
+		ActiveFrom:    h.svc.now().Add(h.svc.policy.CoolingOff),
+	}
+	if err := h.repo.Create(b, auth.UserID(r)); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// ListBeneficiaries handles GET /v1/beneficiaries?customer_id=, a page
+// of payees ordered by nickname.
+func (h *Handler) ListBeneficiaries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("customer_id"))
+	if id == 0 {
+		problem.Write(w, r, problem.Invalid(problem.Field("customer_id", "is required")))
+		return
+	}
+	if err := h.allowed(r, id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	p, err := page.FromQuery(r.URL.Query(), page.Asc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.ListByCustomer(id, p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Beneficiary).Key))
+}
+
+// UpdateBeneficiary handles PATCH /v1/beneficiaries/{id} to rename a payee.
+// The account number cannot be edited; register a new beneficiary instead so
+// the cooling-off period applies.
+func (h *Handler) UpdateBeneficiary(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		ID       int    `json:"id" validate:"required,positive"`
+		Nickname string `json:"nickname" validate:"required,max=100"`
+	}
+	var rr req
+	if err := request.DecodeFor(w, r, &rr, &rr.ID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if _, err := h.owned(r, rr.ID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	b, err := h.repo.UpdateNickname(rr.ID, rr.Nickname, auth.UserID(r))
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("beneficiary not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(b)
+}
+
+// DeleteBeneficiary handles DELETE /v1/beneficiaries/{id}.
+func (h *Handler) DeleteBeneficiary(w http.ResponseWriter, r *http.Request) {
+	id, err := request.ID(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if _, err := h.owned(r, id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	err = h.repo.Delete(id, auth.UserID(r))
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("beneficiary not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
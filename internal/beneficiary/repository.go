@@ -0,0 +1,200 @@
+package beneficiary
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/customer"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/pii"
+)
+
+// Repo provides database methods for beneficiaries and their audit trail.
+type Repo struct {
+	db     *sql.DB
+	cipher *pii.Cipher
+}
+
+// NewRepo initializes and returns a new beneficiary repository instance.
+// The cipher opens sealed customer names and may be nil.
+func NewRepo(db *sql.DB, c *pii.Cipher) *Repo { return &Repo{db: db, cipher: c} }
+
+// Beneficiary is a payee registered by a customer.
+type Beneficiary struct {
+	ID            int        `json:"id"`
+	CustomerID    int        `json:"customer_id"`
+	Nickname      string     `json:"nickname"`
+	AccountNumber string     `json:"account_number"`
+	AccountName   string     `json:"account_name"`
+	NameVerified  bool       `json:"name_verified"`
+	ActiveFrom    time.Time  `json:"active_from"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Audit actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+const cols = "id, customer_id, nickname, account_number, COALESCE(account_name,''), name_verified, active_from, deleted_at, created_at"
+
+func scan(s interface{ Scan(...interface{}) error }) (*Beneficiary, error) {
+	b := &Beneficiary{}
+	var deleted sql.NullTime
+	if err := s.Scan(&b.ID, &b.CustomerID, &b.Nickname, &b.AccountNumber, &b.AccountName, &b.NameVerified, &b.ActiveFrom, &deleted, &b.CreatedAt); err != nil {
+		return nil, err
+	}
+	if deleted.Valid {
+		b.DeletedAt = &deleted.Time
+	}
+	return b, nil
+}
+
+// AccountHolderName returns the full name of the customer owning the account.
+func (r *Repo) AccountHolderName(accountNumber string) (string, error) {
+	var first, last sql.NullString
+	err := r.db.QueryRow(`
+		SELECT c.first_name, c.last_name
+		FROM accounts a JOIN customers c ON c.id = a.customer_id
+		WHERE a.account_number=$1`, accountNumber).Scan(&first, &last)
+	if err != nil {
+		return "", err
+	}
+	return customer.HolderName(r.cipher, first, last)
+}
+
+// Create inserts a beneficiary and its audit entry.
+func (r *Repo) Create(b *Beneficiary, actor int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO beneficiaries(customer_id, nickname, account_number, account_name, name_verified, active_from)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		b.CustomerID, b.Nickname, b.AccountNumber, b.AccountName, b.NameVerified, b.ActiveFrom).Scan(&b.ID, &b.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := audit(tx, b.ID, ActionCreate, actor, nil, b); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Get returns a beneficiary by id, including deleted ones.
+func (r *Repo) Get(id int) (*Beneficiary, error) {
+	return scan(r.db.QueryRow("SELECT "+cols+" FROM beneficiaries WHERE id=$1", id))
+}
+
+// FindActive returns the customer's non-deleted beneficiary for the account
+// number, or nil when none is registered.
+func (r *Repo) FindActive(ctx context.Context, customerID int, accountNumber string) (*Beneficiary, error) {
+	b, err := scan(r.db.QueryRowContext(ctx, "SELECT "+cols+" FROM beneficiaries WHERE customer_id=$1 AND account_number=$2 AND deleted_at IS NULL",
+		customerID, accountNumber))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Key returns the pagination cursor position of b, ordered by nickname.
+func (b *Beneficiary) Key() page.Cursor { return page.Cursor{Key: b.Nickname, ID: b.ID} }
+
+// ListByCustomer returns one page of the customer's non-deleted
+// beneficiaries, ordered by nickname. It fetches p.Limit+1 rows so the
+// caller can tell whether another page follows.
+func (r *Repo) ListByCustomer(customerID int, p page.Params) ([]*Beneficiary, error) {
+	args := []interface{}{customerID, p.Limit + 1}
+	where := "customer_id=$1 AND deleted_at IS NULL"
+	if p.After != nil {
+		args = append(args, p.After.Key, p.After.ID)
+		where += " AND (nickname, id) " + p.Cmp() + " ($3, $4)"
+	}
+	rows, err := r.db.Query("SELECT "+cols+" FROM beneficiaries WHERE "+where+" ORDER BY nickname "+p.Dir()+", id "+p.Dir()+" LIMIT $2", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Beneficiary
+	for rows.Next() {
+		b, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// UpdateNickname renames a beneficiary and records the change.
+func (r *Repo) UpdateNickname(id int, nickname string, actor int) (*Beneficiary, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	before, err := scan(tx.QueryRow("SELECT "+cols+" FROM beneficiaries WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	after, err := scan(tx.QueryRow("UPDATE beneficiaries SET nickname=$1 WHERE id=$2 RETURNING "+cols, nickname, id))
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := audit(tx, id, ActionUpdate, actor, before, after); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return after, tx.Commit()
+}
+
+// Delete soft-deletes a beneficiary and records the change.
+func (r *Repo) Delete(id int, actor int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	before, err := scan(tx.QueryRow("SELECT "+cols+" FROM beneficiaries WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("UPDATE beneficiaries SET deleted_at=now() WHERE id=$1", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := audit(tx, id, ActionDelete, actor, before, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func audit(tx *sql.Tx, id int, action string, actor int, before, after *Beneficiary) error {
+	var b, a []byte
+	if before != nil {
+		b, _ = json.Marshal(before)
+	}
+	if after != nil {
+		a, _ = json.Marshal(after)
+	}
+	_, err := tx.Exec("INSERT INTO beneficiary_audit(beneficiary_id, action, actor_user_id, before, after) VALUES ($1,$2,$3,$4,$5)",
+		id, action, actor, nullJSON(b), nullJSON(a))
+	return err
+}
+
+func nullJSON(b []byte) interface{} {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
@@ -0,0 +1,134 @@
+// Package calendar provides business-day calendars per currency or country
+// and the cut-off times used to work out the value date of a posting.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout used for dates in calendar files and APIs.
+const DateLayout = "2006-01-02"
+
+// Calendar knows which days are business days for one currency or country.
+type Calendar struct {
+	Code     string
+	Weekend  map[time.Weekday]bool
+	Holidays map[string]string // date (DateLayout) -> holiday name
+}
+
+// New returns a calendar with a Saturday/Sunday weekend and no holidays.
+func New(code string) *Calendar {
+	return &Calendar{
+		Code:     code,
+		Weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		Holidays: map[string]string{},
+	}
+}
+
+// IsBusinessDay reports whether d is neither a weekend day nor a holiday.
+func (c *Calendar) IsBusinessDay(d time.Time) bool {
+	if c.Weekend[d.Weekday()] {
+		return false
+	}
+	_, holiday := c.Holidays[d.Format(DateLayout)]
+	return !holiday
+}
+
+// NextBusinessDay returns the first business day strictly after d.
+func (c *Calendar) NextBusinessDay(d time.Time) time.Time {
+	for i := 0; i < 366; i++ {
+		d = d.AddDate(0, 0, 1)
+		if c.IsBusinessDay(d) {
+			return d
+		}
+	}
+	return d
+}
+
+// Load reads a calendar file. Each non-comment line is either
+// "YYYY-MM-DD,Holiday name" or "weekend,Sat,Sun" to override the weekend.
+func Load(code, path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := New(code)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if strings.EqualFold(fields[0], "weekend") {
+			c.Weekend = map[time.Weekday]bool{}
+			for _, name := range fields[1:] {
+				wd, ok := weekdays[strings.ToLower(name)]
+				if !ok {
+					return nil, fmt.Errorf("%s:%d: unknown weekday %q", path, n, name)
+				}
+				c.Weekend[wd] = true
+			}
+			continue
+		}
+		d, err := time.Parse(DateLayout, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		name := ""
+		if len(fields) > 1 {
+			name = fields[1]
+		}
+		c.Holidays[d.Format(DateLayout)] = name
+	}
+	return c, sc.Err()
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Set holds the calendars loaded from a directory, keyed by upper-case code.
+type Set struct {
+	calendars map[string]*Calendar
+}
+
+// LoadDir loads every *.csv file in dir as a calendar named after the file,
+// so calendars/USD.csv becomes the "USD" calendar.
+func LoadDir(dir string) (*Set, error) {
+	s := &Set{calendars: map[string]*Calendar{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		code := strings.ToUpper(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)))
+		c, err := Load(code, f)
+		if err != nil {
+			return nil, err
+		}
+		s.calendars[code] = c
+	}
+	return s, nil
+}
+
+// Get returns the calendar for code, or a weekend-only calendar when none
+// was loaded.
+func (s *Set) Get(code string) *Calendar {
+	if s != nil {
+		if c, ok := s.calendars[strings.ToUpper(code)]; ok {
+			return c
+		}
+	}
+	return New(code)
+}
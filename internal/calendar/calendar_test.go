@@ -0,0 +1,73 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadDirAndBusinessDays(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "usd.csv", "# comment\n2024-12-25,Christmas Day\n")
+	writeFile(t, dir, "AED.csv", "weekend,Sat,Sun\n")
+	set, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usd := set.Get("USD")
+	if usd.IsBusinessDay(time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("Christmas should be a holiday")
+	}
+	// Tuesday 24th -> Thursday 26th, skipping the holiday.
+	next := usd.NextBusinessDay(time.Date(2024, 12, 24, 0, 0, 0, 0, time.UTC))
+	if next.Day() != 26 {
+		t.Fatalf("next business day = %v", next)
+	}
+	if set.Get("GBP").IsBusinessDay(time.Date(2024, 12, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("unknown calendars should still skip weekends")
+	}
+}
+
+func TestValueDate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "USD.csv", "2024-12-25,Christmas Day\n")
+	set, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutoffs, err := LoadCutOffs(writeFile(t, t.TempDir(), "cutoffs.csv", "transfer,17:00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewValueDater(set, cutoffs, time.UTC)
+	cases := []struct {
+		name string
+		at   time.Time
+		typ  string
+		want string
+	}{
+		{"before cut-off", time.Date(2024, 12, 23, 16, 59, 0, 0, time.UTC), "transfer", "2024-12-23"},
+		{"after cut-off", time.Date(2024, 12, 23, 17, 0, 0, 0, time.UTC), "transfer", "2024-12-24"},
+		{"after cut-off before holiday", time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC), "transfer", "2024-12-26"},
+		{"no cut-off for type", time.Date(2024, 12, 23, 23, 0, 0, 0, time.UTC), "deposit", "2024-12-23"},
+		{"weekend", time.Date(2024, 12, 21, 10, 0, 0, 0, time.UTC), "deposit", "2024-12-23"},
+	}
+	for _, c := range cases {
+		if got := v.ValueDate("USD", c.typ, c.at).Format(DateLayout); got != c.want {
+			t.Errorf("%s: value date = %s, want %s", c.name, got, c.want)
+		}
+	}
+	if got := v.BookingDate(time.Date(2024, 12, 21, 10, 0, 0, 0, time.UTC)).Format(DateLayout); got != "2024-12-21" {
+		t.Errorf("booking date = %s", got)
+	}
+}
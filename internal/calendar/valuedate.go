@@ -0,0 +1,85 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ValueDater works out booking and value dates for postings. Postings made
+// after the cut-off for their transaction type, or on a non-business day,
+// take value on the next business day of the account currency's calendar.
+type ValueDater struct {
+	cals    *Set
+	cutoffs map[string]time.Duration
+	loc     *time.Location
+}
+
+// NewValueDater creates a ValueDater. cutoffs maps transaction types to the
+// time of day, in loc, after which postings roll to the next business day.
+func NewValueDater(cals *Set, cutoffs map[string]time.Duration, loc *time.Location) *ValueDater {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &ValueDater{cals: cals, cutoffs: cutoffs, loc: loc}
+}
+
+// BookingDate returns the date at is booked on in the bank's time zone.
+func (v *ValueDater) BookingDate(at time.Time) time.Time {
+	return dateOf(at.In(v.loc))
+}
+
+// ValueDate returns the value date of a posting of txnType made at at for an
+// account whose calendar is code.
+func (v *ValueDater) ValueDate(code, txnType string, at time.Time) time.Time {
+	local := at.In(v.loc)
+	day := dateOf(local)
+	cal := v.cals.Get(code)
+	if cut, ok := v.cutoffs[txnType]; ok && local.Sub(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, v.loc)) >= cut {
+		return cal.NextBusinessDay(day)
+	}
+	if !cal.IsBusinessDay(day) {
+		return cal.NextBusinessDay(day)
+	}
+	return day
+}
+
+// Calendar returns the calendar used for code.
+func (v *ValueDater) Calendar(code string) *Calendar { return v.cals.Get(code) }
+
+// Location returns the bank's time zone.
+func (v *ValueDater) Location() *time.Location { return v.loc }
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// LoadCutOffs reads "type,HH:MM" lines mapping transaction types to their
+// daily cut-off time.
+func LoadCutOffs(path string) (map[string]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]time.Duration{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected type,HH:MM", path, n)
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		out[strings.TrimSpace(parts[0])] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+# shared settings
+server:
+  port: 9000
+  read_timeout: 5s
+database:
+  max_open_conns: 50   # per instance
+  url: "postgres://app:file@db:5432/rtcb?sslmode=require#x"
+redis:
+  addr: 'cache:6379'
+`)
+	dotenv := map[string]string{"PORT": "9100", "DB_MAX_OPEN_CONNS": "40", "JWT_SECRET": "from-dotenv"}
+	c, err := LoadFrom(path, dotenv, env(map[string]string{"PORT": "9200", "JWT_SECRET": ""}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Port != 9200 || c.Source("server.port") != SourceEnv {
+		t.Errorf("port = %d from %s, want the environment", c.Server.Port, c.Source("server.port"))
+	}
+	if c.Database.MaxOpenConns != 40 || c.Source("database.max_open_conns") != SourceDotEnv {
+		t.Errorf("max_open_conns = %d, want .env over the file", c.Database.MaxOpenConns)
+	}
+	if c.Server.ReadTimeout != 5*time.Second || c.Source("server.read_timeout") != SourceFile {
+		t.Errorf("read_timeout = %s", c.Server.ReadTimeout)
+	}
+	if c.Database.URL != "postgres://app:file@db:5432/rtcb?sslmode=require#x" || c.Redis.Addr != "cache:6379" {
+		t.Errorf("quoted values: %q %q", c.Database.URL, c.Redis.Addr)
+	}
+	if c.Auth.JWTSecret != "from-dotenv" {
+		t.Errorf("empty variable overrode .env: %q", c.Auth.JWTSecret)
+	}
+	if c.Server.WriteTimeout != 15*time.Second || c.Source("server.write_timeout") != SourceDefault {
+		t.Errorf("write_timeout = %s, want the default", c.Server.WriteTimeout)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		yaml string
+		env  map[string]string
+		want string
+	}{
+		"unknown key":      {yaml: "server:\n  prot: 80\n", want: `unknown setting "server.prot"`},
+		"scalar as parent": {yaml: "database: x\n", want: `unknown setting "database"`},
+		"list":             {yaml: "redis:\n  - a\n", want: "lists are not supported"},
+		"tab":              {yaml: "server:\n\tport: 1\n", want: "line 2"},
+		"indentation":      {yaml: "server:\n    port: 1\n  read_timeout: 1s\n", want: "bad indentation"},
+		"duplicate":        {yaml: "log:\n  format: json\n  format: text\n", want: "duplicate key"},
+		"bad duration":     {env: map[string]string{"SHUTDOWN_TIMEOUT": "30"}, want: "server.shutdown_timeout (SHUTDOWN_TIMEOUT from env)"},
+		"bad integer":      {yaml: "database:\n  max_idle_conns: many\n", want: `invalid integer "many"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := ""
+			if tc.yaml != "" {
+				path = writeFile(t, tc.yaml)
+			}
+			_, err := LoadFrom(path, nil, env(tc.env))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("defaults invalid: %v", err)
+	}
+	c.Server.Port = 0
+	c.Database.MaxIdleConns = 30
+	c.Log.Format = "xml"
+	c.Bank.Timezone = "Mars/Olympus"
+	c.Limits.Channels = "api, a-channel-name-over-twenty"
+	c.EOD.MonthlyFees = "current:-5"
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed")
+	}
+	for _, key := range []string{"server.port", "database.max_idle_conns", "log.format", "bank.timezone", "limits.channels", "eod.monthly_fees"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+}
+
+func TestEODRates(t *testing.T) {
+	rates, err := EOD{InterestRates: " savings:2.5, current:0 "}.Rates()
+	if err != nil || len(rates) != 2 || rates["savings"] != 2.5 || rates["current"] != 0 {
+		t.Fatalf("rates %v, %v", rates, err)
+	}
+	for _, bad := range []string{"savings", ":1", "savings:abc", "savings:-1"} {
+		if _, err := (EOD{InterestRates: bad}).Rates(); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestProductionRefusesDefaults(t *testing.T) {
+	c, err := LoadFrom("", map[string]string{"JWT_SECRET": "verysecretjwtkey"}, env(map[string]string{"APP_ENV": "production"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("production started with development secrets")
+	}
+	for _, want := range []string{"auth.jwt_secret: is a development default", "database.url: must be set explicitly"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in %v", want, err)
+		}
+	}
+
+	c, err = LoadFrom("", nil, env(map[string]string{
+		"APP_ENV":      "production",
+		"JWT_SECRET":   strings.Repeat("k", 48),
+		"DATABASE_URL": "postgres://app:s3cr3t-pw@db:5432/rtcb?sslmode=verify-full",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("production config refused: %v", err)
+	}
+	if w := c.Warnings(); len(w) != 1 {
+		t.Errorf("warnings = %v, want the public /metrics", w)
+	}
+}
+
+func TestSettingsRedacted(t *testing.T) {
+	c, err := LoadFrom("", nil, env(map[string]string{
+		"JWT_SECRET":    "top-secret-signing-key",
+		"METRICS_TOKEN": "scrape-token",
+		"DATABASE_URL":  "postgres://app:s3cr3t-pw@db:5432/rtcb",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := c.String()
+	for _, secret := range []string{"top-secret-signing-key", "scrape-token", "s3cr3t-pw"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printed config leaks %q:\n%s", secret, out)
+		}
+	}
+	got := map[string]Setting{}
+	for _, s := range c.Settings() {
+		got[s.Key] = s
+	}
+	if s := got["auth.jwt_secret"]; s.Value != "[REDACTED]" || s.Env != "JWT_SECRET" || s.Source != SourceEnv {
+		t.Errorf("jwt_secret = %+v", s)
+	}
+	if s := got["database.url"]; s.Value != "postgres://app:REDACTED@db:5432/rtcb" {
+		t.Errorf("database.url = %+v", s)
+	}
+	if s := got["redis.password"]; s.Value != "" {
+		t.Errorf("unset secret shown as %q", s.Value)
+	}
+	if s := got["server.shutdown_timeout"]; s.Value != "30s" || s.Source != SourceDefault {
+		t.Errorf("shutdown_timeout = %+v", s)
+	}
+}
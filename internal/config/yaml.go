@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML a config file needs: nested mappings
+// of scalars, with comments and quoted strings. It returns the scalars
+// keyed by their dotted path, e.g. "database.max_open_conns". Sequences,
+// anchors and multi-line strings are rejected rather than misread.
+func parseYAML(data []byte) (map[string]string, error) {
+	type level struct {
+		indent   int // of the key
+		children int // of the keys under it
+		key      string
+	}
+	out := map[string]string{}
+	var stack []level
+	// pending is a key that ended in ':' with no value; it becomes a
+	// mapping if the next line is indented further, and empty otherwise
+	var pending *level
+	path := func(key string) string {
+		parts := make([]string, 0, len(stack)+1)
+		for _, l := range stack {
+			parts = append(parts, l.key)
+		}
+		return strings.Join(append(parts, key), ".")
+	}
+	set := func(n int, key, value string) error {
+		if _, dup := out[key]; dup {
+			return fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		out[key] = value
+		return nil
+	}
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		n := i + 1
+		line := strings.TrimRight(stripComment(raw), " \r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		body := strings.TrimLeft(line, " ")
+		indent := len(line) - len(body)
+		if strings.HasPrefix(body, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		if n == 1 && body == "---" {
+			continue
+		}
+		if strings.HasPrefix(body, "- ") || body == "-" {
+			return nil, fmt.Errorf("line %d: lists are not supported", n)
+		}
+
+		if pending != nil {
+			if indent > pending.indent {
+				pending.children = indent
+				stack = append(stack, *pending)
+			} else if err := set(n-1, path(pending.key), ""); err != nil {
+				return nil, err
+			}
+			pending = nil
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		want := 0
+		if len(stack) > 0 {
+			want = stack[len(stack)-1].children
+		}
+		if indent != want {
+			return nil, fmt.Errorf("line %d: bad indentation", n)
+		}
+
+		colon := strings.Index(body, ":")
+		if colon <= 0 || (colon+1 < len(body) && body[colon+1] != ' ') {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		key := strings.TrimSpace(body[:colon])
+		value := strings.TrimSpace(body[colon+1:])
+		if value == "" {
+			pending = &level{indent: indent, key: key}
+			continue
+		}
+		v, err := scalar(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		if err := set(n, path(key), v); err != nil {
+			return nil, err
+		}
+	}
+	if pending != nil {
+		if err := set(0, path(pending.key), ""); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// stripComment removes a trailing comment, leaving '#' inside quotes alone.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// scalar unquotes a value. An unquoted ~ or null is empty.
+func scalar(v string) (string, error) {
+	switch {
+	case v == "~" || v == "null":
+		return "", nil
+	case v[0] == '"':
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("bad double-quoted string %s", v)
+		}
+		return s, nil
+	case v[0] == '\'':
+		if len(v) < 2 || v[len(v)-1] != '\'' {
+			return "", fmt.Errorf("bad single-quoted string %s", v)
+		}
+		return strings.ReplaceAll(v[1:len(v)-1], "''", "'"), nil
+	case strings.ContainsAny(v[:1], "[{&*!|>"):
+		return "", fmt.Errorf("unsupported value %s", v)
+	}
+	return v, nil
+}
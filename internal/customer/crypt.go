@@ -0,0 +1,267 @@
+package customer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/example/real_time_core_banking_v9/internal/pii"
+)
+
+// Sealed field names, bound to their ciphertexts.
+const (
+	fieldFirstName = "customers.first_name"
+	fieldLastName  = "customers.last_name"
+	fieldEmail     = "customers.email"
+	fieldMobile    = "customers.mobile"
+	fieldCAF       = "customers.caf"
+	fieldTarget    = "customer_verifications.target"
+)
+
+// kycIdentifiers are the KYC keys searchable by exact match.
+var kycIdentifiers = []string{"national_id", "passport_number", "tax_id"}
+
+// stored is a customer as written to the database: sealed when a cipher is
+// configured, plaintext otherwise. The blind indexes and key id are nil in
+// plaintext mode.
+type stored struct {
+	FirstName, LastName, Email, Mobile string
+	CAF                                []byte
+	EmailIdx, MobileIdx, KeyID         interface{}
+	Tokens                             []string
+}
+
+// seal prepares c for storage.
+func (r *Repo) seal(c *Customer) (*stored, error) {
+	caf, err := json.Marshal(c.KYC)
+	if err != nil || c.KYC == nil {
+		caf = []byte("{}")
+	}
+	s := &stored{FirstName: c.FirstName, LastName: c.LastName, Email: c.Email, Mobile: c.Mobile, CAF: caf}
+	if r.cipher == nil {
+		return s, nil
+	}
+	for _, f := range []struct {
+		field string
+		v     *string
+	}{{fieldFirstName, &s.FirstName}, {fieldLastName, &s.LastName}, {fieldEmail, &s.Email}, {fieldMobile, &s.Mobile}} {
+		if *f.v, err = r.cipher.Seal(f.field, *f.v); err != nil {
+			return nil, err
+		}
+	}
+	sealedCAF, err := r.cipher.Seal(fieldCAF, string(caf))
+	if err != nil {
+		return nil, err
+	}
+	// a sealed caf is stored as a JSON string
+	s.CAF, _ = json.Marshal(sealedCAF)
+	s.EmailIdx = nullable(r.cipher.BlindIndex("email", normalizeEmail(c.Email)))
+	s.MobileIdx = nullable(r.cipher.BlindIndex("mobile", normalizeMobile(c.Mobile)))
+	s.KeyID = r.cipher.CurrentKeyID()
+	s.Tokens = r.blind(recordTokens(c))
+	return s, nil
+}
+
+// open decrypts the personal fields of c in place and parses its caf.
+// Plaintext values are returned as they are.
+func (r *Repo) open(c *Customer, caf []byte) error {
+	var err error
+	for _, f := range []struct {
+		field string
+		v     *string
+	}{{fieldFirstName, &c.FirstName}, {fieldLastName, &c.LastName}, {fieldEmail, &c.Email}, {fieldMobile, &c.Mobile}} {
+		if *f.v, err = r.cipher.Open(f.field, *f.v); err != nil {
+			return err
+		}
+	}
+	c.KYC, err = r.openCAF(caf)
+	return err
+}
+
+// openCAF parses a caf column that is either a JSON object or a sealed
+// JSON object stored as a JSON string.
+func (r *Repo) openCAF(caf []byte) (map[string]string, error) {
+	if len(caf) == 0 {
+		return nil, nil
+	}
+	var sealed string
+	if json.Unmarshal(caf, &sealed) == nil {
+		plain, err := r.cipher.Open(fieldCAF, sealed)
+		if err != nil {
+			return nil, err
+		}
+		caf = []byte(plain)
+	}
+	var kyc map[string]string
+	if err := json.Unmarshal(caf, &kyc); err != nil {
+		return nil, err
+	}
+	if len(kyc) == 0 {
+		return nil, nil
+	}
+	return kyc, nil
+}
+
+// HolderName opens a customer's first and last name columns, as selected by
+// other packages, and joins them into a full name.
+func HolderName(c *pii.Cipher, first, last sql.NullString) (string, error) {
+	f, err := c.OpenNull(fieldFirstName, first)
+	if err != nil {
+		return "", err
+	}
+	l, err := c.OpenNull(fieldLastName, last)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(f + " " + l), nil
+}
+
+func nullable(v string) interface{} {
+	if v == "" {
+		return nil
+	}
+	return v
+}
+
+// blind turns search tokens into blind index entries. It returns nil when
+// no cipher is configured.
+func (r *Repo) blind(tokens []string) []string {
+	if r.cipher == nil {
+		return nil
+	}
+	out := make([]string, 0, len(tokens))
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		kind, v, _ := strings.Cut(t, ":")
+		if idx := r.cipher.BlindIndex(kind, v); idx != "" && !seen[idx] {
+			seen[idx] = true
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// recordTokens lists the kind-prefixed values of a customer that can be
+// found by search when the record is sealed: each name word and its
+// Soundex code, the email, the mobile, the date of birth and KYC
+// identifiers.
+func recordTokens(c *Customer) []string {
+	var out []string
+	for _, w := range strings.Fields(normalizeName(c.FirstName + " " + c.LastName)) {
+		out = append(out, "name:"+w)
+		if code := soundex(w); code != "" {
+			out = append(out, "phon:"+code)
+		}
+	}
+	if e := normalizeEmail(c.Email); e != "" {
+		out = append(out, "email:"+e)
+	}
+	if m := normalizeMobile(c.Mobile); m != "" {
+		out = append(out, "mobile:"+m)
+	}
+	if d := normalizeDate(c.KYC[kycDateOfBirth]); d != "" {
+		out = append(out, "dob:"+d)
+	}
+	for _, k := range kycIdentifiers {
+		if id := normalizeIdentifier(c.KYC[k]); id != "" {
+			out = append(out, "id:"+id)
+		}
+	}
+	return out
+}
+
+// duplicateTokens lists the tokens FindDuplicates looks for on sealed
+// records: the email, the mobile, the phonetic surname and the date of
+// birth.
+func duplicateTokens(c *Customer) []string {
+	var out []string
+	for _, w := range strings.Fields(normalizeName(c.LastName)) {
+		if code := soundex(w); code != "" {
+			out = append(out, "phon:"+code)
+		}
+	}
+	if e := normalizeEmail(c.Email); e != "" {
+		out = append(out, "email:"+e)
+	}
+	if m := normalizeMobile(c.Mobile); m != "" {
+		out = append(out, "mobile:"+m)
+	}
+	if d := normalizeDate(c.KYC[kycDateOfBirth]); d != "" {
+		out = append(out, "dob:"+d)
+	}
+	return out
+}
+
+// queryTokens lists the tokens a search query can match in recordTokens.
+func queryTokens(q string) []string {
+	var out []string
+	for _, w := range strings.Fields(normalizeName(q)) {
+		out = append(out, "name:"+w)
+		if code := soundex(w); code != "" {
+			out = append(out, "phon:"+code)
+		}
+		if id := normalizeIdentifier(w); id != "" {
+			out = append(out, "id:"+id)
+		}
+	}
+	if strings.Contains(q, "@") {
+		out = append(out, "email:"+normalizeEmail(q))
+	}
+	if m := normalizeMobile(q); len(m) >= 7 {
+		out = append(out, "mobile:"+m)
+	}
+	return out
+}
+
+// normalizeIdentifier upper-cases an identity document number and drops
+// separators.
+func normalizeIdentifier(v string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, v)
+}
+
+// soundex returns the American Soundex code of a word, or "" if it has no
+// letters. It stands in for Double Metaphone on sealed records, where the
+// database cannot compute phonetic codes.
+func soundex(w string) string {
+	codes := map[rune]byte{
+		'b': '1', 'f': '1', 'p': '1', 'v': '1',
+		'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+		'd': '3', 't': '3', 'l': '4', 'm': '5', 'n': '5', 'r': '6',
+	}
+	var out []byte
+	var last byte
+	for _, r := range strings.ToLower(w) {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		code := codes[r]
+		if len(out) == 0 {
+			out = append(out, byte(unicode.ToUpper(r)))
+			last = code
+			continue
+		}
+		if code != 0 && code != last {
+			out = append(out, code)
+			if len(out) == 4 {
+				break
+			}
+		}
+		// h and w do not separate letters with the same code; vowels do
+		if r != 'h' && r != 'w' {
+			last = code
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	for len(out) < 4 {
+		out = append(out, '0')
+	}
+	return string(out)
+}
@@ -0,0 +1,31 @@
+package customer
+
+import "testing"
+
+func TestSoundex(t *testing.T) {
+	for w, want := range map[string]string{
+		"Robert": "R163", "Rupert": "R163", "Ashcraft": "A261", "Tymczak": "T522", "Pfister": "P236", "Lee": "L000", "42": "",
+	} {
+		if got := soundex(w); got != want {
+			t.Errorf("soundex(%q) = %q, want %q", w, got, want)
+		}
+	}
+}
+
+func TestQueryTokensMatchRecord(t *testing.T) {
+	c := &Customer{FirstName: "Jane", LastName: "Smith", Email: "Jane@Example.com", Mobile: "+1 (555) 123-4567",
+		KYC: map[string]string{"national_id": "ab-123-456"}}
+	record := map[string]bool{}
+	for _, tok := range recordTokens(c) {
+		record[tok] = true
+	}
+	for _, q := range []string{"smith", "Smyth", "jane@example.com", "5551234567", "AB123456"} {
+		found := false
+		for _, tok := range queryTokens(q) {
+			found = found || record[tok]
+		}
+		if !found {
+			t.Errorf("query %q matches no record token", q)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package customer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Customer statuses.
+const (
+	StatusActive = "active"
+	StatusMerged = "merged"
+)
+
+// Duplicate review statuses.
+const (
+	DuplicatePending   = "pending"
+	DuplicateDismissed = "dismissed"
+	DuplicateMerged    = "merged"
+)
+
+// DuplicateThreshold is the score at which a candidate is recorded as a
+// possible duplicate for staff review.
+const DuplicateThreshold = 0.5
+
+// Match reasons.
+const (
+	ReasonEmail       = "email"
+	ReasonMobile      = "mobile"
+	ReasonName        = "name"
+	ReasonSimilarName = "similar_name"
+	ReasonDateOfBirth = "date_of_birth"
+)
+
+// KYC key holding the date of birth.
+const kycDateOfBirth = "date_of_birth"
+
+// Score compares two customers and returns how likely they are the same
+// person, between 0 and 1, with the attributes that matched. A differing date
+// of birth counts against the match since it rules out most false positives
+// on common names.
+func Score(a, b *Customer) (float64, []string) {
+	var score float64
+	var reasons []string
+	if e := normalizeEmail(a.Email); e != "" && e == normalizeEmail(b.Email) {
+		score += 0.5
+		reasons = append(reasons, ReasonEmail)
+	}
+	if m := normalizeMobile(a.Mobile); len(m) >= 7 && m == normalizeMobile(b.Mobile) {
+		score += 0.3
+		reasons = append(reasons, ReasonMobile)
+	}
+	na, nb := normalizeName(a.FirstName+" "+a.LastName), normalizeName(b.FirstName+" "+b.LastName)
+	switch {
+	case na == "" || nb == "":
+	case na == nb:
+		score += 0.3
+		reasons = append(reasons, ReasonName)
+	case similarity(na, nb) >= 0.8:
+		score += 0.2
+		reasons = append(reasons, ReasonSimilarName)
+	}
+	da, db := normalizeDate(a.KYC[kycDateOfBirth]), normalizeDate(b.KYC[kycDateOfBirth])
+	if da != "" && db != "" {
+		if da == db {
+			score += 0.3
+			reasons = append(reasons, ReasonDateOfBirth)
+		} else {
+			score -= 0.3
+		}
+	}
+	if score < 0 {
+		score = 0
+	}
+	if score > 1 {
+		score = 1
+	}
+	return math.Round(score*100) / 100, reasons
+}
+
+func normalizeEmail(v string) string { return strings.ToLower(strings.TrimSpace(v)) }
+
+// normalizeMobile keeps the last ten digits so national and international
+// forms of the same number compare equal.
+func normalizeMobile(v string) string {
+	var b strings.Builder
+	for _, r := range v {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	d := b.String()
+	if len(d) > 10 {
+		d = d[len(d)-10:]
+	}
+	return d
+}
+
+// normalizeName lower-cases a name, drops punctuation and sorts its words,
+// so "O'Neil, Mary" and "mary oneil" compare equal.
+func normalizeName(v string) string {
+	words := strings.FieldsFunc(strings.ToLower(v), unicode.IsSpace)
+	for i, w := range words {
+		words[i] = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, w)
+	}
+	sort.Strings(words)
+	return strings.TrimSpace(strings.Join(words, " "))
+}
+
+// normalizeDate reads a date in one of the common KYC layouts and returns
+// it as YYYY-MM-DD, or "" if it cannot be parsed.
+func normalizeDate(v string) string {
+	for _, layout := range []string{"2006-01-02", "02/01/2006", "20060102", "2 Jan 2006", "January 2, 2006"} {
+		if d, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+			return d.Format("2006-01-02")
+		}
+	}
+	return ""
+}
+
+// similarity returns 1 minus the Levenshtein distance between a and b
+// relative to the longer string.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
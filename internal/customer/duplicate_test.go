@@ -0,0 +1,46 @@
+package customer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	base := &Customer{FirstName: "Mary", LastName: "O'Neil", Email: "Mary@Example.com", Mobile: "+1 (555) 010-2030",
+		KYC: map[string]string{"date_of_birth": "1980-04-02"}}
+	cases := []struct {
+		name    string
+		other   *Customer
+		score   float64
+		reasons []string
+	}{
+		{"same person", &Customer{FirstName: "mary", LastName: "oneil", Email: " mary@example.com", Mobile: "5550102030",
+			KYC: map[string]string{"date_of_birth": "02/04/1980"}}, 1, []string{ReasonEmail, ReasonMobile, ReasonName, ReasonDateOfBirth}},
+		{"typo and dob", &Customer{FirstName: "Marry", LastName: "ONeil", KYC: map[string]string{"date_of_birth": "1980-04-02"}},
+			0.5, []string{ReasonSimilarName, ReasonDateOfBirth}},
+		{"shared email only", &Customer{FirstName: "John", LastName: "O'Neil", Email: "mary@example.com"}, 0.5, []string{ReasonEmail}},
+		{"namesake born elsewhen", &Customer{FirstName: "Mary", LastName: "ONeil", KYC: map[string]string{"date_of_birth": "1991-01-01"}},
+			0, []string{ReasonName}},
+	}
+	for _, c := range cases {
+		score, reasons := Score(base, c.other)
+		if score != c.score || !reflect.DeepEqual(reasons, c.reasons) {
+			t.Errorf("%s: got %v %v, want %v %v", c.name, score, reasons, c.score, c.reasons)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := normalizeName("O'Neil,  Mary"); got != "mary oneil" {
+		t.Errorf("normalizeName = %q", got)
+	}
+	if got := normalizeMobile("+44 7700 900123"); got != "7700900123" {
+		t.Errorf("normalizeMobile = %q", got)
+	}
+	if got := normalizeDate("2 Apr 1980"); got != "1980-04-02" {
+		t.Errorf("normalizeDate = %q", got)
+	}
+	if got := similarity("kitten", "sitting"); got < 0.57 || got > 0.58 {
+		t.Errorf("similarity = %v", got)
+	}
+}
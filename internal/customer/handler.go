@@ -1,39 +1,368 @@
 package customer
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/mask"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+	"github.com/example/real_time_core_banking_v9/internal/trace"
 )
 
-type Handler struct{ repo *Repo }
+type Handler struct {
+	repo *Repo
+	rdb  *redis.Client
+}
 
-func NewHandler(r *Repo) *Handler { return &Handler{repo: r} }
+func NewHandler(r *Repo, rdb *redis.Client) *Handler { return &Handler{repo: r, rdb: rdb} }
 
+// CreateCustomer handles POST /v1/customers. A customer onboarding
+// themselves owns the record; one created by staff has no owner until it
+// is linked to a login.
 func (h *Handler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
 	userID := 0
-	if v := r.Context().Value("claims"); v != nil {
-		// try to extract sub claim if possible
-		// keep simple: set userID = 1
-		userID = 1
+	if !auth.HasRole(r, auth.RoleTeller, auth.RoleAdmin) {
+		userID = auth.UserID(r)
 	}
 	var c Customer
-	_ = json.NewDecoder(r.Body).Decode(&c)
-	if c.FirstName == "" || c.Email == "" {
-		http.Error(w, "email and password bad", http.StatusBadRequest)
+	if err := request.Decode(w, r, &c); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 	if err := h.repo.Create(&c, userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(c)
+	// possible duplicates are recorded for review but only shown to staff
+	dups, err := h.repo.FindDuplicates(&c)
+	if err == nil && len(dups) > 0 {
+		err = h.repo.SaveDuplicates(dups)
+	}
+	if err != nil {
+		logging.From(r.Context()).Warnf("customer %d: duplicate check: %v", c.ID, err)
+	}
+	if !auth.HasRole(r, auth.RoleTeller, auth.RoleAdmin) {
+		dups = nil
+	}
+	for _, d := range dups {
+		d.Customer = nil
+		if !auth.HasRole(r, auth.RoleAdmin) {
+			maskCustomer(d.Candidate)
+		}
+	}
+	json.NewEncoder(w).Encode(struct {
+		Customer
+		PossibleDuplicates []*Duplicate `json:"possible_duplicates,omitempty"`
+	}{c, dups})
 }
 
+// ListCustomers handles GET /v1/customers and its aliases. Tellers and
+// admins only; tellers see contact details and KYC identifiers masked.
 func (h *Handler) ListCustomers(w http.ResponseWriter, r *http.Request) {
-	list, err := h.repo.List()
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.List(p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !auth.HasRole(r, auth.RoleAdmin) {
+		for _, c := range list {
+			maskCustomer(c)
+		}
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Customer).Key))
+}
+
+// SearchCustomers handles GET /v1/customers/search?q=. Results are ranked by
+// relevance and paginated with limit/cursor. Tellers and admins may search;
+// tellers see contact details, identifiers and account numbers masked.
+func (h *Handler) SearchCustomers(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len([]rune(q)) < 2 {
+		problem.Write(w, r, problem.Invalid(problem.Field("q", "must be at least 2 characters")))
+		return
+	}
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	// relevance order only runs one way
+	p.Order = page.Desc
+	list, err := h.repo.Search(q, p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !auth.HasRole(r, auth.RoleAdmin) {
+		for _, s := range list {
+			s.Mask()
+		}
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*SearchResult).Key))
+}
+
+// maskCustomer hides contact details and KYC identifiers from tellers.
+func maskCustomer(c *Customer) {
+	c.Email = mask.Email(c.Email)
+	c.Mobile = mask.Tail(c.Mobile, 4)
+	for k, v := range c.KYC {
+		c.KYC[k] = mask.Tail(v, 4)
+	}
+}
+
+// ListDuplicates handles GET /v1/customers/duplicates?status=. Status
+// defaults to pending. Tellers and admins only; tellers see masked contact
+// details.
+func (h *Handler) ListDuplicates(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = DuplicatePending
+	}
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.ListDuplicates(status, p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !auth.HasRole(r, auth.RoleAdmin) {
+		for _, d := range list {
+			maskCustomer(d.Customer)
+			maskCustomer(d.Candidate)
+		}
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Duplicate).Key))
+}
+
+// DismissDuplicate handles POST /v1/customers/duplicates/dismiss with
+// {"id": n}, recording that the pair are different people. Tellers and
+// admins only.
+func (h *Handler) DismissDuplicate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID int `json:"id" validate:"required,min=1"`
+	}
+	if err := request.Decode(w, r, &req); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	err := h.repo.DismissDuplicate(req.ID, auth.UserID(r))
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("no pending duplicate with that id"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MergeCustomers handles POST /v1/customers/merge with
+// {"survivor_id", "merged_id", "reason"}. Admin only.
+func (h *Handler) MergeCustomers(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SurvivorID int    `json:"survivor_id" validate:"required,min=1"`
+		MergedID   int    `json:"merged_id" validate:"required,min=1"`
+		Reason     string `json:"reason" validate:"required,max=500"`
+	}
+	if err := request.Decode(w, r, &req); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	m, err := h.repo.MergeCustomers(req.SurvivorID, req.MergedID, auth.UserID(r), req.Reason)
+	switch {
+	case err == sql.ErrNoRows:
+		problem.Write(w, r, problem.NotFound("customer not found"))
+	case err != nil:
+		problem.Write(w, r, err)
+	default:
+		json.NewEncoder(w).Encode(m)
+	}
+}
+
+// ListMerges handles GET /v1/customers/{id}/merges, and the legacy
+// /v1/customers/merges?customer_id=, returning the merge audit trail of a
+// customer. Admin only.
+func (h *Handler) ListMerges(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(request.Param(r, "id", "customer_id"))
+	if !ok {
+		problem.Write(w, r, problem.Invalid(problem.Field("customer_id", "is required")))
+		return
+	}
+	list, err := h.repo.ListMerges(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 	json.NewEncoder(w).Encode(list)
 }
+
+// canAccess reports whether the caller may read or change the profile:
+// staff may access any customer, customers only their own.
+func canAccess(r *http.Request, p *Profile) bool {
+	return auth.HasRole(r, auth.RoleTeller, auth.RoleAdmin) || (p.UserID != 0 && p.UserID == auth.UserID(r))
+}
+
+// ifMatch extracts the version from an If-Match header value. "*" matches
+// any version and yields 0.
+func ifMatch(v string) (int, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+	if v == "*" {
+		return 0, true
+	}
+	return parseID(strings.Trim(v, `"`))
+}
+
+// Profile handles GET and PATCH /v1/customers/{id}, and the legacy
+// /v1/customers/profile?id=. GET returns the profile with its ETag; PATCH
+// applies a partial update and requires If-Match with the ETag it was
+// based on.
+func (h *Handler) Profile(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(request.Param(r, "id", "id"))
+	if !ok {
+		problem.Write(w, r, problem.Invalid(problem.Field("id", "is required")))
+		return
+	}
+	p, err := h.repo.GetProfile(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("customer not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !canAccess(r, p) {
+		problem.Write(w, r, problem.Forbidden(""))
+		return
+	}
+	if r.Method == http.MethodPatch {
+		h.updateProfile(w, r, p)
+		return
+	}
+	w.Header().Set("ETag", p.ETag())
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *Handler) updateProfile(w http.ResponseWriter, r *http.Request, p *Profile) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		problem.Write(w, r, problem.New(http.StatusPreconditionRequired, problem.CodePreconditionRequired, "If-Match header with the profile ETag is required"))
+		return
+	}
+	expected, ok := ifMatch(header)
+	if !ok {
+		problem.Write(w, r, problem.BadRequest("malformed If-Match header"))
+		return
+	}
+	if expected == 0 {
+		expected = p.Version
+	}
+	if expected != p.Version {
+		w.Header().Set("ETag", p.ETag())
+		problem.Write(w, r, ErrVersionConflict)
+		return
+	}
+	var patch Patch
+	if err := request.Decode(w, r, &patch); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	changed, err := patch.Apply(p)
+	if _, ok := err.(ValidationError); ok {
+		problem.Write(w, r, err)
+		return
+	}
+	if len(changed) > 0 {
+		err = h.repo.UpdateProfile(p, expected, changed, auth.UserID(r))
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		problem.Write(w, r, problem.NotFound("customer not found"))
+		return
+	case err != nil:
+		problem.Write(w, r, err)
+		return
+	}
+	h.afterUpdate(r, p, changed)
+	w.Header().Set("ETag", p.ETag())
+	json.NewEncoder(w).Encode(p)
+}
+
+// afterUpdate queues verification messages for changed contact details and
+// re-runs duplicate detection against the new details. Failures are
+// logged; the update itself has already been saved.
+func (h *Handler) afterUpdate(r *http.Request, p *Profile, changed []string) {
+	for _, ch := range []struct{ channel, target string }{{ChannelEmail, p.Email}, {ChannelMobile, p.Mobile}} {
+		if !contains(changed, ch.channel) || h.rdb == nil {
+			continue
+		}
+		b, _ := json.Marshal(map[string]interface{}{
+			"type":        "contact_verification",
+			"customer_id": p.ID,
+			"channel":     ch.channel,
+			"target":      ch.target,
+			"request_id":  logging.RequestID(r.Context()),
+			"traceparent": trace.Inject(r.Context()),
+		})
+		if err := h.rdb.LPush(r.Context(), "notifications", b).Err(); err != nil {
+			logging.From(r.Context()).Warnf("customer %d: queue %s verification: %v", p.ID, ch.channel, err)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	dups, err := h.repo.FindDuplicates(&p.Customer)
+	if err == nil && len(dups) > 0 {
+		err = h.repo.SaveDuplicates(dups)
+	}
+	if err != nil {
+		logging.From(r.Context()).Warnf("customer %d: duplicate check: %v", p.ID, err)
+	}
+}
+
+// History handles GET /v1/customers/{id}/history, and the legacy
+// /v1/customers/history?id=, returning every prior version of the profile,
+// newest first.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(request.Param(r, "id", "id"))
+	if !ok {
+		problem.Write(w, r, problem.Invalid(problem.Field("id", "is required")))
+		return
+	}
+	p, err := h.repo.GetProfile(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("customer not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if !canAccess(r, p) {
+		problem.Write(w, r, problem.Forbidden(""))
+		return
+	}
+	list, err := h.repo.History(id)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"current_version": p.Version, "versions": list})
+}
@@ -0,0 +1,113 @@
+package customer
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+// as returns r authenticated as the user with the given id and role, the
+// way auth.WithAuth leaves it.
+func as(r *http.Request, userID int, role string) *http.Request {
+	claims := jwt.MapClaims{"sub": float64(userID), "role": role}
+	return r.WithContext(context.WithValue(r.Context(), "claims", claims))
+}
+
+func TestListCustomersMasksForTellers(t *testing.T) {
+	now := time.Now()
+	h := NewHandler(NewRepo(sqltest.Open(sqltest.Reply{
+		Match: "FROM customers",
+		Cols:  []string{"id", "first_name", "last_name", "email", "mobile", "created_at"},
+		Rows:  [][]driver.Value{{int64(1), "Jane", "Doe", "jane@example.com", "0712345678", now}},
+	}), nil), nil)
+
+	for role, email := range map[string]string{auth.RoleTeller: "j***@example.com", auth.RoleAdmin: "jane@example.com"} {
+		rec := httptest.NewRecorder()
+		h.ListCustomers(rec, as(httptest.NewRequest(http.MethodGet, "/v1/customers", nil), 9, role))
+		var env struct{ Data []Customer }
+		if err := json.NewDecoder(rec.Body).Decode(&env); err != nil || len(env.Data) != 1 {
+			t.Fatalf("%s: %d %v", role, rec.Code, err)
+		}
+		if got := env.Data[0].Email; got != email {
+			t.Errorf("%s sees email %q, want %q", role, got, email)
+		}
+	}
+}
+
+func TestCreateCustomerOwner(t *testing.T) {
+	cases := []struct {
+		role string
+		want driver.Value
+	}{
+		{auth.RoleUser, int64(7)},
+		{auth.RoleTeller, nil},
+		{auth.RoleAdmin, nil},
+	}
+	for _, c := range cases {
+		var args []driver.Value
+		h := NewHandler(NewRepo(sqltest.Open(
+			sqltest.Reply{Match: "INSERT INTO customers", Cols: []string{"id", "created_at"}, Rows: [][]driver.Value{{int64(1), time.Now()}}, Args: &args},
+			sqltest.Reply{Cols: []string{"id"}},
+		), nil), nil)
+		req := httptest.NewRequest(http.MethodPost, "/v1/customers", strings.NewReader(`{"first_name":"Jane","last_name":"Doe","email":"jane@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.CreateCustomer(rec, as(req, 7, c.role))
+		if rec.Code != http.StatusOK || len(args) == 0 {
+			t.Fatalf("%s: status %d: %s", c.role, rec.Code, rec.Body)
+		}
+		if args[0] != c.want {
+			t.Errorf("%s: owner %v, want %v", c.role, args[0], c.want)
+		}
+	}
+}
+
+func TestProfileOwnership(t *testing.T) {
+	now := time.Now()
+	h := NewHandler(NewRepo(sqltest.Open(sqltest.Reply{
+		Match: "FROM customers WHERE id = $1",
+		Cols: []string{"id", "user_id", "first_name", "last_name", "email", "mobile",
+			"caf", "version", "email_verified", "mobile_verified", "updated_at", "created_at"},
+		Rows: [][]driver.Value{{int64(1), int64(7), "Jane", "Doe", "", "", []byte("{}"), int64(1), false, false, nil, now}},
+	}), nil), nil)
+	cases := []struct {
+		user int
+		role string
+		want int
+	}{
+		{7, auth.RoleUser, http.StatusOK},
+		{8, auth.RoleUser, http.StatusForbidden},
+		{8, auth.RoleTeller, http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/v1/customers/1", nil)
+		req.SetPathValue("id", "1")
+		rec := httptest.NewRecorder()
+		h.Profile(rec, as(req, c.user, c.role))
+		if rec.Code != c.want {
+			t.Errorf("user %d (%s): status %d, want %d", c.user, c.role, rec.Code, c.want)
+		}
+	}
+}
+
+func TestCreateCustomerRejectsMobile(t *testing.T) {
+	h := NewHandler(NewRepo(sqltest.Open(), nil), nil)
+	body := `{"first_name":"Jane","email":"jane@example.com","mobile":"0712345678"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/customers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.CreateCustomer(rec, as(req, 7, auth.RoleUser))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "E.164") {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,359 @@
+package customer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// ErrNotMergeable is returned when either customer in a merge is not active
+// or both ids are the same.
+var ErrNotMergeable = problem.New(http.StatusConflict, "not_mergeable", "customers cannot be merged")
+
+// Duplicate is a pair of customers the matching engine thinks may be the
+// same person.
+type Duplicate struct {
+	ID        int        `json:"id"`
+	Customer  *Customer  `json:"customer,omitempty"`
+	Candidate *Customer  `json:"candidate"`
+	Score     float64    `json:"score"`
+	Reasons   []string   `json:"reasons"`
+	Status    string     `json:"status"`
+	DecidedBy *int       `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Key returns the keyset position of d for pagination.
+func (d *Duplicate) Key() page.Cursor { return page.Cursor{ID: d.ID} }
+
+// Merge is the audit record of a customer merge. Moved lists, per table, the
+// ids of the rows re-parented from the merged customer to the survivor.
+type Merge struct {
+	ID           int              `json:"id"`
+	SurvivorID   int              `json:"survivor_id"`
+	MergedID     int              `json:"merged_id"`
+	Actor        int              `json:"actor_user_id"`
+	Reason       string           `json:"reason"`
+	MergedRecord json.RawMessage  `json:"merged_record"`
+	Moved        map[string][]int `json:"moved"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// reparented are the tables whose customer_id moves to the survivor on a
+// merge.
+var reparented = []string{"accounts", "loans", "beneficiaries", "standing_orders", "limit_increases"}
+
+// FindDuplicates scores the active customers sharing an email, mobile,
+// phonetic surname or date of birth with c and returns those at or above
+// DuplicateThreshold, best first, as unsaved Duplicates. Sealed records are
+// found through their blind indexes.
+func (r *Repo) FindDuplicates(c *Customer) ([]*Duplicate, error) {
+	rows, err := r.db.Query(`
+		SELECT id, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''),
+			caf, created_at
+		FROM customers
+		WHERE id <> $1 AND status = 'active' AND (
+			(pii_key_id IS NULL AND (
+				lower(email) = lower($2)
+				OR ($3 <> '' AND right(regexp_replace(COALESCE(mobile,''), '\D', '', 'g'), 10) = $3)
+				OR ($4 <> '' AND dmetaphone(COALESCE(last_name,'')) = dmetaphone($4))
+				OR ($5 <> '' AND caf->>'date_of_birth' = $5)))
+			OR search_bidx && $6::text[])
+		ORDER BY id DESC LIMIT 200`,
+		c.ID, c.Email, normalizeMobile(c.Mobile), c.LastName, c.KYC[kycDateOfBirth], pq.Array(r.blind(duplicateTokens(c))))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Duplicate
+	for rows.Next() {
+		o := &Customer{}
+		var caf []byte
+		if err := rows.Scan(&o.ID, &o.FirstName, &o.LastName, &o.Email, &o.Mobile, &caf, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := r.open(o, caf); err != nil {
+			return nil, err
+		}
+		if score, reasons := Score(c, o); score >= DuplicateThreshold {
+			out = append(out, &Duplicate{Customer: c, Candidate: o, Score: score, Reasons: reasons, Status: DuplicatePending})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out, nil
+}
+
+// SaveDuplicates records possible duplicates for staff review.
+func (r *Repo) SaveDuplicates(ds []*Duplicate) error {
+	for _, d := range ds {
+		err := r.db.QueryRow(`
+			INSERT INTO customer_duplicates(customer_id, candidate_id, score, reasons)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (customer_id, candidate_id) DO UPDATE SET score = EXCLUDED.score, reasons = EXCLUDED.reasons
+			RETURNING id, status, created_at`,
+			d.Customer.ID, d.Candidate.ID, d.Score, pq.Array(d.Reasons)).Scan(&d.ID, &d.Status, &d.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const duplicateSelect = `
+	SELECT d.id, d.score, d.reasons, d.status, d.decided_by, d.decided_at, d.created_at,
+		a.id, COALESCE(a.first_name,''), COALESCE(a.last_name,''), COALESCE(a.email,''), COALESCE(a.mobile,''), a.created_at,
+		b.id, COALESCE(b.first_name,''), COALESCE(b.last_name,''), COALESCE(b.email,''), COALESCE(b.mobile,''), b.created_at
+	FROM customer_duplicates d
+	JOIN customers a ON a.id = d.customer_id
+	JOIN customers b ON b.id = d.candidate_id`
+
+// ListDuplicates returns one page of duplicate pairs with the given status,
+// fetching p.Limit+1 rows.
+func (r *Repo) ListDuplicates(status string, p page.Params) ([]*Duplicate, error) {
+	args := []interface{}{status, p.Limit + 1}
+	where := " WHERE d.status = $1"
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where += " AND d.id " + p.Cmp() + " $3"
+	}
+	rows, err := r.db.Query(duplicateSelect+where+" ORDER BY d.id "+p.Dir()+" LIMIT $2", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Duplicate
+	for rows.Next() {
+		d := &Duplicate{Customer: &Customer{}, Candidate: &Customer{}}
+		var decidedBy sql.NullInt64
+		var decidedAt sql.NullTime
+		a, b := d.Customer, d.Candidate
+		if err := rows.Scan(&d.ID, &d.Score, pq.Array(&d.Reasons), &d.Status, &decidedBy, &decidedAt, &d.CreatedAt,
+			&a.ID, &a.FirstName, &a.LastName, &a.Email, &a.Mobile, &a.CreatedAt,
+			&b.ID, &b.FirstName, &b.LastName, &b.Email, &b.Mobile, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := r.open(a, nil); err != nil {
+			return nil, err
+		}
+		if err := r.open(b, nil); err != nil {
+			return nil, err
+		}
+		if decidedBy.Valid {
+			v := int(decidedBy.Int64)
+			d.DecidedBy = &v
+		}
+		if decidedAt.Valid {
+			d.DecidedAt = &decidedAt.Time
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// DismissDuplicate marks a pending pair as not being the same person.
+func (r *Repo) DismissDuplicate(id, actor int) error {
+	res, err := r.db.Exec(`UPDATE customer_duplicates SET status = $1, decided_by = $2, decided_at = now()
+		WHERE id = $3 AND status = $4`, DuplicateDismissed, actor, id, DuplicatePending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MergeCustomers folds mergedID into survivorID in one transaction. The
+// merged customer's accounts, loans, payees, standing orders, limit increases
+// and customer-scoped limits move to the survivor; KYC data and empty
+// contact fields on the survivor are filled from the merged record; the
+// merged customer is kept, marked merged, for history. The audit record
+// stores the merged customer as it was and every row that moved.
+func (r *Repo) MergeCustomers(survivorID, mergedID, actor int, reason string) (*Merge, error) {
+	if survivorID == mergedID {
+		return nil, ErrNotMergeable
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, status FROM customers WHERE id IN ($1, $2) ORDER BY id FOR UPDATE", survivorID, mergedID)
+	if err != nil {
+		return nil, err
+	}
+	found := 0
+	for rows.Next() {
+		var id int
+		var status string
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if status != StatusActive {
+			rows.Close()
+			return nil, ErrNotMergeable
+		}
+		found++
+	}
+	rows.Close()
+	if found != 2 {
+		return nil, sql.ErrNoRows
+	}
+
+	m := &Merge{SurvivorID: survivorID, MergedID: mergedID, Actor: actor, Reason: reason, Moved: map[string][]int{}}
+	var record []byte
+	if err := tx.QueryRow("SELECT to_jsonb(c) - 'search_vector' FROM customers c WHERE id = $1", mergedID).Scan(&record); err != nil {
+		return nil, err
+	}
+	m.MergedRecord = record
+	// a payee both customers already have would break the one-active-payee
+	// index, so the merged customer's copy is retired
+	if _, err := tx.Exec(`UPDATE beneficiaries SET deleted_at = now()
+		WHERE customer_id = $2 AND deleted_at IS NULL AND account_number IN (
+			SELECT account_number FROM beneficiaries WHERE customer_id = $1 AND deleted_at IS NULL)`, survivorID, mergedID); err != nil {
+		return nil, err
+	}
+	for _, table := range reparented {
+		ids, err := collectIDs(tx, "UPDATE "+table+" SET customer_id = $1 WHERE customer_id = $2 RETURNING id", survivorID, mergedID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		m.Moved[table] = ids
+	}
+	ids, err := collectIDs(tx, `UPDATE transaction_limits l SET scope_ref = $1::text
+		WHERE l.scope = 'customer' AND l.scope_ref = $2::text AND NOT EXISTS (
+			SELECT 1 FROM transaction_limits s WHERE s.scope = 'customer' AND s.scope_ref = $1::text
+			  AND s.txn_type = l.txn_type AND s.period = l.period)
+		RETURNING l.id`, survivorID, mergedID)
+	if err != nil {
+		return nil, fmt.Errorf("transaction_limits: %w", err)
+	}
+	m.Moved["transaction_limits"] = ids
+
+	if err := r.absorb(tx, survivorID, mergedID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE customers SET status = $1, merged_into = $2 WHERE id = $3", StatusMerged, survivorID, mergedID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE customer_duplicates SET status = $1, decided_by = $2, decided_at = now()
+		WHERE status = $3 AND (customer_id = $4 OR candidate_id = $4)`, DuplicateMerged, actor, DuplicatePending, mergedID); err != nil {
+		return nil, err
+	}
+	moved, _ := json.Marshal(m.Moved)
+	if err := tx.QueryRow(`INSERT INTO customer_merges(survivor_id, merged_id, actor_user_id, reason, merged_record, moved)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		survivorID, mergedID, actor, reason, record, moved).Scan(&m.ID, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	return m, tx.Commit()
+}
+
+// absorb fills the survivor's KYC data and empty contact fields from the
+// merged customer. It runs in Go rather than SQL because either record may
+// be sealed.
+func (r *Repo) absorb(tx *sql.Tx, survivorID, mergedID int) error {
+	load := func(id int) (*Customer, error) {
+		c := &Customer{ID: id}
+		var caf []byte
+		if err := tx.QueryRow(`SELECT COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''), caf
+			FROM customers WHERE id = $1`, id).Scan(&c.FirstName, &c.LastName, &c.Email, &c.Mobile, &caf); err != nil {
+			return nil, err
+		}
+		return c, r.open(c, caf)
+	}
+	s, err := load(survivorID)
+	if err != nil {
+		return err
+	}
+	m, err := load(mergedID)
+	if err != nil {
+		return err
+	}
+	for k, v := range m.KYC {
+		if s.KYC == nil {
+			s.KYC = map[string]string{}
+		}
+		if _, ok := s.KYC[k]; !ok {
+			s.KYC[k] = v
+		}
+	}
+	if s.Email == "" {
+		s.Email = m.Email
+	}
+	if s.Mobile == "" {
+		s.Mobile = m.Mobile
+	}
+	st, err := r.seal(s)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE customers SET first_name = $1, last_name = $2, email = $3, mobile = $4, caf = $5,
+			email_bidx = $6, mobile_bidx = $7, search_bidx = $8, pii_key_id = $9
+		WHERE id = $10`,
+		st.FirstName, st.LastName, st.Email, st.Mobile, st.CAF, st.EmailIdx, st.MobileIdx, pq.Array(st.Tokens), st.KeyID, survivorID)
+	return err
+}
+
+func collectIDs(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ListMerges returns the merge audit records in which the customer was the
+// survivor or the merged record, newest first.
+func (r *Repo) ListMerges(customerID int) ([]*Merge, error) {
+	rows, err := r.db.Query(`SELECT id, survivor_id, merged_id, COALESCE(actor_user_id, 0), COALESCE(reason,''), merged_record, moved, created_at
+		FROM customer_merges WHERE survivor_id = $1 OR merged_id = $1 ORDER BY id DESC`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*Merge{}
+	for rows.Next() {
+		m := &Merge{}
+		var record, moved []byte
+		if err := rows.Scan(&m.ID, &m.SurvivorID, &m.MergedID, &m.Actor, &m.Reason, &record, &moved, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.MergedRecord = record
+		if err := json.Unmarshal(moved, &m.Moved); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// parseID reads a positive integer id.
+func parseID(v string) (int, bool) {
+	id, err := strconv.Atoi(v)
+	return id, err == nil && id > 0
+}
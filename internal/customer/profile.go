@@ -0,0 +1,277 @@
+package customer
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// ErrVersionConflict is returned when a profile update was based on a
+// version that is no longer current.
+var ErrVersionConflict = problem.New(http.StatusPreconditionFailed, "version_conflict", "customer was modified by someone else")
+
+// Contact channels that need verification.
+const (
+	ChannelEmail  = "email"
+	ChannelMobile = "mobile"
+)
+
+// Profile is a customer with the fields needed to update it safely. Version
+// increases with every update and is exposed to clients as the ETag.
+type Profile struct {
+	Customer
+	UserID         int        `json:"-"`
+	Version        int        `json:"version"`
+	EmailVerified  bool       `json:"email_verified"`
+	MobileVerified bool       `json:"mobile_verified"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// ETag returns the entity tag of the profile's current version.
+func (p *Profile) ETag() string { return fmt.Sprintf(`"%d"`, p.Version) }
+
+// Version is a prior state of a customer profile, kept when an update
+// replaced it.
+type Version struct {
+	Version       int               `json:"version"`
+	FirstName     string            `json:"first_name"`
+	LastName      string            `json:"last_name"`
+	Email         string            `json:"email"`
+	Mobile        string            `json:"mobile"`
+	KYC           map[string]string `json:"kyc,omitempty"`
+	ChangedFields []string          `json:"changed_fields"`
+	ReplacedBy    int               `json:"replaced_by"`
+	ReplacedAt    time.Time         `json:"replaced_at"`
+}
+
+// ValidationError lists the fields of a patch that failed validation.
+type ValidationError map[string]string
+
+func (v ValidationError) Error() string {
+	fields := make([]string, 0, len(v))
+	for f, msg := range v {
+		fields = append(fields, f+": "+msg)
+	}
+	sort.Strings(fields)
+	return "invalid customer: " + strings.Join(fields, "; ")
+}
+
+// Problem reports the invalid fields, sorted by name.
+func (v ValidationError) Problem() *problem.Error {
+	var fields []problem.FieldError
+	for f, msg := range v {
+		fields = append(fields, problem.Field(f, msg))
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return problem.Invalid(fields...)
+}
+
+// Patch is a partial profile update. Absent fields are left unchanged; a
+// null KYC value removes that key.
+type Patch struct {
+	FirstName *string            `json:"first_name"`
+	LastName  *string            `json:"last_name"`
+	Email     *string            `json:"email"`
+	Mobile    *string            `json:"mobile"`
+	KYC       map[string]*string `json:"kyc"`
+}
+
+// Apply validates the patch and applies it to p, returning the names of the
+// fields that actually changed.
+func (pt *Patch) Apply(p *Profile) ([]string, error) {
+	verr := ValidationError{}
+	var changed []string
+	var assign []func()
+	set := func(field string, dst *string, v *string, check func(string) string) {
+		if v == nil {
+			return
+		}
+		val := strings.TrimSpace(*v)
+		if msg := check(val); msg != "" {
+			verr[field] = msg
+			return
+		}
+		if val != *dst {
+			assign = append(assign, func() { *dst = val })
+			changed = append(changed, field)
+		}
+	}
+	name := func(v string) string {
+		if v == "" || len([]rune(v)) > 100 {
+			return "must be 1 to 100 characters"
+		}
+		return ""
+	}
+	set("first_name", &p.FirstName, pt.FirstName, name)
+	set("last_name", &p.LastName, pt.LastName, name)
+	set(ChannelEmail, &p.Email, pt.Email, func(v string) string {
+		if a, err := mail.ParseAddress(v); err != nil || a.Address != v {
+			return "must be a valid email address"
+		}
+		return ""
+	})
+	set(ChannelMobile, &p.Mobile, pt.Mobile, func(v string) string {
+		if !request.E164.MatchString(v) {
+			return "must be in E.164 format, e.g. +14155550100"
+		}
+		return ""
+	})
+	if len(verr) > 0 {
+		return nil, verr
+	}
+	for _, fn := range assign {
+		fn()
+	}
+	kycChanged := false
+	for k, v := range pt.KYC {
+		old, had := p.KYC[k]
+		switch {
+		case v == nil && had:
+			delete(p.KYC, k)
+			kycChanged = true
+		case v != nil && (!had || old != *v):
+			if p.KYC == nil {
+				p.KYC = map[string]string{}
+			}
+			p.KYC[k] = *v
+			kycChanged = true
+		}
+	}
+	if kycChanged {
+		changed = append(changed, "kyc")
+	}
+	return changed, nil
+}
+
+// GetProfile returns the customer with its version and verification state.
+func (r *Repo) GetProfile(id int) (*Profile, error) {
+	p := &Profile{}
+	var caf []byte
+	var userID sql.NullInt64
+	var updated sql.NullTime
+	err := r.db.QueryRow(`SELECT id, user_id, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''),
+			COALESCE(caf, '{}'), version, email_verified, mobile_verified, updated_at, created_at
+		FROM customers WHERE id = $1 AND status = 'active'`, id).
+		Scan(&p.ID, &userID, &p.FirstName, &p.LastName, &p.Email, &p.Mobile, &caf, &p.Version,
+			&p.EmailVerified, &p.MobileVerified, &updated, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.UserID = int(userID.Int64)
+	if updated.Valid {
+		p.UpdatedAt = &updated.Time
+	}
+	if err := r.open(&p.Customer, caf); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateProfile saves p if the stored version is still expected. The
+// replaced version is copied to the history table, and a changed email or
+// mobile is marked unverified with a pending verification queued. On
+// success p.Version holds the new version.
+func (r *Repo) UpdateProfile(p *Profile, expected int, changed []string, actor int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO customer_history(customer_id, version, first_name, last_name, email, mobile, caf, changed_fields, replaced_by)
+		SELECT id, version, first_name, last_name, email, mobile, caf, $3, $4 FROM customers
+		WHERE id = $1 AND version = $2 AND status = 'active'`, p.ID, expected, pq.Array(changed), actor)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND status = 'active')", p.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+		return ErrVersionConflict
+	}
+	st, err := r.seal(&p.Customer)
+	if err != nil {
+		return err
+	}
+	emailChanged, mobileChanged := contains(changed, ChannelEmail), contains(changed, ChannelMobile)
+	err = tx.QueryRow(`UPDATE customers SET first_name = $2, last_name = $3, email = $4, mobile = $5, caf = $6,
+			email_verified = email_verified AND NOT $7, mobile_verified = mobile_verified AND NOT $8,
+			email_bidx = $9, mobile_bidx = $10, search_bidx = $11, pii_key_id = $12,
+			version = version + 1, updated_at = now()
+		WHERE id = $1 RETURNING version, email_verified, mobile_verified, updated_at`,
+		p.ID, st.FirstName, st.LastName, st.Email, st.Mobile, st.CAF, emailChanged, mobileChanged,
+		st.EmailIdx, st.MobileIdx, pq.Array(st.Tokens), st.KeyID).
+		Scan(&p.Version, &p.EmailVerified, &p.MobileVerified, &p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	for _, ch := range []struct {
+		changed bool
+		channel string
+		target  string
+	}{{emailChanged, ChannelEmail, p.Email}, {mobileChanged, ChannelMobile, p.Mobile}} {
+		if !ch.changed {
+			continue
+		}
+		target, err := r.cipher.Seal(fieldTarget, ch.target)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE customer_verifications SET status = 'superseded' WHERE customer_id = $1 AND channel = $2 AND status = 'pending'", p.ID, ch.channel); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO customer_verifications(customer_id, channel, target) VALUES ($1, $2, $3)", p.ID, ch.channel, target); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// History returns the prior versions of a customer profile, newest first.
+func (r *Repo) History(customerID int) ([]*Version, error) {
+	rows, err := r.db.Query(`SELECT version, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''),
+			COALESCE(caf, '{}'), changed_fields, COALESCE(replaced_by, 0), replaced_at
+		FROM customer_history WHERE customer_id = $1 ORDER BY version DESC`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*Version{}
+	for rows.Next() {
+		v := &Version{}
+		var caf []byte
+		if err := rows.Scan(&v.Version, &v.FirstName, &v.LastName, &v.Email, &v.Mobile, &caf,
+			pq.Array(&v.ChangedFields), &v.ReplacedBy, &v.ReplacedAt); err != nil {
+			return nil, err
+		}
+		c := &Customer{FirstName: v.FirstName, LastName: v.LastName, Email: v.Email, Mobile: v.Mobile}
+		if err := r.open(c, caf); err != nil {
+			return nil, err
+		}
+		v.FirstName, v.LastName, v.Email, v.Mobile, v.KYC = c.FirstName, c.LastName, c.Email, c.Mobile, c.KYC
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package customer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func str(s string) *string { return &s }
+
+func TestPatchApply(t *testing.T) {
+	p := &Profile{Customer: Customer{FirstName: "Ann", LastName: "Lee", Email: "ann@example.com", Mobile: "+14155550100",
+		KYC: map[string]string{"national_id": "X1", "tax_id": "T9"}}}
+	patch := &Patch{
+		FirstName: str("Ann"),
+		Email:     str(" ann.lee@example.com "),
+		KYC:       map[string]*string{"tax_id": nil, "date_of_birth": str("1990-05-01")},
+	}
+	changed, err := patch.Apply(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"email", "kyc"}) {
+		t.Errorf("changed = %v", changed)
+	}
+	if p.Email != "ann.lee@example.com" || p.KYC["tax_id"] != "" || p.KYC["date_of_birth"] != "1990-05-01" {
+		t.Errorf("profile = %+v", p)
+	}
+}
+
+func TestPatchValidation(t *testing.T) {
+	p := &Profile{Customer: Customer{FirstName: "Ann", Email: "ann@example.com", Mobile: "+14155550100"}}
+	_, err := (&Patch{FirstName: str(""), LastName: str("Lee"), Email: str("Ann <ann@example.com>"), Mobile: str("0415 555 0100")}).Apply(p)
+	verr, ok := err.(ValidationError)
+	if !ok || len(verr) != 3 {
+		t.Fatalf("err = %v", err)
+	}
+	if p.Email != "ann@example.com" || p.LastName != "" {
+		t.Error("invalid patch must not modify the profile")
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	for in, want := range map[string]int{`"3"`: 3, `W/"12"`: 12, "*": 0} {
+		if got, ok := ifMatch(in); !ok || got != want {
+			t.Errorf("ifMatch(%q) = %d, %v", in, got, ok)
+		}
+	}
+	if _, ok := ifMatch(`"abc"`); ok {
+		t.Error("expected malformed ETag to be rejected")
+	}
+}
@@ -5,44 +5,85 @@ package customer
 import (
 	"database/sql"
 	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/pii"
 )
 
 // Repo provides database methods for interacting with the customers table.
-type Repo struct{ db *sql.DB }
+// With a cipher, names, contact details and KYC data are sealed at rest.
+type Repo struct {
+	db     *sql.DB
+	cipher *pii.Cipher
+}
 
-// NewRepo initializes and returns a new customer repository instance.
-func NewRepo(db *sql.DB) *Repo { return &Repo{db: db} }
+// NewRepo initializes and returns a new customer repository instance. A nil
+// cipher stores personal data in plaintext.
+func NewRepo(db *sql.DB, c *pii.Cipher) *Repo { return &Repo{db: db, cipher: c} }
 
-// Customer represents a customer entity in the system.
+// Customer represents a customer entity in the system. KYC holds identity
+// data from the customer acquisition form, such as date_of_birth and
+// national_id, and is stored in the caf column.
 type Customer struct {
-	ID        int       `json:"id"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	Email     string    `json:"email"`
-	Mobile    string    `json:"mobile"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int               `json:"id"`
+	FirstName string            `json:"first_name" validate:"required,max=100"`
+	LastName  string            `json:"last_name" validate:"max=100"`
+	Email     string            `json:"email" validate:"required,email,max=254"`
+	Mobile    string            `json:"mobile" validate:"e164"`
+	KYC       map[string]string `json:"kyc,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
 }
 
-// Create inserts a new customer record in the database.
+// Create inserts a new customer record in the database, owned by the login
+// userID, or by none when userID is 0.
 func (r *Repo) Create(c *Customer, userID int) error {
+	s, err := r.seal(c)
+	if err != nil {
+		return err
+	}
 	query := `
-		INSERT INTO customers(user_id, caf, first_name, last_name, email, mobile)
-		VALUES ($1, '{}', $2, $3, $4, $5)
+		INSERT INTO customers(user_id, caf, first_name, last_name, email, mobile, email_bidx, mobile_bidx, search_bidx, pii_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at
 	`
 	return r.db.QueryRow(
 		query,
-		userID,
-		c.FirstName,
-		c.LastName,
-		c.Email,
-		c.Mobile,
+		sql.NullInt64{Int64: int64(userID), Valid: userID != 0},
+		s.CAF,
+		s.FirstName,
+		s.LastName,
+		s.Email,
+		s.Mobile,
+		s.EmailIdx,
+		s.MobileIdx,
+		pq.Array(s.Tokens),
+		s.KeyID,
 	).Scan(&c.ID, &c.CreatedAt)
 }
 
-// List retrieves the most recent 100 customers from the database.
-func (r *Repo) List() ([]*Customer, error) {
-	rows, err := r.db.Query("SELECT id, first_name,last_name,email,mobile,created_at FROM customers ORDER BY id DESC LIMIT 100")
+// OwnerUserID returns the id of the login linked to a customer, or 0 when
+// none is.
+func (r *Repo) OwnerUserID(customerID int) (int, error) {
+	var id sql.NullInt64
+	err := r.db.QueryRow("SELECT user_id FROM customers WHERE id = $1", customerID).Scan(&id)
+	return int(id.Int64), err
+}
+
+// Key returns the keyset position of c for pagination.
+func (c *Customer) Key() page.Cursor { return page.Cursor{ID: c.ID} }
+
+// List retrieves one page of active customers ordered by id. It fetches p.Limit+1
+// rows so the caller can tell whether another page follows.
+func (r *Repo) List(p page.Params) ([]*Customer, error) {
+	args := []interface{}{p.Limit + 1}
+	where := "WHERE status = 'active'"
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where += " AND id " + p.Cmp() + " $2"
+	}
+	rows, err := r.db.Query("SELECT id, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''), created_at FROM customers "+where+" ORDER BY id "+p.Dir()+" LIMIT $1", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +94,10 @@ func (r *Repo) List() ([]*Customer, error) {
 		if err := rows.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.Mobile, &c.CreatedAt); err != nil {
 			return nil, err
 		}
+		if err := r.open(c, nil); err != nil {
+			return nil, err
+		}
 		out = append(out, c)
 	}
-	return out, nil
+	return out, rows.Err()
 }
@@ -0,0 +1,183 @@
+package customer
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/health"
+)
+
+// reencryptBatch is the number of customers re-encrypted per transaction.
+const reencryptBatch = 100
+
+// Reencrypt re-seals up to batch customers that are not yet sealed under
+// the current master key, together with their profile history and
+// verification targets, and returns how many it processed. Plaintext rows
+// written before encryption was enabled are sealed for the first time.
+// Versions are not bumped, since the profile itself does not change. Rows
+// locked by other transactions are skipped and picked up on a later pass.
+func (r *Repo) Reencrypt(ctx context.Context, batch int) (int, error) {
+	if r.cipher == nil {
+		return 0, nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, `SELECT id, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''), caf
+		FROM customers WHERE pii_key_id IS DISTINCT FROM $1 AND status <> 'erased'
+		ORDER BY id LIMIT $2 FOR UPDATE SKIP LOCKED`, r.cipher.CurrentKeyID(), batch)
+	if err != nil {
+		return 0, err
+	}
+	var cs []*Customer
+	for rows.Next() {
+		c := &Customer{}
+		var caf []byte
+		if err := rows.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.Mobile, &caf); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := r.open(c, caf); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		cs = append(cs, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, c := range cs {
+		st, err := r.seal(c)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE customers SET first_name = $1, last_name = $2, email = $3, mobile = $4, caf = $5,
+				email_bidx = $6, mobile_bidx = $7, search_bidx = $8, pii_key_id = $9
+			WHERE id = $10`,
+			st.FirstName, st.LastName, st.Email, st.Mobile, st.CAF, st.EmailIdx, st.MobileIdx, pq.Array(st.Tokens), st.KeyID, c.ID); err != nil {
+			return 0, err
+		}
+		if err := r.reencryptHistory(ctx, tx, c.ID); err != nil {
+			return 0, err
+		}
+		if err := r.reencryptTargets(ctx, tx, c.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(cs), tx.Commit()
+}
+
+// reencryptHistory re-seals the stored prior versions of a customer.
+func (r *Repo) reencryptHistory(ctx context.Context, tx *sql.Tx, customerID int) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, COALESCE(first_name,''), COALESCE(last_name,''), COALESCE(email,''), COALESCE(mobile,''), caf
+		FROM customer_history WHERE customer_id = $1`, customerID)
+	if err != nil {
+		return err
+	}
+	var vs []*Customer
+	for rows.Next() {
+		// the history id stands in for the customer id
+		c := &Customer{}
+		var caf []byte
+		if err := rows.Scan(&c.ID, &c.FirstName, &c.LastName, &c.Email, &c.Mobile, &caf); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := r.open(c, caf); err != nil {
+			rows.Close()
+			return err
+		}
+		vs = append(vs, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, c := range vs {
+		st, err := r.seal(c)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE customer_history SET first_name = $1, last_name = $2, email = $3, mobile = $4, caf = $5
+			WHERE id = $6`, st.FirstName, st.LastName, st.Email, st.Mobile, st.CAF, c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reencryptTargets re-seals the contact verification targets of a customer.
+func (r *Repo) reencryptTargets(ctx context.Context, tx *sql.Tx, customerID int) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, target FROM customer_verifications WHERE customer_id = $1", customerID)
+	if err != nil {
+		return err
+	}
+	targets := map[int]string{}
+	for rows.Next() {
+		var id int
+		var target string
+		if err := rows.Scan(&id, &target); err != nil {
+			rows.Close()
+			return err
+		}
+		targets[id] = target
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, target := range targets {
+		plain, err := r.cipher.Open(fieldTarget, target)
+		if err != nil {
+			return err
+		}
+		sealed, err := r.cipher.Seal(fieldTarget, plain)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE customer_verifications SET target = $1 WHERE id = $2", sealed, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartReencryption re-encrypts customers under the current master key
+// every interval until none are left on an old key or in plaintext. It
+// blocks until ctx is cancelled, so run it in its own goroutine; a batch in
+// progress is committed before it returns. Each pass is reported to hb.
+func StartReencryption(ctx context.Context, r *Repo, interval time.Duration, hb *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		total := 0
+		for ctx.Err() == nil {
+			n, err := r.Reencrypt(context.WithoutCancel(ctx), reencryptBatch)
+			if err != nil {
+				logrus.Errorf("pii re-encryption: %v", err)
+				hb.Fail(err)
+				break
+			}
+			total += n
+			if n < reencryptBatch {
+				hb.Beat()
+				break
+			}
+		}
+		if total > 0 {
+			logrus.Infof("pii re-encryption: re-sealed %d customers under key %s", total, r.cipher.CurrentKeyID())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package customer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/db"
+	"github.com/example/real_time_core_banking_v9/internal/mask"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+)
+
+// SearchResult is a customer matched by Search, with their accounts and a
+// relevance score. Higher scores rank first.
+type SearchResult struct {
+	ID             int       `json:"id"`
+	FirstName      string    `json:"first_name"`
+	LastName       string    `json:"last_name"`
+	Email          string    `json:"email"`
+	Mobile         string    `json:"mobile"`
+	NationalID     string    `json:"national_id,omitempty"`
+	AccountNumbers []string  `json:"account_numbers"`
+	Score          float64   `json:"score"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Key returns the keyset position of s in relevance order.
+func (s *SearchResult) Key() page.Cursor {
+	return page.Cursor{Key: strconv.FormatFloat(s.Score, 'f', -1, 64), ID: s.ID}
+}
+
+// Mask hides contact details and identifiers, leaving enough for staff to
+// confirm a match with the customer in front of them.
+func (s *SearchResult) Mask() {
+	s.Email = mask.Email(s.Email)
+	s.Mobile = mask.Tail(s.Mobile, 4)
+	s.NationalID = mask.Tail(s.NationalID, 4)
+	for i, n := range s.AccountNumbers {
+		s.AccountNumbers[i] = mask.AccountNumber(n)
+	}
+}
+
+// searchTerms splits a query into the pieces each matcher needs: a prefix
+// tsquery over its words, the words long enough for phonetic matching, and
+// its digits when there are enough of them to look like a phone number.
+func searchTerms(q string) (tsquery string, words []string, digits string) {
+	var parts []string
+	for _, f := range strings.FieldsFunc(q, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		parts = append(parts, strings.ToLower(f)+":*")
+		if len([]rune(f)) >= 3 {
+			words = append(words, f)
+		}
+	}
+	for _, r := range q {
+		if unicode.IsDigit(r) {
+			digits += string(r)
+		}
+	}
+	if len(digits) < 4 {
+		digits = ""
+	}
+	return strings.Join(parts, " & "), words, digits
+}
+
+// Search finds active customers by name, email, mobile, account number or KYC
+// identifier. Full-text prefix matches, trigram similarity, substring
+// matches on phone and account numbers and Double Metaphone name matches all
+// contribute to the score. Sealed records cannot be matched on their
+// contents in SQL; they match on blind indexes of whole name words, Soundex
+// codes, email, mobile and identifiers instead. Results are ordered by
+// score, then id.
+func (r *Repo) Search(q string, p page.Params) ([]*SearchResult, error) {
+	tsq, words, digits := searchTerms(q)
+	var afterScore interface{}
+	afterID := 0
+	if p.After != nil {
+		f, err := strconv.ParseFloat(p.After.Key, 64)
+		if err != nil {
+			return nil, page.ErrBadCursor
+		}
+		afterScore, afterID = f, p.After.ID
+	}
+	rows, err := r.db.Query(`
+		SELECT * FROM (
+			SELECT c.id, COALESCE(c.first_name,''), COALESCE(c.last_name,''), COALESCE(c.email,''), COALESCE(c.mobile,''),
+				c.caf, COALESCE(a.numbers, '{}'), c.created_at,
+				ROUND((
+					CASE WHEN c.pii_key_id IS NULL THEN
+						CASE WHEN $2 <> '' THEN ts_rank(c.search_vector, to_tsquery('simple', $2)) ELSE 0 END
+						+ similarity(lower(COALESCE(c.first_name,'') || ' ' || COALESCE(c.last_name,'')), lower($1))
+						+ similarity(lower(COALESCE(c.email,'')), lower($1))
+						+ CASE WHEN $3 <> '' AND regexp_replace(COALESCE(c.mobile,''), '\D', '', 'g') LIKE '%' || $3 || '%' THEN 1 ELSE 0 END
+						+ CASE WHEN dmetaphone(COALESCE(c.first_name,'')) = ANY(p.codes) OR dmetaphone(COALESCE(c.last_name,'')) = ANY(p.codes) THEN 0.5 ELSE 0 END
+					ELSE
+						0.5 * (SELECT COUNT(*) FROM unnest(c.search_bidx) t WHERE t = ANY($9::text[]))
+					END
+					+ CASE WHEN EXISTS (SELECT 1 FROM unnest(a.numbers) n WHERE n ILIKE '%' || $4 || '%') THEN 1 ELSE 0 END
+				)::numeric, 6)::float8 AS score
+			FROM customers c
+			LEFT JOIN (SELECT customer_id, array_agg(account_number ORDER BY id) AS numbers FROM accounts GROUP BY customer_id) a ON a.customer_id = c.id
+			CROSS JOIN (SELECT COALESCE(array_agg(dmetaphone(w)) FILTER (WHERE dmetaphone(w) <> ''), '{}') AS codes FROM unnest($5::text[]) w) p
+			WHERE c.status = 'active' AND (
+				(c.pii_key_id IS NULL AND (
+					($2 <> '' AND c.search_vector @@ to_tsquery('simple', $2))
+					OR lower(COALESCE(c.first_name,'') || ' ' || COALESCE(c.last_name,'')) % lower($1)
+					OR lower(COALESCE(c.email,'')) LIKE '%' || lower($4) || '%'
+					OR ($3 <> '' AND regexp_replace(COALESCE(c.mobile,''), '\D', '', 'g') LIKE '%' || $3 || '%')
+					OR dmetaphone(COALESCE(c.first_name,'')) = ANY(p.codes)
+					OR dmetaphone(COALESCE(c.last_name,'')) = ANY(p.codes)))
+				OR c.search_bidx && $9::text[]
+				OR EXISTS (SELECT 1 FROM unnest(a.numbers) n WHERE n ILIKE '%' || $4 || '%'))
+		) s
+		WHERE $6::float8 IS NULL OR s.score < $6 OR (s.score = $6 AND s.id > $7)
+		ORDER BY s.score DESC, s.id
+		LIMIT $8`, q, tsq, digits, db.LikeEscape(q), pq.Array(words), afterScore, afterID, p.Limit+1, pq.Array(r.blind(queryTokens(q))))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*SearchResult
+	for rows.Next() {
+		s := &SearchResult{}
+		var caf []byte
+		if err := rows.Scan(&s.ID, &s.FirstName, &s.LastName, &s.Email, &s.Mobile, &caf,
+			pq.Array(&s.AccountNumbers), &s.CreatedAt, &s.Score); err != nil {
+			return nil, err
+		}
+		c := &Customer{FirstName: s.FirstName, LastName: s.LastName, Email: s.Email, Mobile: s.Mobile}
+		if err := r.open(c, caf); err != nil {
+			return nil, err
+		}
+		s.FirstName, s.LastName, s.Email, s.Mobile, s.NationalID = c.FirstName, c.LastName, c.Email, c.Mobile, c.KYC["national_id"]
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
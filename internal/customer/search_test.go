@@ -0,0 +1,30 @@
+package customer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tsq, words, digits := searchTerms("Jon O'Neil 555-1234")
+	if tsq != "jon:* & o:* & neil:* & 555:* & 1234:*" {
+		t.Errorf("tsquery = %q", tsq)
+	}
+	if !reflect.DeepEqual(words, []string{"Jon", "Neil", "555", "1234"}) {
+		t.Errorf("words = %v", words)
+	}
+	if digits != "5551234" {
+		t.Errorf("digits = %q", digits)
+	}
+	if _, _, digits := searchTerms("Ann 12"); digits != "" {
+		t.Errorf("short digit run should not be used, got %q", digits)
+	}
+}
+
+func TestSearchResultMask(t *testing.T) {
+	s := &SearchResult{Email: "ann@example.com", Mobile: "+15550001111", NationalID: "AB123456", AccountNumbers: []string{"ACC987654"}}
+	s.Mask()
+	if s.Email != "a**@example.com" || s.Mobile != "********1111" || s.NationalID != "****3456" || s.AccountNumbers[0] != "*****7654" {
+		t.Errorf("masked = %+v", s)
+	}
+}
@@ -0,0 +1,29 @@
+-- transaction limits
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS product VARCHAR(50) DEFAULT 'savings';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS channel VARCHAR(20) DEFAULT 'api';
+
+CREATE TABLE IF NOT EXISTS transaction_limits (
+  id SERIAL PRIMARY KEY,
+  scope VARCHAR(20) NOT NULL,
+  scope_ref VARCHAR(100) NOT NULL DEFAULT '*',
+  txn_type VARCHAR(20) NOT NULL DEFAULT '*',
+  period VARCHAR(20) NOT NULL,
+  max_amount NUMERIC(18,2) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (scope, scope_ref, txn_type, period)
+);
+
+CREATE TABLE IF NOT EXISTS limit_increases (
+  id SERIAL PRIMARY KEY,
+  limit_id INT REFERENCES transaction_limits(id),
+  customer_id INT REFERENCES customers(id),
+  max_amount NUMERIC(18,2) NOT NULL,
+  reason TEXT,
+  status VARCHAR(20) DEFAULT 'pending',
+  valid_until TIMESTAMP WITH TIME ZONE NOT NULL,
+  decided_by INT,
+  decided_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_created ON transactions(account_id, created_at);
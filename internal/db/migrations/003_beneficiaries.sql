@@ -0,0 +1,25 @@
+-- beneficiaries (payees)
+CREATE TABLE IF NOT EXISTS beneficiaries (
+  id SERIAL PRIMARY KEY,
+  customer_id INT REFERENCES customers(id),
+  nickname VARCHAR(100) NOT NULL,
+  account_number VARCHAR(50) NOT NULL,
+  account_name VARCHAR(200),
+  name_verified BOOLEAN DEFAULT FALSE,
+  active_from TIMESTAMP WITH TIME ZONE NOT NULL,
+  deleted_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_beneficiaries_customer_account
+  ON beneficiaries(customer_id, account_number) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS beneficiary_audit (
+  id SERIAL PRIMARY KEY,
+  beneficiary_id INT REFERENCES beneficiaries(id),
+  action VARCHAR(20) NOT NULL,
+  actor_user_id INT,
+  before JSONB,
+  after JSONB,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
@@ -0,0 +1,32 @@
+-- standing orders (scheduled and recurring transfers)
+CREATE TABLE IF NOT EXISTS standing_orders (
+  id SERIAL PRIMARY KEY,
+  customer_id INT REFERENCES customers(id),
+  from_account VARCHAR(50) NOT NULL,
+  to_account VARCHAR(50) NOT NULL,
+  amount NUMERIC(18,2) NOT NULL,
+  narration TEXT,
+  frequency VARCHAR(20) NOT NULL,
+  start_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  end_at TIMESTAMP WITH TIME ZONE,
+  next_run_at TIMESTAMP WITH TIME ZONE,
+  retry_at TIMESTAMP WITH TIME ZONE,
+  attempts INT DEFAULT 0,
+  max_retries INT DEFAULT 0,
+  retry_interval_seconds INT DEFAULT 3600,
+  status VARCHAR(20) DEFAULT 'active',
+  locked_until TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_standing_orders_due ON standing_orders(status, next_run_at);
+
+CREATE TABLE IF NOT EXISTS standing_order_executions (
+  id SERIAL PRIMARY KEY,
+  order_id INT REFERENCES standing_orders(id),
+  scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+  attempt INT NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
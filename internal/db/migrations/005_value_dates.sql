@@ -0,0 +1,6 @@
+-- booking and value dates on postings
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS booking_date DATE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS value_date DATE;
+UPDATE transactions SET booking_date = created_at::date WHERE booking_date IS NULL;
+UPDATE transactions SET value_date = created_at::date WHERE value_date IS NULL;
+CREATE INDEX IF NOT EXISTS idx_transactions_account_value_date ON transactions(account_id, value_date);
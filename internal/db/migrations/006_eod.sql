@@ -0,0 +1,28 @@
+-- business dates and end-of-day processing
+CREATE TABLE IF NOT EXISTS business_dates (
+  business_date DATE PRIMARY KEY,
+  status VARCHAR(20) NOT NULL DEFAULT 'open',
+  opened_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  closed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS eod_runs (
+  id SERIAL PRIMARY KEY,
+  business_date DATE NOT NULL REFERENCES business_dates(business_date),
+  status VARCHAR(20) NOT NULL DEFAULT 'running',
+  report JSONB,
+  error TEXT,
+  started_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS eod_steps (
+  run_id INT REFERENCES eod_runs(id),
+  step VARCHAR(50) NOT NULL,
+  status VARCHAR(20) NOT NULL,
+  result JSONB,
+  error TEXT,
+  started_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (run_id, step)
+);
@@ -0,0 +1,10 @@
+-- end-of-day balance snapshots
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+  account_id INT REFERENCES accounts(id),
+  business_date DATE NOT NULL,
+  balance NUMERIC(18,2) NOT NULL,
+  taken_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (account_id, business_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_booking_date ON transactions(account_id, booking_date);
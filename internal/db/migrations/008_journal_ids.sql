@@ -0,0 +1,4 @@
+-- group the legs of a posting under one journal id (the database transaction id)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS journal_id BIGINT;
+ALTER TABLE transactions ALTER COLUMN journal_id SET DEFAULT txid_current();
+CREATE INDEX IF NOT EXISTS idx_transactions_journal ON transactions(journal_id);
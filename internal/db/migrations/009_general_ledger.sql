@@ -0,0 +1,63 @@
+-- chart of accounts, posting rules and general ledger entries
+CREATE TABLE IF NOT EXISTS gl_accounts (
+  code VARCHAR(20) PRIMARY KEY,
+  name VARCHAR(200) NOT NULL,
+  type VARCHAR(20) NOT NULL,
+  parent_code VARCHAR(20) REFERENCES gl_accounts(code),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS gl_mappings (
+  txn_type VARCHAR(50) PRIMARY KEY,
+  debit_code VARCHAR(20) NOT NULL REFERENCES gl_accounts(code),
+  credit_code VARCHAR(20) NOT NULL REFERENCES gl_accounts(code)
+);
+
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS gl_code VARCHAR(20) REFERENCES gl_accounts(code);
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS booking_date DATE;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_gl_date ON ledger_entries(gl_code, booking_date);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries(transaction_id);
+
+INSERT INTO gl_accounts(code, name, type, parent_code) VALUES
+  ('1000', 'Assets', 'asset', NULL),
+  ('1100', 'Cash and balances with central bank', 'asset', '1000'),
+  ('1900', 'Suspense', 'asset', '1000'),
+  ('2000', 'Liabilities', 'liability', NULL),
+  ('2100', 'Customer deposits', 'liability', '2000'),
+  ('2900', 'Transfer clearing', 'liability', '2000'),
+  ('3000', 'Equity', 'equity', NULL),
+  ('3100', 'Retained earnings', 'equity', '3000'),
+  ('4000', 'Income', 'income', NULL),
+  ('4100', 'Fee income', 'income', '4000'),
+  ('4200', 'Interest income', 'income', '4000'),
+  ('5000', 'Expenses', 'expense', NULL),
+  ('5100', 'Interest expense', 'expense', '5000'),
+  ('5900', 'Adjustments and write-offs', 'expense', '5000')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO gl_mappings(txn_type, debit_code, credit_code) VALUES
+  ('deposit', '1100', '2100'),
+  ('withdraw', '2100', '1100'),
+  ('transfer_debit', '2100', '2900'),
+  ('transfer_credit', '2900', '2100'),
+  ('fee', '2100', '4100'),
+  ('interest', '5100', '2100'),
+  ('adjustment_credit', '1900', '2100'),
+  ('adjustment_debit', '2100', '1900')
+ON CONFLICT (txn_type) DO NOTHING;
+
+-- post GL entries for journal rows written before the general ledger existed;
+-- each leg is skipped once a GL line for that side of the transaction exists,
+-- whatever its code, so replaying this file on every boot never duplicates
+-- journal lines
+INSERT INTO ledger_entries(transaction_id, account_id, gl_code, debit, credit, booking_date, created_at)
+SELECT t.id, t.account_id, m.debit_code, t.amount, 0, COALESCE(t.booking_date, t.created_at::date), t.created_at
+FROM transactions t JOIN gl_mappings m ON m.txn_type = t.type
+WHERE t.amount <> 0 AND NOT EXISTS (SELECT 1 FROM ledger_entries le
+                  WHERE le.transaction_id = t.id AND le.gl_code IS NOT NULL AND le.debit <> 0);
+
+INSERT INTO ledger_entries(transaction_id, account_id, gl_code, debit, credit, booking_date, created_at)
+SELECT t.id, t.account_id, m.credit_code, 0, t.amount, COALESCE(t.booking_date, t.created_at::date), t.created_at
+FROM transactions t JOIN gl_mappings m ON m.txn_type = t.type
+WHERE t.amount <> 0 AND NOT EXISTS (SELECT 1 FROM ledger_entries le
+                  WHERE le.transaction_id = t.id AND le.gl_code IS NOT NULL AND le.credit <> 0);
@@ -0,0 +1,17 @@
+-- full-text, trigram and phonetic search over customers
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS fuzzystrmatch;
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('simple', COALESCE(first_name,'') || ' ' || COALESCE(last_name,'')), 'A') ||
+  setweight(to_tsvector('simple', COALESCE(email,'')), 'B') ||
+  setweight(to_tsvector('simple', COALESCE(caf->>'national_id','') || ' ' || COALESCE(caf->>'passport_number','') || ' ' || COALESCE(caf->>'tax_id','')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_customers_search_vector ON customers USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_customers_name_trgm ON customers USING GIN ((lower(COALESCE(first_name,'') || ' ' || COALESCE(last_name,''))) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customers_email_trgm ON customers USING GIN (lower(email) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customers_mobile_trgm ON customers USING GIN ((regexp_replace(COALESCE(mobile,''), '\D', '', 'g')) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_customers_first_name_dmetaphone ON customers (dmetaphone(COALESCE(first_name,'')));
+CREATE INDEX IF NOT EXISTS idx_customers_last_name_dmetaphone ON customers (dmetaphone(COALESCE(last_name,'')));
+CREATE INDEX IF NOT EXISTS idx_accounts_number_trgm ON accounts USING GIN (account_number gin_trgm_ops);
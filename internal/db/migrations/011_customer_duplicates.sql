@@ -0,0 +1,32 @@
+-- duplicate customer detection and merge audit
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS merged_into INT REFERENCES customers(id);
+CREATE INDEX IF NOT EXISTS idx_customers_email_lower ON customers (lower(email));
+CREATE INDEX IF NOT EXISTS idx_customers_dob ON customers ((caf->>'date_of_birth'));
+
+CREATE TABLE IF NOT EXISTS customer_duplicates (
+  id SERIAL PRIMARY KEY,
+  customer_id INT NOT NULL REFERENCES customers(id),
+  candidate_id INT NOT NULL REFERENCES customers(id),
+  score NUMERIC(4,2) NOT NULL,
+  reasons TEXT[] NOT NULL DEFAULT '{}',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  decided_by INT,
+  decided_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (customer_id, candidate_id)
+);
+CREATE INDEX IF NOT EXISTS idx_customer_duplicates_status ON customer_duplicates(status, id);
+
+CREATE TABLE IF NOT EXISTS customer_merges (
+  id SERIAL PRIMARY KEY,
+  survivor_id INT NOT NULL REFERENCES customers(id),
+  merged_id INT NOT NULL REFERENCES customers(id),
+  actor_user_id INT,
+  reason TEXT,
+  merged_record JSONB NOT NULL,
+  moved JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_customer_merges_survivor ON customer_merges(survivor_id);
+CREATE INDEX IF NOT EXISTS idx_customer_merges_merged ON customer_merges(merged_id);
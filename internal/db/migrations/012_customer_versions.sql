@@ -0,0 +1,30 @@
+-- versioned customer profile updates and contact re-verification
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS mobile_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS customer_history (
+  id SERIAL PRIMARY KEY,
+  customer_id INT NOT NULL REFERENCES customers(id),
+  version INT NOT NULL,
+  first_name VARCHAR(100),
+  last_name VARCHAR(100),
+  email VARCHAR(255),
+  mobile VARCHAR(30),
+  caf JSONB,
+  changed_fields TEXT[] NOT NULL DEFAULT '{}',
+  replaced_by INT,
+  replaced_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  UNIQUE (customer_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS customer_verifications (
+  id SERIAL PRIMARY KEY,
+  customer_id INT NOT NULL REFERENCES customers(id),
+  channel VARCHAR(20) NOT NULL,
+  target VARCHAR(255) NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_customer_verifications_customer ON customer_verifications(customer_id, status);
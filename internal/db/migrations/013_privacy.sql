@@ -0,0 +1,16 @@
+-- data subject erasure requests
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS erasure_requests (
+  id SERIAL PRIMARY KEY,
+  customer_id INT NOT NULL REFERENCES customers(id),
+  status VARCHAR(20) NOT NULL DEFAULT 'requested',
+  reason TEXT,
+  requested_by INT,
+  blockers TEXT[] NOT NULL DEFAULT '{}',
+  summary JSONB,
+  decided_by INT,
+  decided_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_customer ON erasure_requests(customer_id);
@@ -0,0 +1,35 @@
+-- field-level encryption of customer personal data
+-- Sealed values are longer than the original column sizes, so the columns
+-- become TEXT. search_vector depends on them and is rebuilt to skip sealed
+-- values; this only runs once, while the columns are still VARCHAR.
+DO $$
+BEGIN
+  IF (SELECT data_type FROM information_schema.columns
+      WHERE table_name = 'customers' AND column_name = 'email') <> 'text' THEN
+    ALTER TABLE customers DROP COLUMN IF EXISTS search_vector;
+    ALTER TABLE customers ALTER COLUMN first_name TYPE TEXT, ALTER COLUMN last_name TYPE TEXT,
+      ALTER COLUMN email TYPE TEXT, ALTER COLUMN mobile TYPE TEXT;
+    ALTER TABLE customers ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+      setweight(to_tsvector('simple',
+        CASE WHEN first_name LIKE 'enc:%' THEN '' ELSE COALESCE(first_name,'') END || ' ' ||
+        CASE WHEN last_name LIKE 'enc:%' THEN '' ELSE COALESCE(last_name,'') END), 'A') ||
+      setweight(to_tsvector('simple', CASE WHEN email LIKE 'enc:%' THEN '' ELSE COALESCE(email,'') END), 'B') ||
+      setweight(to_tsvector('simple', COALESCE(caf->>'national_id','') || ' ' || COALESCE(caf->>'passport_number','') || ' ' || COALESCE(caf->>'tax_id','')), 'B')
+    ) STORED;
+    CREATE INDEX IF NOT EXISTS idx_customers_search_vector ON customers USING GIN (search_vector);
+    ALTER TABLE customer_history ALTER COLUMN first_name TYPE TEXT, ALTER COLUMN last_name TYPE TEXT,
+      ALTER COLUMN email TYPE TEXT, ALTER COLUMN mobile TYPE TEXT;
+    ALTER TABLE customer_verifications ALTER COLUMN target TYPE TEXT;
+  END IF;
+END $$;
+
+-- blind indexes for exact-match lookup and search on sealed rows, and the
+-- master key each row is sealed under, for rotation
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS email_bidx VARCHAR(64);
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS mobile_bidx VARCHAR(64);
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS search_bidx TEXT[];
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS pii_key_id VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_customers_email_bidx ON customers(email_bidx);
+CREATE INDEX IF NOT EXISTS idx_customers_mobile_bidx ON customers(mobile_bidx);
+CREATE INDEX IF NOT EXISTS idx_customers_search_bidx ON customers USING GIN (search_bidx);
+CREATE INDEX IF NOT EXISTS idx_customers_pii_key ON customers(pii_key_id);
@@ -0,0 +1,4 @@
+-- opening balances are journal entries, funded like a deposit
+INSERT INTO gl_mappings(txn_type, debit_code, credit_code) VALUES
+  ('opening_balance', '1100', '2100')
+ON CONFLICT (txn_type) DO NOTHING;
@@ -0,0 +1,24 @@
+-- daily interest accruals, credited to the account at month end
+CREATE TABLE IF NOT EXISTS interest_accruals (
+  account_id INT REFERENCES accounts(id),
+  business_date DATE NOT NULL,
+  balance NUMERIC(18,2) NOT NULL,
+  rate NUMERIC(9,4) NOT NULL,
+  days INT NOT NULL,
+  amount NUMERIC(18,6) NOT NULL,
+  capitalized_on DATE,
+  transaction_id INT REFERENCES transactions(id),
+  PRIMARY KEY (account_id, business_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_interest_accruals_pending ON interest_accruals(account_id) WHERE capitalized_on IS NULL;
+
+-- monthly maintenance fees, one charge per account and month
+CREATE TABLE IF NOT EXISTS fee_charges (
+  account_id INT REFERENCES accounts(id),
+  period CHAR(7) NOT NULL,
+  amount NUMERIC(18,2) NOT NULL,
+  transaction_id INT REFERENCES transactions(id),
+  charged_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+  PRIMARY KEY (account_id, period)
+);
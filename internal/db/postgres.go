@@ -1,19 +1,29 @@
 package db
 
 import (
+    "context"
     "database/sql"
+    "fmt"
     "io/ioutil"
+    "path/filepath"
+    "sort"
+    "strings"
     "time"
 )
 
+// WaitForDB pings db until it answers or timeout passes, returning the
+// last ping error if it never does.
 func WaitForDB(db *sql.DB, timeout time.Duration) error {
     deadline := time.Now().Add(timeout)
     for {
-        if time.Now().After(deadline) {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        err := db.PingContext(ctx)
+        cancel()
+        if err == nil {
             return nil
         }
-        if err := db.Ping(); err == nil {
-            return nil
+        if time.Now().After(deadline) {
+            return fmt.Errorf("database not reachable after %s: %w", timeout, err)
         }
         time.Sleep(1 * time.Second)
     }
@@ -27,3 +37,123 @@ func ExecMigrations(db *sql.DB, path string) error {
     _, err = db.Exec(string(content))
     return err
 }
+
+// migrationLock is the Postgres advisory lock held while migrations run, so
+// instances that boot together apply them one at a time.
+const migrationLock = 730002
+
+// ExecMigrationsDir runs the *.sql files in dir in lexical order, skipping
+// versions already recorded in schema_migrations. A version is the file name
+// without .sql; each file runs in a transaction with the row that records
+// it, so readiness checks can tell which schema is in place. The files are
+// still written to be idempotent, for databases migrated before versions
+// were recorded.
+func ExecMigrationsDir(db *sql.DB, dir string) error {
+    files, err := migrationFiles(dir)
+    if err != nil {
+        return err
+    }
+    ctx := context.Background()
+    conn, err := db.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+        return err
+    }
+    defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLock)
+
+    if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version TEXT PRIMARY KEY,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`); err != nil {
+        return err
+    }
+    applied, err := appliedVersions(ctx, conn)
+    if err != nil {
+        return err
+    }
+    for _, f := range files {
+        if applied[version(f)] {
+            continue
+        }
+        if err := applyMigration(ctx, conn, f); err != nil {
+            return fmt.Errorf("%s: %w", filepath.Base(f), err)
+        }
+    }
+    return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[string]bool, error) {
+    rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    out := map[string]bool{}
+    for rows.Next() {
+        var v string
+        if err := rows.Scan(&v); err != nil {
+            return nil, err
+        }
+        out[v] = true
+    }
+    return out, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, file string) error {
+    content, err := ioutil.ReadFile(file)
+    if err != nil {
+        return err
+    }
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations(version) VALUES ($1) ON CONFLICT DO NOTHING", version(file)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// LatestVersion returns the version of the last migration in dir.
+func LatestVersion(dir string) (string, error) {
+    files, err := migrationFiles(dir)
+    if err != nil {
+        return "", err
+    }
+    if len(files) == 0 {
+        return "", fmt.Errorf("no migrations in %s", dir)
+    }
+    return version(files[len(files)-1]), nil
+}
+
+// AppliedVersion returns the highest migration version recorded in db, or
+// "" if none has been applied.
+func AppliedVersion(ctx context.Context, db *sql.DB) (string, error) {
+    var v sql.NullString
+    err := db.QueryRowContext(ctx, "SELECT max(version) FROM schema_migrations").Scan(&v)
+    return v.String, err
+}
+
+func migrationFiles(dir string) ([]string, error) {
+    files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(files)
+    return files, nil
+}
+
+func version(file string) string { return strings.TrimSuffix(filepath.Base(file), ".sql") }
+
+// LikeEscape escapes the LIKE wildcards in v, so user text can be matched
+// literally inside a LIKE or ILIKE pattern.
+func LikeEscape(v string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(v)
+}
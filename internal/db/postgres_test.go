@@ -0,0 +1,45 @@
+package db
+
+import (
+    "database/sql/driver"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestLikeEscape(t *testing.T) {
+    if got := LikeEscape(`50%_off\`); got != `50\%\_off\\` {
+        t.Errorf("got %q", got)
+    }
+}
+
+func TestExecMigrationsDirSkipsApplied(t *testing.T) {
+    dir := t.TempDir()
+    for name, body := range map[string]string{"001_init.sql": "SELECT 'one'", "002_next.sql": "SELECT 'two'"} {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    var recorded, unlocked []driver.Value
+    conn := sqltest.Open(
+        sqltest.Reply{Match: "pg_advisory_lock"},
+        sqltest.Reply{Match: "pg_advisory_unlock", Args: &unlocked},
+        sqltest.Reply{Match: "CREATE TABLE IF NOT EXISTS schema_migrations"},
+        sqltest.Reply{Match: "SELECT version FROM schema_migrations", Cols: []string{"version"}, Rows: [][]driver.Value{{"001_init"}}},
+        sqltest.Reply{Match: "'one'", Err: errors.New("applied migration ran again")},
+        sqltest.Reply{Match: "'two'"},
+        sqltest.Reply{Match: "INSERT INTO schema_migrations", Args: &recorded},
+    )
+    if err := ExecMigrationsDir(conn, dir); err != nil {
+        t.Fatal(err)
+    }
+    if len(recorded) != 1 || recorded[0] != "002_next" {
+        t.Fatalf("recorded %v", recorded)
+    }
+    if len(unlocked) != 1 {
+        t.Fatal("migration lock not released")
+    }
+}
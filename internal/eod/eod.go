@@ -0,0 +1,282 @@
+// Package eod runs the end-of-day batch. A run freezes the current business
+// date, runs the registered jobs (accruals, fees, snapshots, ...) in order,
+// produces a report and closes the date. Every step is recorded so a failed
+// run can be restarted from the step that failed.
+package eod
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/health"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/trace"
+)
+
+// ErrRunInProgress is returned when another EOD run holds the lock.
+var ErrRunInProgress = problem.New(http.StatusConflict, "eod_in_progress", "an end-of-day run is already in progress")
+
+// Step is one job in the EOD batch. It receives the business date being
+// closed and returns a result that is stored with the step.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context, date time.Time) (interface{}, error)
+}
+
+// Built-in step names.
+const (
+	StepFreeze  = "freeze"
+	StepReport  = "report"
+	StepAdvance = "advance"
+)
+
+// Service owns the business date and runs the EOD batch.
+type Service struct {
+	repo  *Repo
+	dates *calendar.ValueDater
+	code  string
+	jobs  []Step
+	now   func() time.Time
+
+	// running tracks runs started in the background by Start
+	running sync.WaitGroup
+}
+
+// NewService creates an EOD service. Business dates advance over the
+// calendar named by code.
+func NewService(repo *Repo, dates *calendar.ValueDater, code string) *Service {
+	return &Service{repo: repo, dates: dates, code: code, now: time.Now}
+}
+
+// Register appends a job to the batch. Jobs run after the date is frozen and
+// before the report, in registration order.
+func (s *Service) Register(step Step) { s.jobs = append(s.jobs, step) }
+
+// Current returns the open business date that new postings are booked on,
+// opening today's date on first use.
+func (s *Service) Current() (time.Time, error) {
+	d, err := s.repo.OpenDate()
+	if err == sql.ErrNoRows {
+		if err := s.repo.EnsureOpen(s.dates.BookingDate(s.now())); err != nil {
+			return time.Time{}, err
+		}
+		d, err = s.repo.OpenDate()
+	}
+	return d, err
+}
+
+// CurrentTx is Current for a posting made in tx. The open date stays locked
+// until tx commits, so EOD cannot freeze it while postings booked on it are
+// still in flight.
+func (s *Service) CurrentTx(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	d, err := s.repo.OpenDateTx(ctx, tx)
+	if err == sql.ErrNoRows {
+		// no date opened yet, or EOD froze it while we waited for the lock
+		if _, err := s.Current(); err != nil {
+			return time.Time{}, err
+		}
+		d, err = s.repo.OpenDateTx(ctx, tx)
+	}
+	return d, err
+}
+
+// IsClosed reports whether d has been closed, or is being closed, by EOD.
+func (s *Service) IsClosed(d time.Time) (bool, error) {
+	st, err := s.repo.DateStatus(d)
+	if err == sql.ErrNoRows {
+		// dates before the first business date count as closed
+		cur, cerr := s.Current()
+		if cerr != nil {
+			return false, cerr
+		}
+		return d.Before(cur), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return st != DateOpen, nil
+}
+
+// Status returns the most recent run, or nil if EOD has never run.
+func (s *Service) Status() (*Run, error) {
+	run, err := s.repo.LatestRun()
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// Start begins a new run for the current business date, or resumes the last
+// run if it did not complete, and executes it in the background.
+func (s *Service) Start(ctx context.Context) (*Run, error) {
+	release, ok, err := s.repo.TryLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRunInProgress
+	}
+	run, err := s.prepare()
+	if err != nil {
+		release()
+		return nil, err
+	}
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer release()
+		s.execute(logging.Detach(ctx), run)
+	}()
+	return run, nil
+}
+
+// Wait blocks until every run started by Start has finished.
+func (s *Service) Wait() { s.running.Wait() }
+
+// RunNow runs or resumes EOD synchronously and returns the finished run.
+func (s *Service) RunNow(ctx context.Context) (*Run, error) {
+	release, ok, err := s.repo.TryLock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRunInProgress
+	}
+	defer release()
+	run, err := s.prepare()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.execute(ctx, run); err != nil {
+		return nil, err
+	}
+	return s.repo.LatestRun()
+}
+
+func (s *Service) prepare() (*Run, error) {
+	last, err := s.repo.LatestRun()
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if last != nil && last.Status != StatusCompleted {
+		logrus.Infof("eod: resuming run %d for %s", last.ID, last.BusinessDate)
+		return last, s.repo.MarkRunning(last.ID)
+	}
+	d, err := s.Current()
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.CreateRun(d)
+}
+
+// steps returns the full ordered batch for closing date.
+func (s *Service) steps() []Step {
+	out := []Step{{Name: StepFreeze, Run: s.freeze}}
+	out = append(out, s.jobs...)
+	return append(out, Step{Name: StepReport, Run: s.report}, Step{Name: StepAdvance, Run: s.advance})
+}
+
+func (s *Service) execute(ctx context.Context, run *Run) (err error) {
+	date, err := time.Parse(calendar.DateLayout, run.BusinessDate)
+	if err != nil {
+		return err
+	}
+	ctx, span := trace.Start(ctx, "eod.run", trace.KindInternal,
+		trace.Int("eod.run_id", run.ID), trace.String("eod.business_date", run.BusinessDate))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	logging.AddFields(ctx, logrus.Fields{"eod_run": run.ID})
+	done := map[string]bool{}
+	for _, st := range run.Steps {
+		if st.Status == StatusCompleted {
+			done[st.Step] = true
+		}
+	}
+	var report interface{}
+	for _, step := range s.steps() {
+		if done[step.Name] {
+			continue
+		}
+		if err := s.repo.StartStep(run.ID, step.Name); err != nil {
+			return err
+		}
+		logging.From(ctx).Infof("eod %s: %s", run.BusinessDate, step.Name)
+		stepCtx, stepSpan := trace.Start(ctx, "eod.step "+step.Name, trace.KindInternal)
+		result, stepErr := step.Run(stepCtx, date)
+		stepSpan.RecordError(stepErr)
+		stepSpan.End()
+		if err := s.repo.FinishStep(run.ID, step.Name, result, stepErr); err != nil {
+			return err
+		}
+		if stepErr != nil {
+			stepErr = fmt.Errorf("step %s: %w", step.Name, stepErr)
+			logging.From(ctx).Errorf("eod %s: %v", run.BusinessDate, stepErr)
+			return s.repo.FinishRun(run.ID, nil, stepErr)
+		}
+		if step.Name == StepReport {
+			report = result
+		}
+	}
+	logging.From(ctx).Infof("eod %s: completed", run.BusinessDate)
+	return s.repo.FinishRun(run.ID, report, nil)
+}
+
+func (s *Service) freeze(ctx context.Context, date time.Time) (interface{}, error) {
+	next := s.dates.Calendar(s.code).NextBusinessDay(date)
+	if err := s.repo.Freeze(date, next); err != nil {
+		return nil, err
+	}
+	return map[string]string{"next_business_date": next.Format(calendar.DateLayout)}, nil
+}
+
+func (s *Service) report(ctx context.Context, date time.Time) (interface{}, error) {
+	return s.repo.DailyReport(date)
+}
+
+func (s *Service) advance(ctx context.Context, date time.Time) (interface{}, error) {
+	if err := s.repo.Close(date); err != nil {
+		return nil, err
+	}
+	cur, err := s.Current()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"closed": date.Format(calendar.DateLayout), "business_date": cur.Format(calendar.DateLayout)}, nil
+}
+
+// StartScheduler runs EOD every day at the given time of day in the bank's
+// time zone until ctx is cancelled. A run that has started is allowed to
+// finish. The outcome of each run is reported to hb.
+func StartScheduler(ctx context.Context, s *Service, at time.Duration, hb *health.Heartbeat) {
+	for {
+		now := s.now().In(s.dates.Location())
+		next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(at)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		runCtx := logging.WithRequestID(context.WithoutCancel(ctx), logging.NewRequestID())
+		if _, err := s.RunNow(runCtx); err != nil {
+			logrus.Errorf("eod: scheduled run: %v", err)
+			hb.Fail(fmt.Errorf("scheduled run: %w", err))
+		} else {
+			hb.Beat()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package eod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+func TestStepsOrder(t *testing.T) {
+	s := NewService(nil, nil, "USD")
+	nothing := func(context.Context, time.Time) (interface{}, error) { return nil, nil }
+	s.Register(Step{Name: "accruals", Run: nothing})
+	s.Register(Step{Name: "fees", Run: nothing})
+	s.Register(Step{Name: "balance_snapshots", Run: nothing})
+	want := []string{StepFreeze, "accruals", "fees", "balance_snapshots", StepReport, StepAdvance}
+	got := s.steps()
+	if len(got) != len(want) {
+		t.Fatalf("got %d steps, want %d", len(got), len(want))
+	}
+	for i, st := range got {
+		if st.Name != want[i] {
+			t.Errorf("step %d = %s, want %s", i, st.Name, want[i])
+		}
+	}
+}
+
+func TestSchedulerStopsOnCancel(t *testing.T) {
+	s := NewService(nil, calendar.NewValueDater(nil, nil, time.UTC), "USD")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		StartScheduler(ctx, s, 23*time.Hour, nil)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler still waiting after its context was cancelled")
+	}
+	// nothing was started in the background
+	s.Wait()
+}
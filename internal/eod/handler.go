@@ -0,0 +1,51 @@
+package eod
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Handler manages HTTP requests for end-of-day processing.
+type Handler struct{ svc *Service }
+
+// NewHandler creates an EOD handler.
+func NewHandler(s *Service) *Handler { return &Handler{svc: s} }
+
+// StartRun handles POST /v1/eod/run. It starts EOD for the current business
+// date, or restarts the last run from its failed step. Admin only.
+func (h *Handler) StartRun(w http.ResponseWriter, r *http.Request) {
+	run, err := h.svc.Start(r.Context())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetStatus handles GET /v1/eod/status and returns the latest run.
+func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	run, err := h.svc.Status()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if run == nil {
+		problem.Write(w, r, problem.NotFound("no end-of-day run yet"))
+		return
+	}
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetBusinessDate handles GET /v1/eod/business-date.
+func (h *Handler) GetBusinessDate(w http.ResponseWriter, r *http.Request) {
+	d, err := h.svc.Current()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"business_date": d.Format(calendar.DateLayout)})
+}
@@ -0,0 +1,263 @@
+package eod
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+// Repo provides database methods for business dates and EOD runs.
+type Repo struct{ db *sql.DB }
+
+// NewRepo initializes and returns a new EOD repository instance.
+func NewRepo(db *sql.DB) *Repo { return &Repo{db: db} }
+
+// Business date statuses.
+const (
+	DateOpen    = "open"
+	DateClosing = "closing"
+	DateClosed  = "closed"
+)
+
+// Run and step statuses.
+const (
+	StatusRunning   = "running"
+	StatusFailed    = "failed"
+	StatusCompleted = "completed"
+)
+
+// lockKey is the Postgres advisory lock that serializes EOD runs across
+// instances.
+const lockKey = 730001
+
+// Run is one end-of-day batch for a business date.
+type Run struct {
+	ID           int             `json:"id"`
+	BusinessDate string          `json:"business_date"`
+	Status       string          `json:"status"`
+	Report       json.RawMessage `json:"report,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+	Steps        []*StepRun      `json:"steps"`
+}
+
+// StepRun records the outcome of one step of a run.
+type StepRun struct {
+	Step       string          `json:"step"`
+	Status     string          `json:"status"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// OpenDate returns the latest open business date.
+func (r *Repo) OpenDate() (time.Time, error) {
+	var d time.Time
+	err := r.db.QueryRow("SELECT business_date FROM business_dates WHERE status='open' ORDER BY business_date DESC LIMIT 1").Scan(&d)
+	return d, err
+}
+
+// OpenDateTx is OpenDate read inside tx with the row locked FOR SHARE, so
+// Freeze waits until tx ends before it can close the date.
+func (r *Repo) OpenDateTx(ctx context.Context, tx *sql.Tx) (time.Time, error) {
+	var d time.Time
+	err := tx.QueryRowContext(ctx, "SELECT business_date FROM business_dates WHERE status='open' ORDER BY business_date DESC LIMIT 1 FOR SHARE").Scan(&d)
+	return d, err
+}
+
+// EnsureOpen opens d as a business date if it does not exist yet.
+func (r *Repo) EnsureOpen(d time.Time) error {
+	_, err := r.db.Exec("INSERT INTO business_dates(business_date, status) VALUES ($1, 'open') ON CONFLICT DO NOTHING", d)
+	return err
+}
+
+// DateStatus returns the status of a business date, or sql.ErrNoRows if the
+// date was never opened.
+func (r *Repo) DateStatus(d time.Time) (string, error) {
+	var s string
+	err := r.db.QueryRow("SELECT status FROM business_dates WHERE business_date=$1", d).Scan(&s)
+	return s, err
+}
+
+// Freeze marks d as closing and opens next, so postings made while EOD runs
+// are booked on the next business date.
+func (r *Repo) Freeze(d, next time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE business_dates SET status='closing' WHERE business_date=$1 AND status='open'", d); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO business_dates(business_date, status) VALUES ($1, 'open') ON CONFLICT DO NOTHING", next); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close marks d as closed.
+func (r *Repo) Close(d time.Time) error {
+	_, err := r.db.Exec("UPDATE business_dates SET status='closed', closed_at=now() WHERE business_date=$1", d)
+	return err
+}
+
+// TryLock takes the EOD advisory lock on a dedicated connection. The
+// returned function releases it; ok is false if another run holds it.
+func (r *Repo) TryLock(ctx context.Context) (release func(), ok bool, err error) {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		conn.Close()
+	}, true, nil
+}
+
+const runCols = "id, to_char(business_date,'YYYY-MM-DD'), status, report, COALESCE(error,''), started_at, finished_at"
+
+func scanRun(s interface{ Scan(...interface{}) error }) (*Run, error) {
+	run := &Run{}
+	var report []byte
+	var finished sql.NullTime
+	if err := s.Scan(&run.ID, &run.BusinessDate, &run.Status, &report, &run.Error, &run.StartedAt, &finished); err != nil {
+		return nil, err
+	}
+	if report != nil {
+		run.Report = report
+	}
+	if finished.Valid {
+		run.FinishedAt = &finished.Time
+	}
+	return run, nil
+}
+
+// CreateRun starts a new run for d.
+func (r *Repo) CreateRun(d time.Time) (*Run, error) {
+	return scanRun(r.db.QueryRow("INSERT INTO eod_runs(business_date, status) VALUES ($1, 'running') RETURNING "+runCols, d))
+}
+
+// LatestRun returns the most recent run with its steps.
+func (r *Repo) LatestRun() (*Run, error) {
+	run, err := scanRun(r.db.QueryRow("SELECT " + runCols + " FROM eod_runs ORDER BY id DESC LIMIT 1"))
+	if err != nil {
+		return nil, err
+	}
+	run.Steps, err = r.Steps(run.ID)
+	return run, err
+}
+
+// Steps returns the recorded steps of a run in execution order.
+func (r *Repo) Steps(runID int) ([]*StepRun, error) {
+	rows, err := r.db.Query("SELECT step, status, result, COALESCE(error,''), started_at, finished_at FROM eod_steps WHERE run_id=$1 ORDER BY started_at", runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*StepRun
+	for rows.Next() {
+		s := &StepRun{}
+		var result []byte
+		var finished sql.NullTime
+		if err := rows.Scan(&s.Step, &s.Status, &result, &s.Error, &s.StartedAt, &finished); err != nil {
+			return nil, err
+		}
+		if result != nil {
+			s.Result = result
+		}
+		if finished.Valid {
+			s.FinishedAt = &finished.Time
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// StartStep records that a step has started, resetting any earlier failure.
+func (r *Repo) StartStep(runID int, step string) error {
+	_, err := r.db.Exec(`INSERT INTO eod_steps(run_id, step, status) VALUES ($1, $2, 'running')
+		ON CONFLICT (run_id, step) DO UPDATE SET status='running', error=NULL, result=NULL, started_at=now(), finished_at=NULL`, runID, step)
+	return err
+}
+
+// FinishStep records the outcome of a step.
+func (r *Repo) FinishStep(runID int, step string, result interface{}, stepErr error) error {
+	status, msg := StatusCompleted, ""
+	if stepErr != nil {
+		status, msg = StatusFailed, stepErr.Error()
+	}
+	b, _ := json.Marshal(result)
+	_, err := r.db.Exec("UPDATE eod_steps SET status=$1, result=$2, error=NULLIF($3,''), finished_at=now() WHERE run_id=$4 AND step=$5",
+		status, string(b), msg, runID, step)
+	return err
+}
+
+// FinishRun records the outcome of a run.
+func (r *Repo) FinishRun(runID int, report interface{}, runErr error) error {
+	status, msg := StatusCompleted, ""
+	if runErr != nil {
+		status, msg = StatusFailed, runErr.Error()
+	}
+	var b interface{}
+	if report != nil {
+		j, _ := json.Marshal(report)
+		b = string(j)
+	}
+	_, err := r.db.Exec("UPDATE eod_runs SET status=$1, report=COALESCE($2, report), error=NULLIF($3,''), finished_at=now() WHERE id=$4",
+		status, b, msg, runID)
+	return err
+}
+
+// MarkRunning flags a failed run as running again before it is resumed.
+func (r *Repo) MarkRunning(runID int) error {
+	_, err := r.db.Exec("UPDATE eod_runs SET status='running', error=NULL, finished_at=NULL WHERE id=$1", runID)
+	return err
+}
+
+// Report summarizes the postings booked on a business date.
+type Report struct {
+	BusinessDate  string          `json:"business_date"`
+	Postings      []*PostingTotal `json:"postings"`
+	Accounts      int             `json:"accounts"`
+	TotalBalances float64         `json:"total_balances"`
+}
+
+// PostingTotal is the count and sum of one transaction type.
+type PostingTotal struct {
+	Type   string  `json:"type"`
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// DailyReport builds the EOD report for d.
+func (r *Repo) DailyReport(d time.Time) (*Report, error) {
+	rep := &Report{BusinessDate: d.Format(calendar.DateLayout)}
+	rows, err := r.db.Query("SELECT COALESCE(type,''), COUNT(*), COALESCE(SUM(amount),0) FROM transactions WHERE booking_date=$1 GROUP BY type ORDER BY type", d)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &PostingTotal{}
+		if err := rows.Scan(&p.Type, &p.Count, &p.Amount); err != nil {
+			return nil, err
+		}
+		rep.Postings = append(rep.Postings, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	err = r.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(balance),0) FROM accounts").Scan(&rep.Accounts, &rep.TotalBalances)
+	return rep, err
+}
@@ -0,0 +1,152 @@
+// Package gl maintains the bank's own general ledger: a hierarchical chart of
+// accounts, rules mapping customer transaction types to double-entry GL
+// postings, and the trial balance, balance sheet and income statement built
+// from those postings.
+package gl
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+)
+
+// Account types.
+const (
+	TypeAsset     = "asset"
+	TypeLiability = "liability"
+	TypeEquity    = "equity"
+	TypeIncome    = "income"
+	TypeExpense   = "expense"
+)
+
+// ValidType reports whether t is a known account type.
+func ValidType(t string) bool {
+	switch t {
+	case TypeAsset, TypeLiability, TypeEquity, TypeIncome, TypeExpense:
+		return true
+	}
+	return false
+}
+
+// debitNormal reports whether accounts of type t carry a debit balance.
+func debitNormal(t string) bool { return t == TypeAsset || t == TypeExpense }
+
+// Account is a GL account in the chart of accounts.
+type Account struct {
+	Code       string `json:"code" validate:"required,max=20"`
+	Name       string `json:"name" validate:"required,max=200"`
+	Type       string `json:"type" validate:"required,oneof=asset liability equity income expense"`
+	ParentCode string `json:"parent_code,omitempty" validate:"max=20"`
+}
+
+// Mapping turns a customer transaction type into a GL debit and credit.
+type Mapping struct {
+	TxnType    string `json:"txn_type" validate:"required,max=50"`
+	DebitCode  string `json:"debit_code" validate:"required,max=20"`
+	CreditCode string `json:"credit_code" validate:"required,max=20"`
+}
+
+// Totals are the debit and credit sums posted to one GL account.
+type Totals struct {
+	Debit  float64
+	Credit float64
+}
+
+// Node is a GL account with its own and its descendants' totals rolled up.
+// Balance is signed by the account's normal side, so a positive balance on a
+// liability is a credit balance.
+type Node struct {
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Debit    float64 `json:"debit"`
+	Credit   float64 `json:"credit"`
+	Balance  float64 `json:"balance"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Tree builds the chart of accounts as a forest of nodes, rolling each
+// account's totals up into its ancestors. Roots are ordered by code.
+func Tree(accounts []*Account, totals map[string]Totals) []*Node {
+	nodes := map[string]*Node{}
+	for _, a := range accounts {
+		t := totals[a.Code]
+		nodes[a.Code] = &Node{Code: a.Code, Name: a.Name, Type: a.Type, Debit: t.Debit, Credit: t.Credit}
+	}
+	var roots []*Node
+	for _, a := range accounts {
+		n := nodes[a.Code]
+		if p, ok := nodes[a.ParentCode]; ok && a.ParentCode != "" {
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	for _, r := range roots {
+		rollUp(r)
+	}
+	sortNodes(roots)
+	return roots
+}
+
+func rollUp(n *Node) {
+	for _, c := range n.Children {
+		rollUp(c)
+		n.Debit += c.Debit
+		n.Credit += c.Credit
+	}
+	n.Debit, n.Credit = round(n.Debit), round(n.Credit)
+	if debitNormal(n.Type) {
+		n.Balance = round(n.Debit - n.Credit)
+	} else {
+		n.Balance = round(n.Credit - n.Debit)
+	}
+}
+
+func sortNodes(ns []*Node) {
+	sort.Slice(ns, func(i, j int) bool { return ns[i].Code < ns[j].Code })
+	for _, n := range ns {
+		sortNodes(n.Children)
+	}
+}
+
+// sumType returns the total balance of the root nodes of type t.
+func sumType(roots []*Node, t string) float64 {
+	var s float64
+	for _, r := range roots {
+		if r.Type == t {
+			s += r.Balance
+		}
+	}
+	return round(s)
+}
+
+// filterTypes returns the root nodes whose type is one of types.
+func filterTypes(roots []*Node, types ...string) []*Node {
+	var out []*Node
+	for _, r := range roots {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+			}
+		}
+	}
+	return out
+}
+
+func round(f float64) float64 { return math.Round(f*100) / 100 }
+
+// PostTx writes the GL entries for a customer journal row inside tx using
+// the mapping for its type. Types without a mapping are left off the GL and
+// show up as unmapped in the trial balance.
+func PostTx(ctx context.Context, tx *sql.Tx, transactionID, accountID int, txnType string, amount float64, bookingDate time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO ledger_entries(transaction_id, account_id, gl_code, debit, credit, booking_date)
+		SELECT $1, $2, debit_code, $3, 0, $4 FROM gl_mappings WHERE txn_type = $5
+		UNION ALL
+		SELECT $1, $2, credit_code, 0, $3, $4 FROM gl_mappings WHERE txn_type = $5`,
+		transactionID, accountID, amount, bookingDate, txnType)
+	return err
+}
@@ -0,0 +1,35 @@
+package gl
+
+import "testing"
+
+func TestTreeRollUp(t *testing.T) {
+	accounts := []*Account{
+		{Code: "2000", Name: "Liabilities", Type: TypeLiability},
+		{Code: "2100", Name: "Deposits", Type: TypeLiability, ParentCode: "2000"},
+		{Code: "1000", Name: "Assets", Type: TypeAsset},
+		{Code: "1100", Name: "Cash", Type: TypeAsset, ParentCode: "1000"},
+	}
+	totals := map[string]Totals{
+		"1100": {Debit: 150, Credit: 30},
+		"2100": {Debit: 30, Credit: 150},
+	}
+	roots := Tree(accounts, totals)
+	if len(roots) != 2 || roots[0].Code != "1000" || roots[1].Code != "2000" {
+		t.Fatalf("unexpected roots: %+v", roots)
+	}
+	if roots[0].Balance != 120 || roots[0].Debit != 150 {
+		t.Errorf("assets = %+v, want debit 150 balance 120", roots[0])
+	}
+	if roots[1].Balance != 120 {
+		t.Errorf("liabilities balance = %v, want 120", roots[1].Balance)
+	}
+	if got := sumType(roots, TypeAsset); got != 120 {
+		t.Errorf("sumType(asset) = %v, want 120", got)
+	}
+}
+
+func TestValidType(t *testing.T) {
+	if !ValidType(TypeExpense) || ValidType("cash") {
+		t.Error("ValidType mismatch")
+	}
+}
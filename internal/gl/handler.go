@@ -0,0 +1,140 @@
+package gl
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for the general ledger.
+type Handler struct{ repo *Repo }
+
+// NewHandler creates a GL handler.
+func NewHandler(r *Repo) *Handler { return &Handler{repo: r} }
+
+// ListAccounts handles GET /v1/gl/accounts and returns the chart of
+// accounts as a tree.
+func (h *Handler) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.repo.ListAccounts()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(Tree(accounts, nil))
+}
+
+// CreateAccount handles POST /v1/gl/accounts. Admin only.
+func (h *Handler) CreateAccount(w http.ResponseWriter, r *http.Request) {
+	var a Account
+	if err := request.Decode(w, r, &a); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := h.repo.CreateAccount(&a); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// ListMappings handles GET /v1/gl/mappings.
+func (h *Handler) ListMappings(w http.ResponseWriter, r *http.Request) {
+	list, err := h.repo.ListMappings()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// SetMapping handles POST /v1/gl/mappings. Admin only.
+func (h *Handler) SetMapping(w http.ResponseWriter, r *http.Request) {
+	var m Mapping
+	if err := request.Decode(w, r, &m); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := h.repo.UpsertMapping(&m); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(m)
+}
+
+// TrialBalance handles GET /v1/gl/trial-balance?from=&to=.
+func (h *Handler) TrialBalance(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := dateRange(w, r)
+	if !ok {
+		return
+	}
+	tb, err := h.repo.TrialBalance(from, to)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(tb)
+}
+
+// BalanceSheet handles GET /v1/gl/balance-sheet?as_of=.
+func (h *Handler) BalanceSheet(w http.ResponseWriter, r *http.Request) {
+	asOf := time.Now().UTC()
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		d, err := time.Parse(calendar.DateLayout, v)
+		if err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("as_of", "must be YYYY-MM-DD")))
+			return
+		}
+		asOf = d
+	}
+	bs, err := h.repo.BalanceSheet(asOf)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(bs)
+}
+
+// IncomeStatement handles GET /v1/gl/income-statement?from=&to=.
+func (h *Handler) IncomeStatement(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := dateRange(w, r)
+	if !ok {
+		return
+	}
+	is, err := h.repo.IncomeStatement(from, to)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(is)
+}
+
+// dateRange parses from/to query dates, defaulting to the month to date.
+func dateRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	q := r.URL.Query()
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("from", "must be YYYY-MM-DD")))
+			return from, to, false
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("to", "must be YYYY-MM-DD")))
+			return from, to, false
+		}
+	}
+	if to.Before(from) {
+		problem.Write(w, r, problem.Invalid(problem.Field("to", "must not be before from")))
+		return from, to, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,160 @@
+package gl
+
+import (
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+// UnmappedType summarizes postings of a transaction type that have no GL lines.
+type UnmappedType struct {
+	TxnType string  `json:"txn_type"`
+	Count   int     `json:"count"`
+	Amount  float64 `json:"amount"`
+}
+
+// TrialBalanceLine is one account in the trial balance. Opening and Closing
+// are signed by the account's normal side.
+type TrialBalanceLine struct {
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Level   int     `json:"level"`
+	Opening float64 `json:"opening"`
+	Debit   float64 `json:"debit"`
+	Credit  float64 `json:"credit"`
+	Closing float64 `json:"closing"`
+}
+
+// TrialBalance lists every GL account's movements over a date range.
+type TrialBalance struct {
+	From        string              `json:"from"`
+	To          string              `json:"to"`
+	Lines       []*TrialBalanceLine `json:"lines"`
+	TotalDebit  float64             `json:"total_debit"`
+	TotalCredit float64             `json:"total_credit"`
+	Balanced    bool                `json:"balanced"`
+	Unmapped    []*UnmappedType     `json:"unmapped,omitempty"`
+}
+
+// BalanceSheet reports assets, liabilities and equity at a date.
+// CurrentEarnings is income less expenses not yet closed to equity.
+type BalanceSheet struct {
+	AsOf                      string  `json:"as_of"`
+	Assets                    []*Node `json:"assets"`
+	Liabilities               []*Node `json:"liabilities"`
+	Equity                    []*Node `json:"equity"`
+	CurrentEarnings           float64 `json:"current_earnings"`
+	TotalAssets               float64 `json:"total_assets"`
+	TotalLiabilitiesAndEquity float64 `json:"total_liabilities_and_equity"`
+	Balanced                  bool    `json:"balanced"`
+}
+
+// IncomeStatement reports income and expenses over a date range.
+type IncomeStatement struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Income        []*Node `json:"income"`
+	Expenses      []*Node `json:"expenses"`
+	TotalIncome   float64 `json:"total_income"`
+	TotalExpenses float64 `json:"total_expenses"`
+	NetIncome     float64 `json:"net_income"`
+}
+
+// TrialBalance builds the trial balance for booking dates in [from, to].
+func (r *Repo) TrialBalance(from, to time.Time) (*TrialBalance, error) {
+	accounts, err := r.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	opening, err := r.Totals(time.Time{}, from.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	period, err := r.Totals(from, to)
+	if err != nil {
+		return nil, err
+	}
+	unmapped, err := r.Unmapped(from, to)
+	if err != nil {
+		return nil, err
+	}
+	tb := &TrialBalance{From: from.Format(calendar.DateLayout), To: to.Format(calendar.DateLayout), Unmapped: unmapped}
+	openTree := index(Tree(accounts, opening))
+	for _, root := range Tree(accounts, period) {
+		tb.TotalDebit += root.Debit
+		tb.TotalCredit += root.Credit
+		walk(root, 0, func(n *Node, level int) {
+			open := openTree[n.Code].Balance
+			tb.Lines = append(tb.Lines, &TrialBalanceLine{
+				Code: n.Code, Name: n.Name, Type: n.Type, Level: level,
+				Opening: open, Debit: n.Debit, Credit: n.Credit, Closing: round(open + n.Balance),
+			})
+		})
+	}
+	tb.TotalDebit, tb.TotalCredit = round(tb.TotalDebit), round(tb.TotalCredit)
+	tb.Balanced = tb.TotalDebit == tb.TotalCredit
+	return tb, nil
+}
+
+// BalanceSheet builds the balance sheet from all postings up to asOf.
+func (r *Repo) BalanceSheet(asOf time.Time) (*BalanceSheet, error) {
+	accounts, err := r.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	totals, err := r.Totals(time.Time{}, asOf)
+	if err != nil {
+		return nil, err
+	}
+	roots := Tree(accounts, totals)
+	bs := &BalanceSheet{
+		AsOf:            asOf.Format(calendar.DateLayout),
+		Assets:          filterTypes(roots, TypeAsset),
+		Liabilities:     filterTypes(roots, TypeLiability),
+		Equity:          filterTypes(roots, TypeEquity),
+		CurrentEarnings: round(sumType(roots, TypeIncome) - sumType(roots, TypeExpense)),
+		TotalAssets:     sumType(roots, TypeAsset),
+	}
+	bs.TotalLiabilitiesAndEquity = round(sumType(roots, TypeLiability) + sumType(roots, TypeEquity) + bs.CurrentEarnings)
+	bs.Balanced = bs.TotalAssets == bs.TotalLiabilitiesAndEquity
+	return bs, nil
+}
+
+// IncomeStatement builds the income statement for booking dates in [from, to].
+func (r *Repo) IncomeStatement(from, to time.Time) (*IncomeStatement, error) {
+	accounts, err := r.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+	totals, err := r.Totals(from, to)
+	if err != nil {
+		return nil, err
+	}
+	roots := Tree(accounts, totals)
+	is := &IncomeStatement{
+		From:          from.Format(calendar.DateLayout),
+		To:            to.Format(calendar.DateLayout),
+		Income:        filterTypes(roots, TypeIncome),
+		Expenses:      filterTypes(roots, TypeExpense),
+		TotalIncome:   sumType(roots, TypeIncome),
+		TotalExpenses: sumType(roots, TypeExpense),
+	}
+	is.NetIncome = round(is.TotalIncome - is.TotalExpenses)
+	return is, nil
+}
+
+func walk(n *Node, level int, fn func(*Node, int)) {
+	fn(n, level)
+	for _, c := range n.Children {
+		walk(c, level+1, fn)
+	}
+}
+
+func index(roots []*Node) map[string]*Node {
+	out := map[string]*Node{}
+	for _, r := range roots {
+		walk(r, 0, func(n *Node, _ int) { out[n.Code] = n })
+	}
+	return out
+}
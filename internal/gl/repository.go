@@ -0,0 +1,116 @@
+package gl
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Repo provides database methods for the chart of accounts and GL postings.
+type Repo struct{ db *sql.DB }
+
+// NewRepo initializes and returns a new GL repository instance.
+func NewRepo(db *sql.DB) *Repo { return &Repo{db: db} }
+
+// ListAccounts returns the chart of accounts ordered by code.
+func (r *Repo) ListAccounts() ([]*Account, error) {
+	rows, err := r.db.Query("SELECT code, name, type, COALESCE(parent_code,'') FROM gl_accounts ORDER BY code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Account
+	for rows.Next() {
+		a := &Account{}
+		if err := rows.Scan(&a.Code, &a.Name, &a.Type, &a.ParentCode); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// CreateAccount adds a GL account to the chart.
+func (r *Repo) CreateAccount(a *Account) error {
+	var parent interface{}
+	if a.ParentCode != "" {
+		parent = a.ParentCode
+	}
+	_, err := r.db.Exec("INSERT INTO gl_accounts(code, name, type, parent_code) VALUES ($1, $2, $3, $4)", a.Code, a.Name, a.Type, parent)
+	return err
+}
+
+// ListMappings returns the posting rules.
+func (r *Repo) ListMappings() ([]*Mapping, error) {
+	rows, err := r.db.Query("SELECT txn_type, debit_code, credit_code FROM gl_mappings ORDER BY txn_type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Mapping
+	for rows.Next() {
+		m := &Mapping{}
+		if err := rows.Scan(&m.TxnType, &m.DebitCode, &m.CreditCode); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// UpsertMapping creates or replaces the posting rule for a transaction type.
+// It only affects postings made after the change.
+func (r *Repo) UpsertMapping(m *Mapping) error {
+	_, err := r.db.Exec(`INSERT INTO gl_mappings(txn_type, debit_code, credit_code) VALUES ($1, $2, $3)
+		ON CONFLICT (txn_type) DO UPDATE SET debit_code = EXCLUDED.debit_code, credit_code = EXCLUDED.credit_code`,
+		m.TxnType, m.DebitCode, m.CreditCode)
+	return err
+}
+
+// Totals sums GL postings per account for booking dates in [from, to].
+// A zero from means from the beginning of the ledger.
+func (r *Repo) Totals(from, to time.Time) (map[string]Totals, error) {
+	var fromArg interface{}
+	if !from.IsZero() {
+		fromArg = from
+	}
+	rows, err := r.db.Query(`SELECT gl_code, COALESCE(SUM(debit),0), COALESCE(SUM(credit),0) FROM ledger_entries
+		WHERE gl_code IS NOT NULL AND ($1::date IS NULL OR booking_date >= $1) AND booking_date <= $2
+		GROUP BY gl_code`, fromArg, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]Totals{}
+	for rows.Next() {
+		var code string
+		var t Totals
+		if err := rows.Scan(&code, &t.Debit, &t.Credit); err != nil {
+			return nil, err
+		}
+		out[code] = t
+	}
+	return out, rows.Err()
+}
+
+// Unmapped summarizes customer postings in [from, to] that have no GL lines,
+// by transaction type. It looks at the ledger rather than today's mappings,
+// so a posting made before its type was mapped still shows up.
+func (r *Repo) Unmapped(from, to time.Time) ([]*UnmappedType, error) {
+	rows, err := r.db.Query(`SELECT COALESCE(type,''), COUNT(*), COALESCE(SUM(amount),0) FROM transactions t
+		WHERE booking_date BETWEEN $1 AND $2 AND amount <> 0
+		  AND NOT EXISTS (SELECT 1 FROM ledger_entries le WHERE le.transaction_id = t.id AND le.gl_code IS NOT NULL)
+		GROUP BY type ORDER BY type`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*UnmappedType
+	for rows.Next() {
+		u := &UnmappedType{}
+		if err := rows.Scan(&u.TxnType, &u.Count, &u.Amount); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,180 @@
+// Package health serves the liveness and readiness probes. Liveness only
+// says the process is serving HTTP. Readiness runs a check per dependency,
+// Postgres, Redis, the schema version and the background workers, and
+// reports each one, so an orchestrator routes traffic only to instances
+// that can serve it and an operator can see which dependency is failing.
+//
+// A failing critical check makes the instance down (503); a failing
+// non-critical one leaves it degraded, still ready but reported as such.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of a check and of the instance as a whole.
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Phases of the process. Only a running instance is ready.
+const (
+	PhaseStarting = "starting"
+	PhaseRunning  = "running"
+	PhaseStopping = "stopping"
+)
+
+// DefaultTimeout bounds each check.
+const DefaultTimeout = 2 * time.Second
+
+type check struct {
+	name     string
+	critical bool
+	fn       func(ctx context.Context) error
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the readiness of the instance.
+type Report struct {
+	Status string            `json:"status"`
+	Phase  string            `json:"phase"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Checker holds the readiness checks and the process phase.
+type Checker struct {
+	mu      sync.Mutex
+	checks  []check
+	phase   atomic.Value
+	timeout time.Duration
+}
+
+// NewChecker creates a checker in the starting phase.
+func NewChecker() *Checker {
+	c := &Checker{timeout: DefaultTimeout}
+	c.phase.Store(PhaseStarting)
+	return c
+}
+
+// Add registers a check. A critical check failing takes the instance out
+// of service; a non-critical one marks it degraded.
+func (c *Checker) Add(name string, critical bool, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+	c.mu.Unlock()
+}
+
+// SetPhase moves the process to phase p.
+func (c *Checker) SetPhase(p string) { c.phase.Store(p) }
+
+// Phase returns the current phase.
+func (c *Checker) Phase() string { return c.phase.Load().(string) }
+
+// Run runs every check concurrently, each bounded by DefaultTimeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.Unlock()
+
+	rep := Report{Status: StatusUp, Phase: c.Phase(), Checks: make(map[string]Result, len(checks))}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func(i int, ch check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, ch)
+		}(i, ch)
+	}
+	wg.Wait()
+	for i, ch := range checks {
+		r := results[i]
+		rep.Checks[ch.name] = r
+		switch {
+		case r.Status == StatusUp:
+		case ch.critical:
+			rep.Status = StatusDown
+		case rep.Status == StatusUp:
+			rep.Status = StatusDegraded
+		}
+	}
+	if rep.Phase != PhaseRunning {
+		rep.Status = StatusDown
+	}
+	return rep
+}
+
+func (c *Checker) run(ctx context.Context, ch check) (r Result) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	r = Result{Status: StatusUp, Critical: ch.critical}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("check panicked: %v", p)
+			}
+		}()
+		done <- ch.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.New("timed out")
+	}
+	r.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		r.Status, r.Error = StatusDown, err.Error()
+	}
+	return r
+}
+
+// LiveHandler serves /livez: 200 while the process can serve HTTP at all,
+// whatever state its dependencies are in.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, http.StatusOK, Report{Status: StatusUp, Phase: c.Phase()})
+	})
+}
+
+// ReadyHandler serves /readyz: 200 when the instance is running and every
+// critical check passes, with the status of each check, and 503 otherwise.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Phase() == PhaseStarting {
+			write(w, http.StatusServiceUnavailable, Report{Status: StatusDown, Phase: PhaseStarting})
+			return
+		}
+		rep := c.Run(r.Context())
+		code := http.StatusOK
+		if rep.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
+		write(w, code, rep)
+	})
+}
+
+func write(w http.ResponseWriter, code int, rep Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(rep)
+}
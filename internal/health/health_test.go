@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(context.Context) error   { return nil }
+func fail(context.Context) error { return errors.New("connection refused") }
+
+func ready(t *testing.T, c *Checker) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var rep Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, rep
+}
+
+func TestReadiness(t *testing.T) {
+	c := NewChecker()
+	c.Add("postgres", true, ok)
+	c.Add("redis", false, ok)
+
+	if code, rep := ready(t, c); code != http.StatusServiceUnavailable || rep.Phase != PhaseStarting {
+		t.Fatalf("starting: %d %+v", code, rep)
+	}
+
+	c.SetPhase(PhaseRunning)
+	if code, rep := ready(t, c); code != http.StatusOK || rep.Status != StatusUp || len(rep.Checks) != 2 {
+		t.Fatalf("healthy: %d %+v", code, rep)
+	}
+
+	c.Add("worker:notifications", false, fail)
+	code, rep := ready(t, c)
+	if code != http.StatusOK || rep.Status != StatusDegraded {
+		t.Fatalf("non-critical failure: %d %+v", code, rep)
+	}
+	if r := rep.Checks["worker:notifications"]; r.Status != StatusDown || r.Error != "connection refused" || r.Critical {
+		t.Fatalf("worker result = %+v", r)
+	}
+
+	c.Add("migrations", true, fail)
+	if code, rep := ready(t, c); code != http.StatusServiceUnavailable || rep.Status != StatusDown {
+		t.Fatalf("critical failure: %d %+v", code, rep)
+	}
+
+	c.SetPhase(PhaseStopping)
+	if code, _ := ready(t, c); code != http.StatusServiceUnavailable {
+		t.Fatalf("stopping: %d", code)
+	}
+}
+
+func TestLivenessIgnoresDependencies(t *testing.T) {
+	c := NewChecker()
+	c.Add("postgres", true, fail)
+	rec := httptest.NewRecorder()
+	c.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("livez = %d", rec.Code)
+	}
+}
+
+func TestCheckTimeoutAndPanic(t *testing.T) {
+	c := NewChecker()
+	c.timeout = 20 * time.Millisecond
+	c.SetPhase(PhaseRunning)
+	c.Add("slow", true, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	c.Add("broken", false, func(context.Context) error { panic("nil map") })
+	start := time.Now()
+	rep := c.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("Run waited for a check past its timeout")
+	}
+	if rep.Checks["slow"].Error != "timed out" || rep.Status != StatusDown {
+		t.Fatalf("slow = %+v", rep)
+	}
+	if rep.Checks["broken"].Status != StatusDown {
+		t.Fatalf("broken = %+v", rep.Checks["broken"])
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	now := time.Now()
+	hb := NewHeartbeat(time.Minute)
+	hb.now = func() time.Time { return now }
+	hb.Beat()
+	if err := hb.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	hb.Fail(errors.New("redis down"))
+	if err := hb.Check(context.Background()); err == nil || err.Error() != "redis down" {
+		t.Fatalf("after Fail: %v", err)
+	}
+	hb.Beat()
+	now = now.Add(2 * time.Minute)
+	if err := hb.Check(context.Background()); err == nil {
+		t.Fatal("stale heartbeat passed")
+	}
+	hb.Beat()
+	hb.Stop()
+	if err := hb.Check(context.Background()); err == nil {
+		t.Fatal("stopped worker passed")
+	}
+
+	var none *Heartbeat
+	none.Beat()
+	none.Fail(errors.New("ignored"))
+	none.Stop()
+}
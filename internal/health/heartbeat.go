@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Heartbeat tracks a background worker. The worker calls Beat after each
+// successful pass and Fail when a pass fails; its check fails while the last
+// pass failed, when no beat has arrived within maxAge, or once the worker
+// has stopped. A nil *Heartbeat ignores every call, so workers can be run
+// without one.
+type Heartbeat struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	last    time.Time
+	err     error
+	stopped bool
+}
+
+// NewHeartbeat creates a heartbeat. A zero maxAge disables the staleness
+// check, for workers that sleep for long periods.
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{maxAge: maxAge, now: time.Now, last: time.Now()}
+}
+
+// Beat records a successful pass.
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.last, h.err = h.now(), nil
+	h.mu.Unlock()
+}
+
+// Fail records a failed pass.
+func (h *Heartbeat) Fail(err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.last, h.err = h.now(), err
+	h.mu.Unlock()
+}
+
+// Stop records that the worker has returned.
+func (h *Heartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.stopped = true
+	h.mu.Unlock()
+}
+
+// Check reports the state of the worker as a check function.
+func (h *Heartbeat) Check(context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case h.stopped:
+		return errors.New("worker stopped")
+	case h.err != nil:
+		return h.err
+	case h.maxAge > 0 && h.now().Sub(h.last) > h.maxAge:
+		return fmt.Errorf("no heartbeat for %s", h.now().Sub(h.last).Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Counter tracks amounts posted within a rolling window.
+type Counter interface {
+	// Reserve drops entries older than window and, if the total recorded
+	// under key plus amount stays within max, records amount at now. The
+	// check and the increment happen in one step, so concurrent callers
+	// cannot both pass. It returns the entry to Release, or "" when nothing
+	// was recorded, together with the total and the time of the oldest entry
+	// inside the window before amount was added.
+	Reserve(ctx context.Context, key string, amount, max float64, window time.Duration, now time.Time) (entry string, used float64, oldest time.Time, err error)
+	// Release removes an entry returned by Reserve.
+	Release(ctx context.Context, key, entry string) error
+}
+
+// RedisCounter keeps each debit as a member of a sorted set scored by its
+// timestamp, so the window slides continuously instead of resetting at
+// midnight.
+type RedisCounter struct{ rdb *redis.Client }
+
+// NewRedisCounter returns a Counter backed by rdb.
+func NewRedisCounter(rdb *redis.Client) *RedisCounter { return &RedisCounter{rdb: rdb} }
+
+// reserveScript runs Reserve inside Redis. Totals are returned as strings
+// because Redis truncates Lua numbers to integers.
+//
+//	KEYS[1] counter key
+//	ARGV    window start, amount, max, score, member, window in ms
+var reserveScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+local entries = redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+local used = 0
+for i = 1, #entries, 2 do
+	local amount = tonumber(string.match(entries[i], ':(.+)$'))
+	if amount == nil then
+		return redis.error_reply('limits: malformed counter entry ' .. entries[i])
+	end
+	used = used + amount
+end
+local oldest = entries[2] or ''
+if used + tonumber(ARGV[2]) > tonumber(ARGV[3]) then
+	return {0, tostring(used), oldest}
+end
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[5])
+redis.call('PEXPIRE', KEYS[1], ARGV[6])
+return {1, tostring(used), oldest}
+`)
+
+// Reserve implements Counter.
+func (c *RedisCounter) Reserve(ctx context.Context, key string, amount, max float64, window time.Duration, now time.Time) (string, float64, time.Time, error) {
+	member := fmt.Sprintf("%d:%.2f", now.UnixNano(), amount)
+	res, err := reserveScript.Run(ctx, c.rdb, []string{key},
+		now.Add(-window).UnixMilli(), amount, max, now.UnixMilli(), member, window.Milliseconds()).Slice()
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	if len(res) != 3 {
+		return "", 0, time.Time{}, fmt.Errorf("limits: unexpected reserve reply %v", res)
+	}
+	used, err := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	if err != nil {
+		return "", 0, time.Time{}, err
+	}
+	var oldest time.Time
+	if s := fmt.Sprint(res[2]); s != "" {
+		ms, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", 0, time.Time{}, err
+		}
+		oldest = time.UnixMilli(int64(ms))
+	}
+	if ok, _ := res[0].(int64); ok != 1 {
+		return "", used, oldest, nil
+	}
+	return member, used, oldest, nil
+}
+
+// Release implements Counter.
+func (c *RedisCounter) Release(ctx context.Context, key, entry string) error {
+	return c.rdb.ZRem(ctx, key, entry).Err()
+}
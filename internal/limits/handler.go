@@ -0,0 +1,141 @@
+package limits
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for limits and limit increase requests.
+type Handler struct {
+	repo   *Repo
+	owners auth.Owners
+}
+
+// NewHandler creates a limits handler. owners resolves the login of the
+// customer asking for an increase.
+func NewHandler(r *Repo, owners auth.Owners) *Handler { return &Handler{repo: r, owners: owners} }
+
+// ListLimits handles GET /v1/limits.
+func (h *Handler) ListLimits(w http.ResponseWriter, r *http.Request) {
+	p, err := page.FromQuery(r.URL.Query(), page.Asc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.List(p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Limit).Key))
+}
+
+// SetLimit handles POST /v1/limits to create or update a limit. Admin only.
+func (h *Handler) SetLimit(w http.ResponseWriter, r *http.Request) {
+	var l Limit
+	if err := request.Decode(w, r, &l); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if l.ScopeRef == "" {
+		l.ScopeRef = "*"
+	}
+	if l.TxnType == "" {
+		l.TxnType = AnyType
+	}
+	if err := h.repo.Upsert(&l); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(l)
+}
+
+// RequestIncrease handles POST /v1/limits/increases for a customer asking for
+// a temporary increase of a limit, lasting at most 30 days. Only the customer
+// and staff may ask.
+func (h *Handler) RequestIncrease(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		LimitID    int     `json:"limit_id" validate:"required,positive"`
+		CustomerID int     `json:"customer_id" validate:"required,positive"`
+		MaxAmount  float64 `json:"max_amount" validate:"required,positive"`
+		Reason     string  `json:"reason"`
+		Days       int     `json:"days" validate:"required,min=1,max=30"`
+	}
+	var rr req
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := auth.AllowCustomer(r, h.owners, rr.CustomerID, auth.RoleTeller, auth.RoleAdmin); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	l, err := h.repo.Get(rr.LimitID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("limit not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if rr.MaxAmount <= l.MaxAmount {
+		problem.Write(w, r, problem.Invalid(problem.Field("max_amount", "must exceed the current limit")))
+		return
+	}
+	inc := &Increase{
+		LimitID:    l.ID,
+		CustomerID: rr.CustomerID,
+		MaxAmount:  rr.MaxAmount,
+		Reason:     rr.Reason,
+		ValidUntil: time.Now().AddDate(0, 0, rr.Days),
+	}
+	if err := h.repo.CreateIncrease(inc); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inc)
+}
+
+// ListIncreases handles GET /v1/limits/increases?status=. Admin only.
+func (h *Handler) ListIncreases(w http.ResponseWriter, r *http.Request) {
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.ListIncreases(r.URL.Query().Get("status"), p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Increase).Key))
+}
+
+// DecideIncrease handles POST /v1/limits/increases/{id}/decision to approve or
+// reject a pending increase. Admin only.
+func (h *Handler) DecideIncrease(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		ID      int  `json:"id" validate:"required,positive"`
+		Approve bool `json:"approve"`
+	}
+	var rr req
+	if err := request.DecodeFor(w, r, &rr, &rr.ID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	inc, err := h.repo.DecideIncrease(rr.ID, rr.Approve, auth.UserID(r))
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(inc)
+}
@@ -0,0 +1,260 @@
+// Package limits enforces per-transaction, daily and monthly limits on money
+// leaving an account. Limits can be attached to a customer, an account, a
+// product or a channel, and customers may request temporary increases that
+// take effect once approved by staff.
+package limits
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Scopes a limit can be attached to.
+const (
+	ScopeCustomer = "customer"
+	ScopeAccount  = "account"
+	ScopeProduct  = "product"
+	ScopeChannel  = "channel"
+)
+
+// Periods a limit can apply over. Daily and monthly limits use rolling windows.
+const (
+	PeriodTransaction = "per_transaction"
+	PeriodDaily       = "daily"
+	PeriodMonthly     = "monthly"
+)
+
+// Transaction types limits can be set on. AnyType matches every type.
+const (
+	TypeWithdraw = "withdraw"
+	TypeTransfer = "transfer"
+	AnyType      = "*"
+)
+
+// DefaultChannel is used when a request does not name its channel.
+const DefaultChannel = "api"
+
+// Limit is a configured cap on outgoing amounts for a scope.
+// The validate tags list the scope, type and period constants above.
+type Limit struct {
+	ID        int       `json:"id"`
+	Scope     string    `json:"scope" validate:"required,oneof=customer account product channel"`
+	ScopeRef  string    `json:"scope_ref"`
+	TxnType   string    `json:"txn_type" validate:"oneof=withdraw transfer *"`
+	Period    string    `json:"period" validate:"required,oneof=per_transaction daily monthly"`
+	MaxAmount float64   `json:"max_amount" validate:"required,positive"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Usage describes a debit that is about to be posted and is checked against
+// every limit that applies to it.
+type Usage struct {
+	CustomerID    int
+	AccountNumber string
+	Product       string
+	Channel       string
+	TxnType       string
+	Amount        float64
+}
+
+// ref returns the value of u that a limit with the given scope is keyed on.
+func (u Usage) ref(scope string) string {
+	switch scope {
+	case ScopeCustomer:
+		return strconv.Itoa(u.CustomerID)
+	case ScopeAccount:
+		return u.AccountNumber
+	case ScopeProduct:
+		return u.Product
+	case ScopeChannel:
+		return u.Channel
+	}
+	return ""
+}
+
+// Window returns the rolling window length for a period, or 0 for
+// per-transaction limits.
+func Window(period string) time.Duration {
+	switch period {
+	case PeriodDaily:
+		return 24 * time.Hour
+	case PeriodMonthly:
+		return 30 * 24 * time.Hour
+	}
+	return 0
+}
+
+// Breach is returned by Reserve when a debit would exceed a limit.
+type Breach struct {
+	LimitID   int        `json:"limit_id"`
+	Scope     string     `json:"scope"`
+	ScopeRef  string     `json:"scope_ref"`
+	TxnType   string     `json:"txn_type"`
+	Period    string     `json:"period"`
+	MaxAmount float64    `json:"max_amount"`
+	Used      float64    `json:"used"`
+	Requested float64    `json:"requested"`
+	Remaining float64    `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+func (b *Breach) Error() string {
+	return fmt.Sprintf("%s %s limit exceeded for %s %s", b.Period, b.TxnType, b.Scope, b.ScopeRef)
+}
+
+// store is the part of *Repo the service reads limits and usage from.
+type store interface {
+	Applicable(ctx context.Context, u Usage) ([]*Limit, error)
+	ActiveIncrease(ctx context.Context, limitID, customerID int, now time.Time) (*Increase, error)
+	UsedSince(ctx context.Context, scope, ref string, types []string, since time.Time) (float64, time.Time, error)
+}
+
+// Service checks and records usage against configured limits.
+type Service struct {
+	repo     store
+	counter  Counter
+	channels map[string]bool
+	now      func() time.Time
+}
+
+// NewService creates a limits service. Usage is tracked in counter and read
+// back from the journal in Postgres whenever the counter is unavailable.
+// channels are the values clients may name in X-Channel besides
+// DefaultChannel.
+func NewService(repo *Repo, counter Counter, channels []string) *Service {
+	s := &Service{repo: repo, counter: counter, channels: map[string]bool{DefaultChannel: true}, now: time.Now}
+	for _, c := range channels {
+		s.channels[c] = true
+	}
+	return s
+}
+
+// Reservation is usage counted against rolling windows by Reserve.
+type Reservation struct {
+	counter Counter
+	entries [][2]string // counter key, entry
+}
+
+// Reserve checks u against every applicable limit and, if none would be
+// exceeded, counts it in their rolling windows in the same step, so that
+// concurrent debits cannot each pass the check and together overshoot a
+// limit. It returns a *Breach, having counted nothing, if u exceeds a limit.
+// The caller must Release the reservation if the debit is not posted.
+//
+// While the counter is unavailable usage is read from the journal instead;
+// that fallback checks without reserving.
+func (s *Service) Reserve(ctx context.Context, u Usage) (*Reservation, error) {
+	list, err := s.repo.Applicable(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	res := &Reservation{counter: s.counter}
+	for _, l := range list {
+		if err := s.reserve(ctx, res, l, u, now); err != nil {
+			res.Release(ctx)
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *Service) reserve(ctx context.Context, res *Reservation, l *Limit, u Usage, now time.Time) error {
+	max := l.MaxAmount
+	if inc, err := s.repo.ActiveIncrease(ctx, l.ID, u.CustomerID, now); err != nil {
+		return err
+	} else if inc != nil {
+		max = inc.MaxAmount
+	}
+	breach := &Breach{LimitID: l.ID, Scope: l.Scope, ScopeRef: u.ref(l.Scope), TxnType: l.TxnType, Period: l.Period,
+		MaxAmount: max, Requested: u.Amount, Remaining: max}
+	if l.Period == PeriodTransaction {
+		if u.Amount > max {
+			return breach
+		}
+		return nil
+	}
+	w := Window(l.Period)
+	key := counterKey(l, u)
+	entry, used, oldest, err := s.counter.Reserve(ctx, key, u.Amount, max, w, now)
+	if err != nil {
+		logging.From(ctx).Warnf("limits: counter unavailable, falling back to postgres: %v", err)
+		used, oldest, err = s.repo.UsedSince(ctx, l.Scope, u.ref(l.Scope), journalTypes(l.TxnType), now.Add(-w))
+		if err != nil {
+			return err
+		}
+		if used+u.Amount <= max {
+			return nil
+		}
+	} else if entry != "" {
+		res.entries = append(res.entries, [2]string{key, entry})
+		return nil
+	}
+	resets := now.Add(w)
+	if !oldest.IsZero() {
+		resets = oldest.Add(w)
+	}
+	breach.Used, breach.ResetsAt = used, &resets
+	if breach.Remaining = max - used; breach.Remaining < 0 {
+		breach.Remaining = 0
+	}
+	return breach
+}
+
+// Release returns reserved usage to the rolling windows, for a debit that
+// was rejected or failed to post. Failures are logged only: the entries
+// expire with their window. Release on a nil reservation does nothing.
+func (r *Reservation) Release(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	for _, e := range r.entries {
+		if err := r.counter.Release(ctx, e[0], e[1]); err != nil {
+			logging.From(ctx).Warnf("limits: release usage %s: %v", e[0], err)
+		}
+	}
+	r.entries = nil
+}
+
+func counterKey(l *Limit, u Usage) string {
+	return fmt.Sprintf("limits:%d:%s", l.ID, u.ref(l.Scope))
+}
+
+// journalTypes maps a limit transaction type to the transactions.type values
+// it covers.
+func journalTypes(txnType string) []string {
+	switch txnType {
+	case TypeWithdraw:
+		return []string{"withdraw"}
+	case TypeTransfer:
+		return []string{"transfer_debit"}
+	}
+	return []string{"withdraw", "transfer_debit"}
+}
+
+// Channel returns the channel named in the X-Channel header of r, or
+// DefaultChannel when it names none. A channel outside the configured set
+// is a validation problem.
+func (s *Service) Channel(r *http.Request) (string, error) {
+	c := r.Header.Get("X-Channel")
+	if c == "" {
+		return DefaultChannel, nil
+	}
+	if !s.channels[c] {
+		return "", problem.Invalid(problem.Field("X-Channel", "is not a known channel"))
+	}
+	return c, nil
+}
+
+// Problem reports a breach as a 422 with the limit that was exceeded.
+func (b *Breach) Problem() *problem.Error {
+	p := problem.New(http.StatusUnprocessableEntity, "limit_exceeded", b.Error())
+	p.Extra = map[string]interface{}{"limit": b}
+	return p
+}
@@ -0,0 +1,264 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+func TestWindow(t *testing.T) {
+	if Window(PeriodTransaction) != 0 {
+		t.Fatal("per-transaction limits have no window")
+	}
+	if Window(PeriodDaily) != 24*time.Hour {
+		t.Fatal("daily window should be 24h")
+	}
+}
+
+func TestBreachProblem(t *testing.T) {
+	resets := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	rec := httptest.NewRecorder()
+	err := fmt.Errorf("transfer: %w", &Breach{LimitID: 7, Scope: ScopeCustomer, ScopeRef: "3", Period: PeriodDaily, ResetsAt: &resets})
+	problem.Write(rec, httptest.NewRequest(http.MethodPost, "/v1/accounts/withdraw", nil), err)
+	if rec.Code != 422 || rec.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body struct {
+		problem.Body
+		Limit Breach `json:"limit"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != "limit_exceeded" || body.Limit.LimitID != 7 || !body.Limit.ResetsAt.Equal(resets) {
+		t.Fatalf("unexpected body %+v", body)
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	l := &Limit{Scope: "branch", Period: PeriodDaily, TxnType: AnyType}
+	var p *problem.Error
+	if !errors.As(request.Validate(l), &p) || len(p.Fields) != 2 || p.Fields[0].Field != "scope" || p.Fields[1].Field != "max_amount" {
+		t.Fatalf("Validate = %+v", p)
+	}
+	l.Scope, l.MaxAmount = ScopeAccount, 500
+	if err := request.Validate(l); err != nil {
+		t.Fatal(err)
+	}
+	l.Period = "weekly"
+	if request.Validate(l) == nil {
+		t.Fatal("unknown period accepted")
+	}
+}
+
+func TestSetLimitRejectsInvalidBodies(t *testing.T) {
+	cases := []struct {
+		body, contentType string
+		status            int
+		field             string
+	}{
+		{`{"scope":"branch","period":"daily","max_amount":100}`, "application/json", http.StatusUnprocessableEntity, "scope"},
+		{`{"scope":"account","period":"daily","max_amount":-5}`, "application/json", http.StatusUnprocessableEntity, "max_amount"},
+		{`{"scope":"account","period":"daily","max_amount":100,"extra":1}`, "application/json", http.StatusUnprocessableEntity, "extra"},
+		{`{"scope":"account","period":"daily","max_amount":100}`, "text/plain", http.StatusUnsupportedMediaType, ""},
+	}
+	h := NewHandler(nil, nil)
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/limits", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		rec := httptest.NewRecorder()
+		h.SetLimit(rec, req)
+		var p struct{ Errors []problem.FieldError }
+		json.NewDecoder(rec.Body).Decode(&p)
+		if rec.Code != c.status || (c.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != c.field)) {
+			t.Errorf("%s: status %d, errors %+v", c.body, rec.Code, p.Errors)
+		}
+	}
+}
+
+func TestChannel(t *testing.T) {
+	s := NewService(nil, nil, []string{"web", "mobile"})
+	cases := []struct {
+		header, want string
+		ok           bool
+	}{
+		{"", DefaultChannel, true},
+		{"mobile", "mobile", true},
+		{"api", "api", true},
+		{"kiosk", "", false},
+		{strings.Repeat("x", 40), "", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/v1/transfers", nil)
+		if c.header != "" {
+			req.Header.Set("X-Channel", c.header)
+		}
+		got, err := s.Channel(req)
+		if got != c.want || (err == nil) != c.ok {
+			t.Errorf("X-Channel %q = %q, %v", c.header, got, err)
+		}
+	}
+}
+
+// memCounter is a Counter that, like the Redis script, checks and records
+// under one lock.
+type memCounter struct {
+	mu      sync.Mutex
+	entries map[string][]memEntry
+	seq     int
+}
+
+type memEntry struct {
+	member string
+	amount float64
+}
+
+func (c *memCounter) Reserve(_ context.Context, key string, amount, max float64, _ time.Duration, now time.Time) (string, float64, time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var used float64
+	for _, e := range c.entries[key] {
+		used += e.amount
+	}
+	if used+amount > max {
+		return "", used, now, nil
+	}
+	c.seq++
+	entry := fmt.Sprintf("%d:%.2f", c.seq, amount)
+	c.entries[key] = append(c.entries[key], memEntry{entry, amount})
+	return entry, used, now, nil
+}
+
+func (c *memCounter) Release(_ context.Context, key, entry string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range c.entries[key] {
+		if e.member == entry {
+			c.entries[key] = append(c.entries[key][:i], c.entries[key][i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (c *memCounter) total(key string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var sum float64
+	for _, e := range c.entries[key] {
+		sum += e.amount
+	}
+	return sum
+}
+
+type fakeStore []*Limit
+
+func (s fakeStore) Applicable(context.Context, Usage) ([]*Limit, error) { return s, nil }
+
+func (fakeStore) ActiveIncrease(context.Context, int, int, time.Time) (*Increase, error) {
+	return nil, nil
+}
+
+func (fakeStore) UsedSince(context.Context, string, string, []string, time.Time) (float64, time.Time, error) {
+	return 0, time.Time{}, errors.New("unused")
+}
+
+func TestReserveConcurrent(t *testing.T) {
+	daily := &Limit{ID: 1, Scope: ScopeAccount, TxnType: AnyType, Period: PeriodDaily, MaxAmount: 100}
+	counter := &memCounter{entries: map[string][]memEntry{}}
+	s := &Service{repo: fakeStore{daily}, counter: counter, now: time.Now}
+	u := Usage{AccountNumber: "ACC1", TxnType: TypeTransfer, Amount: 10}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ok, breached int
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Reserve(context.Background(), u)
+			var b *Breach
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ok++
+			case errors.As(err, &b):
+				breached++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok != 10 || breached != 15 {
+		t.Fatalf("%d reserved, %d breached; want 10 and 15", ok, breached)
+	}
+	if got := counter.total(counterKey(daily, u)); got != 100 {
+		t.Fatalf("counted %v, want 100", got)
+	}
+}
+
+func TestReserveRelease(t *testing.T) {
+	daily := &Limit{ID: 1, Scope: ScopeAccount, TxnType: AnyType, Period: PeriodDaily, MaxAmount: 100}
+	monthly := &Limit{ID: 2, Scope: ScopeCustomer, TxnType: AnyType, Period: PeriodMonthly, MaxAmount: 150}
+	counter := &memCounter{entries: map[string][]memEntry{}}
+	s := &Service{repo: fakeStore{monthly, daily}, counter: counter, now: time.Now}
+	u := Usage{CustomerID: 3, AccountNumber: "ACC1", Amount: 80}
+	ctx := context.Background()
+
+	res, err := s.Reserve(ctx, u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed posting gives the usage back
+	res.Release(ctx)
+	if counter.total(counterKey(daily, u)) != 0 || counter.total(counterKey(monthly, u)) != 0 {
+		t.Fatal("release left usage behind")
+	}
+	if _, err := s.Reserve(ctx, u); err != nil {
+		t.Fatal(err)
+	}
+	// the daily limit breaches on the second debit; the monthly entry it
+	// reserved first must not be kept
+	u.Amount = 30
+	_, err = s.Reserve(ctx, u)
+	var b *Breach
+	if !errors.As(err, &b) || b.LimitID != 1 || b.Used != 80 || b.Remaining != 20 {
+		t.Fatalf("Reserve = %v", err)
+	}
+	if got := counter.total(counterKey(monthly, u)); got != 80 {
+		t.Fatalf("monthly usage %v, want 80", got)
+	}
+}
+
+func TestRequestIncreaseForOtherCustomer(t *testing.T) {
+	h := NewHandler(nil, owners{5: 7})
+	req := httptest.NewRequest(http.MethodPost, "/v1/limits/increases",
+		strings.NewReader(`{"limit_id":1,"customer_id":5,"max_amount":5000,"days":7}`))
+	req.Header.Set("Content-Type", "application/json")
+	claims := jwt.MapClaims{"sub": float64(8), "role": auth.RoleUser}
+	rec := httptest.NewRecorder()
+	h.RequestIncrease(rec, req.WithContext(context.WithValue(req.Context(), "claims", claims)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", rec.Code, rec.Body)
+	}
+}
+
+// owners maps customer ids to their login.
+type owners map[int]int
+
+func (o owners) OwnerUserID(customerID int) (int, error) { return o[customerID], nil }
@@ -0,0 +1,240 @@
+package limits
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Repo provides database methods for limits and limit increase requests.
+type Repo struct{ db *sql.DB }
+
+// NewRepo initializes and returns a new limits repository instance.
+func NewRepo(db *sql.DB) *Repo { return &Repo{db: db} }
+
+// Increase statuses.
+const (
+	IncreasePending  = "pending"
+	IncreaseApproved = "approved"
+	IncreaseRejected = "rejected"
+)
+
+// Increase is a customer request to temporarily raise a limit.
+type Increase struct {
+	ID         int        `json:"id"`
+	LimitID    int        `json:"limit_id"`
+	CustomerID int        `json:"customer_id"`
+	MaxAmount  float64    `json:"max_amount"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	ValidUntil time.Time  `json:"valid_until"`
+	DecidedBy  *int       `json:"decided_by,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ErrIncreaseNotPending is returned when deciding a request that was already decided.
+var ErrIncreaseNotPending = problem.New(http.StatusConflict, "increase_not_pending", "limit increase is not pending")
+
+const limitCols = "id, scope, scope_ref, txn_type, period, max_amount, created_at"
+
+// Upsert creates a limit or replaces the amount of an existing one with the
+// same scope, reference, type and period.
+func (r *Repo) Upsert(l *Limit) error {
+	return r.db.QueryRow(`
+		INSERT INTO transaction_limits(scope, scope_ref, txn_type, period, max_amount)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, scope_ref, txn_type, period) DO UPDATE SET max_amount = EXCLUDED.max_amount
+		RETURNING id, created_at`,
+		l.Scope, l.ScopeRef, l.TxnType, l.Period, l.MaxAmount).Scan(&l.ID, &l.CreatedAt)
+}
+
+// Get returns the limit with the given id.
+func (r *Repo) Get(id int) (*Limit, error) {
+	l := &Limit{}
+	err := r.db.QueryRow("SELECT "+limitCols+" FROM transaction_limits WHERE id=$1", id).
+		Scan(&l.ID, &l.Scope, &l.ScopeRef, &l.TxnType, &l.Period, &l.MaxAmount, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Key returns the pagination cursor position of l.
+func (l *Limit) Key() page.Cursor { return page.Cursor{ID: l.ID} }
+
+// Key returns the pagination cursor position of i.
+func (i *Increase) Key() page.Cursor { return page.Cursor{ID: i.ID} }
+
+// List returns one page of the configured limits, fetching p.Limit+1 rows
+// so the caller can tell whether another page follows.
+func (r *Repo) List(p page.Params) ([]*Limit, error) {
+	args := []interface{}{p.Limit + 1}
+	where := ""
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where = " WHERE id " + p.Cmp() + " $2"
+	}
+	return r.query("SELECT "+limitCols+" FROM transaction_limits"+where+" ORDER BY id "+p.Dir()+" LIMIT $1", args...)
+}
+
+// Applicable returns every limit that applies to u, either by exact
+// reference or through a "*" default for its scope.
+func (r *Repo) Applicable(ctx context.Context, u Usage) ([]*Limit, error) {
+	return r.queryContext(ctx, `SELECT `+limitCols+` FROM transaction_limits
+		WHERE txn_type IN ($1, '*')
+		  AND ((scope = 'customer' AND scope_ref IN ($2, '*'))
+		    OR (scope = 'account'  AND scope_ref IN ($3, '*'))
+		    OR (scope = 'product'  AND scope_ref IN ($4, '*'))
+		    OR (scope = 'channel'  AND scope_ref IN ($5, '*')))
+		ORDER BY id`,
+		u.TxnType, u.ref(ScopeCustomer), u.AccountNumber, u.Product, u.Channel)
+}
+
+func (r *Repo) query(q string, args ...interface{}) ([]*Limit, error) {
+	return r.queryContext(context.Background(), q, args...)
+}
+
+func (r *Repo) queryContext(ctx context.Context, q string, args ...interface{}) ([]*Limit, error) {
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Limit
+	for rows.Next() {
+		l := &Limit{}
+		if err := rows.Scan(&l.ID, &l.Scope, &l.ScopeRef, &l.TxnType, &l.Period, &l.MaxAmount, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// UsedSince sums debits of the given journal types posted after since for the
+// scope reference, reading straight from the transactions table.
+func (r *Repo) UsedSince(ctx context.Context, scope, ref string, types []string, since time.Time) (float64, time.Time, error) {
+	var col string
+	switch scope {
+	case ScopeCustomer:
+		col = "a.customer_id::text"
+	case ScopeAccount:
+		col = "a.account_number"
+	case ScopeProduct:
+		col = "a.product"
+	case ScopeChannel:
+		col = "t.channel"
+	default:
+		return 0, time.Time{}, errors.New("unknown limit scope " + scope)
+	}
+	var total float64
+	var oldest sql.NullTime
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(t.amount), 0), MIN(t.created_at)
+		FROM transactions t JOIN accounts a ON a.id = t.account_id
+		WHERE t.type = ANY($1) AND t.created_at > $2 AND `+col+` = $3`,
+		pq.Array(types), since, ref).Scan(&total, &oldest)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return total, oldest.Time, nil
+}
+
+const increaseCols = "id, limit_id, customer_id, max_amount, COALESCE(reason,''), status, valid_until, decided_by, decided_at, created_at"
+
+func scanIncrease(s interface{ Scan(...interface{}) error }) (*Increase, error) {
+	i := &Increase{}
+	var decidedBy sql.NullInt64
+	var decidedAt sql.NullTime
+	if err := s.Scan(&i.ID, &i.LimitID, &i.CustomerID, &i.MaxAmount, &i.Reason, &i.Status, &i.ValidUntil, &decidedBy, &decidedAt, &i.CreatedAt); err != nil {
+		return nil, err
+	}
+	if decidedBy.Valid {
+		v := int(decidedBy.Int64)
+		i.DecidedBy = &v
+	}
+	if decidedAt.Valid {
+		i.DecidedAt = &decidedAt.Time
+	}
+	return i, nil
+}
+
+// ActiveIncrease returns the highest approved, unexpired increase for the
+// limit and customer, or nil when there is none.
+func (r *Repo) ActiveIncrease(ctx context.Context, limitID, customerID int, now time.Time) (*Increase, error) {
+	i, err := scanIncrease(r.db.QueryRowContext(ctx, `SELECT `+increaseCols+` FROM limit_increases
+		WHERE limit_id=$1 AND customer_id=$2 AND status='approved' AND valid_until > $3
+		ORDER BY max_amount DESC LIMIT 1`, limitID, customerID, now))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return i, err
+}
+
+// CreateIncrease stores a new pending increase request.
+func (r *Repo) CreateIncrease(i *Increase) error {
+	i.Status = IncreasePending
+	return r.db.QueryRow(`
+		INSERT INTO limit_increases(limit_id, customer_id, max_amount, reason, status, valid_until)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		i.LimitID, i.CustomerID, i.MaxAmount, i.Reason, i.Status, i.ValidUntil).Scan(&i.ID, &i.CreatedAt)
+}
+
+// ListIncreases returns one page of increase requests, optionally filtered
+// by status, fetching p.Limit+1 rows.
+func (r *Repo) ListIncreases(status string, p page.Params) ([]*Increase, error) {
+	args := []interface{}{p.Limit + 1}
+	var where []string
+	if status != "" {
+		args = append(args, status)
+		where = append(where, fmt.Sprintf("status=$%d", len(args)))
+	}
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where = append(where, fmt.Sprintf("id %s $%d", p.Cmp(), len(args)))
+	}
+	q := "SELECT " + increaseCols + " FROM limit_increases"
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := r.db.Query(q+" ORDER BY id "+p.Dir()+" LIMIT $1", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Increase
+	for rows.Next() {
+		i, err := scanIncrease(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+// DecideIncrease approves or rejects a pending increase request.
+func (r *Repo) DecideIncrease(id int, approve bool, decidedBy int) (*Increase, error) {
+	status := IncreaseRejected
+	if approve {
+		status = IncreaseApproved
+	}
+	i, err := scanIncrease(r.db.QueryRow(`UPDATE limit_increases
+		SET status=$1, decided_by=$2, decided_at=now()
+		WHERE id=$3 AND status='pending'
+		RETURNING `+increaseCols, status, decidedBy, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrIncreaseNotPending
+	}
+	return i, err
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func captureJSON(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	l := logrus.StandardLogger()
+	out, formatter := l.Out, l.Formatter
+	l.SetOutput(&buf)
+	Setup("json")
+	t.Cleanup(func() {
+		l.SetOutput(out)
+		l.SetFormatter(formatter)
+	})
+	return &buf
+}
+
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatalf("not JSON: %q", l)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := captureJSON(t)
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), 42)
+		From(r.Context()).Info("transfer posted")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/accounts/transfer", nil)
+	req.Header.Set(HeaderRequestID, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(HeaderRequestID); got != "abc-123" {
+		t.Errorf("response request id = %q", got)
+	}
+	ls := lines(t, buf)
+	if len(ls) != 2 {
+		t.Fatalf("got %d log lines", len(ls))
+	}
+	inner, access := ls[0], ls[1]
+	if inner["request_id"] != "abc-123" || inner["user_id"] != float64(42) {
+		t.Errorf("inner line = %v", inner)
+	}
+	for k, want := range map[string]interface{}{
+		"request_id": "abc-123", "user_id": float64(42), "method": "POST",
+		"route": "/v1/accounts/transfer", "status": float64(201), "bytes": float64(5),
+	} {
+		if access[k] != want {
+			t.Errorf("access %s = %v, want %v", k, access[k], want)
+		}
+	}
+	if _, ok := access["latency_ms"]; !ok {
+		t.Error("access line has no latency")
+	}
+}
+
+func TestMiddlewareLogsRoutePattern(t *testing.T) {
+	buf := captureJSON(t)
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "/v1/accounts/{number}")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/accounts/1234567890", nil))
+	ls := lines(t, buf)
+	if len(ls) != 1 || ls[0]["route"] != "/v1/accounts/{number}" {
+		t.Errorf("access line = %v", ls)
+	}
+}
+
+func TestMiddlewareReplacesInvalidRequestID(t *testing.T) {
+	captureJSON(t)
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(HeaderRequestID, "bad id\nforged=1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get(HeaderRequestID); len(got) != 32 || strings.Contains(got, "forged") {
+		t.Errorf("request id = %q", got)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	ctx := WithRequestID(t.Context(), "job-1")
+	if RequestID(Detach(ctx)) != "job-1" {
+		t.Error("Detach dropped the request id")
+	}
+	if RequestID(Detach(t.Context())) == "" {
+		t.Error("Detach did not assign a request id")
+	}
+}
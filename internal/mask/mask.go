@@ -0,0 +1,28 @@
+// Package mask hides sensitive values for display to staff who may see that
+// a record exists but not its full contents.
+package mask
+
+import "strings"
+
+// Tail replaces all but the last n characters of v with asterisks.
+func Tail(v string, n int) string {
+	r := []rune(v)
+	if len(r) <= n {
+		return strings.Repeat("*", len(r))
+	}
+	return strings.Repeat("*", len(r)-n) + string(r[len(r)-n:])
+}
+
+// Email keeps the first character of the local part and the domain, so
+// "jane.doe@example.com" becomes "j*******@example.com".
+func Email(v string) string {
+	at := strings.LastIndex(v, "@")
+	if at < 1 {
+		return Tail(v, 0)
+	}
+	local := []rune(v[:at])
+	return string(local[0]) + strings.Repeat("*", len(local)-1) + v[at:]
+}
+
+// AccountNumber shows only the last four characters of an account number.
+func AccountNumber(v string) string { return Tail(v, 4) }
@@ -0,0 +1,18 @@
+package mask
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	cases := []struct{ got, want string }{
+		{Tail("+15551234567", 4), "********4567"},
+		{Tail("123", 4), "***"},
+		{Email("jane.doe@example.com"), "j*******@example.com"},
+		{Email("not-an-email"), "************"},
+		{AccountNumber("ACC0012345678"), "*********5678"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("got %q, want %q", c.got, c.want)
+		}
+	}
+}
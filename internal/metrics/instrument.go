@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	httpRequests = Default.NewCounter("rtcb_http_requests_total",
+		"HTTP requests by route, method and status code.", "route", "method", "status")
+	httpDuration = Default.NewHistogram("rtcb_http_request_duration_seconds",
+		"HTTP request latency by route and method.", DefBuckets, "route", "method")
+	httpInFlight = Default.NewGauge("rtcb_http_requests_in_flight",
+		"HTTP requests being served.")
+)
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Middleware counts and times requests. route names the registered route a
+// request matched, so that labels stay bounded whatever paths clients send;
+// an empty route is reported as "unmatched".
+func Middleware(next http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		rt := route(r)
+		if rt == "" {
+			rt = "unmatched"
+		}
+		httpRequests.Inc(rt, r.Method, strconv.Itoa(rec.status))
+		httpDuration.Observe(time.Since(start).Seconds(), rt, r.Method)
+	})
+}
+
+// RegisterDB exports the connection pool statistics of db.
+func RegisterDB(r *Registry, db *sql.DB) {
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+	r.NewGaugeFunc("rtcb_db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	r.NewGaugeFunc("rtcb_db_open_connections", "Established connections, in use and idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	r.NewGaugeFunc("rtcb_db_in_use_connections", "Connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	r.NewGaugeFunc("rtcb_db_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	r.NewCounterFunc("rtcb_db_wait_count_total", "Connections waited for.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	r.NewCounterFunc("rtcb_db_wait_duration_seconds_total", "Time blocked waiting for a new connection.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	r.NewCounterFunc("rtcb_db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	r.NewCounterFunc("rtcb_db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// RegisterRuntime exports goroutine and heap figures and the process start
+// time.
+func RegisterRuntime(r *Registry) {
+	start := float64(time.Now().Unix())
+	r.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	r.NewGaugeFunc("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc)
+	})
+	r.NewGaugeFunc("process_start_time_seconds", "Start time of the process since the Unix epoch in seconds.",
+		func() float64 { return start })
+}
+
+// RegisterQueue exports the length of a Redis list used as a queue. The
+// gauge is NaN when Redis cannot be reached.
+func RegisterQueue(r *Registry, rdb *redis.Client, key string) {
+	r.NewGaugeFunc("rtcb_queue_depth_"+key, "Messages waiting on the "+key+" queue.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		n, err := rdb.LLen(ctx, key).Result()
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
+
+var (
+	redisDuration = Default.NewHistogram("rtcb_redis_command_duration_seconds",
+		"Redis command latency by command.", []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "command")
+	redisErrors = Default.NewCounter("rtcb_redis_command_errors_total",
+		"Redis commands that failed, by command.", "command")
+)
+
+type redisStartKey struct{}
+
+// RedisHook times Redis commands. Add it with rdb.AddHook. Blocking pops
+// are timed too, so their latency includes the time spent waiting.
+type RedisHook struct{}
+
+// BeforeProcess implements redis.Hook.
+func (RedisHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcess implements redis.Hook.
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeRedis(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implements redis.Hook.
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline implements redis.Hook.
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, c := range cmds {
+		if c.Err() != nil {
+			err = c.Err()
+		}
+	}
+	observeRedis(ctx, "pipeline", err)
+	return nil
+}
+
+func observeRedis(ctx context.Context, command string, err error) {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		redisDuration.Observe(time.Since(start).Seconds(), command)
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		redisErrors.Inc(command)
+	}
+}
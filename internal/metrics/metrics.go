@@ -0,0 +1,319 @@
+// Package metrics is a small Prometheus client: counters, gauges and
+// histograms with labels, values read at scrape time, and a handler that
+// serves them in the Prometheus text exposition format. It covers what the
+// service needs without pulling in the full client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// ContentType is the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector writes one metric family.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry { return &Registry{names: map[string]bool{}} }
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[c.name()] {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.names[c.name()] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w *bufio.Writer) {
+	r.mu.Lock()
+	cs := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range cs {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry. A non-empty token must be presented as a
+// bearer token.
+func (r *Registry) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token != "" && req.Header.Get("Authorization") != "Bearer "+token {
+			problem.Write(w, req, problem.Unauthorized("a valid metrics token is required"))
+			return
+		}
+		w.Header().Set("Content-Type", ContentType)
+		bw := bufio.NewWriter(w)
+		r.WriteTo(bw)
+		bw.Flush()
+	})
+}
+
+// desc is the name, help and label names shared by a family's series.
+type desc struct {
+	Name   string
+	Help   string
+	Labels []string
+}
+
+func (d *desc) name() string { return d.Name }
+
+func (d *desc) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.Name, escapeHelp(d.Help), d.Name, typ)
+}
+
+// key joins label values into a map key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.Labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.Name, len(d.Labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labels renders {a="x",b="y"} for the label values in key, with extra
+// appended as a final label pair if non-empty.
+func (d *desc) labels(key string, extra ...string) string {
+	var pairs []string
+	if len(d.Labels) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.Labels[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// values is a set of float series keyed by label values.
+type values struct {
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func (v *values) add(key string, delta float64) {
+	v.mu.Lock()
+	if v.series == nil {
+		v.series = map[string]float64{}
+	}
+	v.series[key] += delta
+	v.mu.Unlock()
+}
+
+func (v *values) set(key string, val float64) {
+	v.mu.Lock()
+	if v.series == nil {
+		v.series = map[string]float64{}
+	}
+	v.series[key] = val
+	v.mu.Unlock()
+}
+
+func (v *values) snapshot() ([]string, map[string]float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	out := make(map[string]float64, len(v.series))
+	for k, val := range v.series {
+		keys = append(keys, k)
+		out[k] = val
+	}
+	sort.Strings(keys)
+	return keys, out
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct {
+	desc
+	values
+}
+
+// NewCounter registers a counter.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{Name: name, Help: help, Labels: labels}}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds v, which must not be negative, to the series.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.add(c.key(labelValues), v)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	keys, vals := c.snapshot()
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.Name, c.labels(k), formatFloat(vals[k]))
+	}
+}
+
+// Gauge is a value per label set that can go up and down.
+type Gauge struct {
+	desc
+	values
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{Name: name, Help: help, Labels: labels}}
+	r.register(g)
+	return g
+}
+
+// Set sets the series with the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) { g.set(g.key(labelValues), v) }
+
+// Add adds v, which may be negative, to the series.
+func (g *Gauge) Add(v float64, labelValues ...string) { g.add(g.key(labelValues), v) }
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	keys, vals := g.snapshot()
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", g.Name, g.labels(k), formatFloat(vals[k]))
+	}
+}
+
+// funcMetric is an unlabelled counter or gauge read at scrape time.
+type funcMetric struct {
+	desc
+	typ string
+	fn  func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every
+// scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{Name: name, Help: help}, typ: "gauge", fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape, for totals kept elsewhere such as sql.DBStats.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{desc: desc{Name: name, Help: help}, typ: "counter", fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.header(w, f.typ)
+	fmt.Fprintf(w, "%s %s\n", f.Name, formatFloat(f.fn()))
+}
+
+// Histogram counts observations into cumulative buckets per label set.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histSeries
+}
+
+type histSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which
+// must be sorted ascending. The +Inf bucket is implicit.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{Name: name, Help: help, Labels: labels}, buckets: buckets, series: map[string]*histSeries{}}
+	r.register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	k := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[k]
+	if s == nil {
+		s = &histSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.Lock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(k, "le", formatFloat(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.Name, h.labels(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.Name, h.labels(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.Name, h.labels(k), s.count)
+	}
+	h.mu.Unlock()
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+func escapeHelp(v string) string  { return helpEscaper.Replace(v) }
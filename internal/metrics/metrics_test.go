@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(r *Registry) string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	r.WriteTo(w)
+	w.Flush()
+	return buf.String()
+}
+
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("posted_total", "Postings by type.", "type", "currency")
+	c.Inc("deposit", "USD")
+	c.Add(2, "deposit", "USD")
+	c.Inc(`we"ird\`, "EUR")
+	g := r.NewGauge("in_flight", "In flight.")
+	g.Add(2)
+	g.Add(-1)
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+	r.NewGaugeFunc("queue_depth", "Depth.", func() float64 { return 7 })
+
+	want := `# HELP posted_total Postings by type.
+# TYPE posted_total counter
+posted_total{type="deposit",currency="USD"} 3
+posted_total{type="we\"ird\\",currency="EUR"} 1
+# HELP in_flight In flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+# HELP queue_depth Depth.
+# TYPE queue_depth gauge
+queue_depth 7
+`
+	if got := render(r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("x_total", "X.").Inc()
+	h := r.Handler("s3cret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ContentType || !strings.Contains(rec.Body.String(), "x_total 1") {
+		t.Errorf("with token: %d %q %q", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusTeapot)
+	}), func(*http.Request) string { return "/v1/test" })
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/test?id=1", nil))
+	if out := render(Default); !strings.Contains(out, `rtcb_http_requests_total{route="/v1/test",method="GET",status="418"} 1`) {
+		t.Errorf("request not counted:\n%s", out)
+	}
+}
@@ -0,0 +1,148 @@
+// Package page implements keyset pagination shared by the list endpoints:
+// request parameters, opaque cursors and the paginated response envelope.
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Sort orders.
+const (
+	Asc  = "asc"
+	Desc = "desc"
+)
+
+// Limits on the page size.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrBadCursor is returned for a cursor that cannot be decoded or was issued
+// for a different sort order.
+var ErrBadCursor = problem.Invalid(problem.Field("cursor", "is invalid or was issued for a different order"))
+
+// Cursor marks the last row of a page. Key is the sort column value of that
+// row and ID breaks ties, so together they identify a unique position.
+type Cursor struct {
+	Key   string `json:"k,omitempty"`
+	ID    int    `json:"i"`
+	Order string `json:"o"`
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode parses a token produced by Encode.
+func Decode(token string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil || (c.Order != Asc && c.Order != Desc) {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
+
+// Params are the pagination parameters of a list request.
+type Params struct {
+	Limit int
+	Order string
+	After *Cursor
+}
+
+// Desc reports whether rows are returned newest first.
+func (p Params) Desc() bool { return p.Order == Desc }
+
+// Cmp returns the keyset comparison operator for the sort order: rows after
+// the cursor are smaller when descending and larger when ascending.
+func (p Params) Cmp() string {
+	if p.Desc() {
+		return "<"
+	}
+	return ">"
+}
+
+// Dir returns the SQL sort direction.
+func (p Params) Dir() string {
+	if p.Desc() {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// FromQuery reads limit, order and cursor from query parameters. Order
+// defaults to def; a cursor carries its own order, which must match.
+func FromQuery(q url.Values, def string) (Params, error) {
+	p := Params{Limit: DefaultLimit, Order: def}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, problem.Invalid(problem.Field("limit", "must be a positive integer"))
+		}
+		if n > MaxLimit {
+			n = MaxLimit
+		}
+		p.Limit = n
+	}
+	if v := q.Get("order"); v != "" {
+		if v != Asc && v != Desc {
+			return p, problem.Invalid(problem.Field("order", "must be asc or desc"))
+		}
+		p.Order = v
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := Decode(v)
+		if err != nil {
+			return p, err
+		}
+		if q.Get("order") != "" && c.Order != p.Order {
+			return p, ErrBadCursor
+		}
+		p.Order = c.Order
+		p.After = c
+	}
+	return p, nil
+}
+
+// Info describes the page returned.
+type Info struct {
+	Limit      int    `json:"limit"`
+	Order      string `json:"order"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Envelope is the response body of every paginated list endpoint.
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Info        `json:"pagination"`
+}
+
+// New builds the envelope for rows fetched with a limit of p.Limit+1. The
+// extra row only signals that another page exists and is dropped; key
+// returns the cursor position of a row.
+func New[T any](rows []T, p Params, key func(T) Cursor) *Envelope {
+	info := Info{Limit: p.Limit, Order: p.Order}
+	if len(rows) > p.Limit {
+		rows = rows[:p.Limit]
+		info.HasMore = true
+		c := key(rows[len(rows)-1])
+		c.Order = p.Order
+		info.NextCursor = c.Encode()
+	}
+	if rows == nil {
+		rows = []T{}
+	}
+	return &Envelope{Data: rows, Pagination: info}
+}
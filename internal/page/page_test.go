@@ -0,0 +1,55 @@
+package page
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{Key: "2024-01-02T03:04:05Z", ID: 42, Order: Desc}
+	got, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != c {
+		t.Errorf("got %+v, want %+v", got, c)
+	}
+	if _, err := Decode("not-a-cursor"); err != ErrBadCursor {
+		t.Errorf("err = %v, want ErrBadCursor", err)
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+	p, err := FromQuery(url.Values{"limit": {"1000"}}, Desc)
+	if err != nil || p.Limit != MaxLimit || p.Order != Desc || p.After != nil {
+		t.Errorf("got %+v, %v", p, err)
+	}
+	if _, err := FromQuery(url.Values{"order": {"sideways"}}, Desc); err == nil {
+		t.Error("expected error for bad order")
+	}
+	cur := Cursor{ID: 7, Order: Asc}.Encode()
+	p, err = FromQuery(url.Values{"cursor": {cur}}, Desc)
+	if err != nil || p.Order != Asc || p.After.ID != 7 {
+		t.Errorf("cursor order not applied: %+v, %v", p, err)
+	}
+	if _, err := FromQuery(url.Values{"cursor": {cur}, "order": {Desc}}, Desc); err != ErrBadCursor {
+		t.Errorf("err = %v, want ErrBadCursor", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	p := Params{Limit: 2, Order: Asc}
+	key := func(n int) Cursor { return Cursor{ID: n} }
+	env := New([]int{1, 2, 3}, p, key)
+	if got := env.Data.([]int); len(got) != 2 || !env.Pagination.HasMore {
+		t.Fatalf("got %v, %+v", got, env.Pagination)
+	}
+	c, _ := Decode(env.Pagination.NextCursor)
+	if c.ID != 2 || c.Order != Asc {
+		t.Errorf("next cursor = %+v", c)
+	}
+	env = New([]int(nil), p, key)
+	if got := env.Data.([]int); got == nil || env.Pagination.HasMore || env.Pagination.NextCursor != "" {
+		t.Errorf("empty page = %+v", env)
+	}
+}
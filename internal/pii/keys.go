@@ -0,0 +1,125 @@
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider holds the master keys that wrap data keys. The local keyfile
+// provider is meant for development; production deployments implement it
+// over a KMS, where master keys never leave the service.
+type KeyProvider interface {
+	// CurrentKeyID names the master key new data keys are wrapped with.
+	CurrentKeyID() string
+	// Wrap encrypts a data key under the named master key.
+	Wrap(keyID string, dek []byte) ([]byte, error)
+	// Unwrap decrypts a data key produced by Wrap.
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+	// BlindIndexKey returns the HMAC key used for blind indexes. It is
+	// separate from the master keys and does not rotate with them.
+	BlindIndexKey() []byte
+}
+
+// ErrUnknownKey is returned for a key id the provider does not hold.
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Keyfile is the JSON layout read by LocalKeys. Keys are base64-encoded
+// 32-byte AES keys by id; Current names the key used for new data.
+//
+//	{"current": "2024-06", "keys": {"2024-01": "...", "2024-06": "..."}, "blind_index_key": "..."}
+type Keyfile struct {
+	Current       string            `json:"current"`
+	Keys          map[string]string `json:"keys"`
+	BlindIndexKey string            `json:"blind_index_key"`
+}
+
+// LocalKeys is a KeyProvider backed by a keyfile on disk.
+type LocalKeys struct {
+	current string
+	keys    map[string]cipher.AEAD
+	blind   []byte
+}
+
+// LoadKeyfile reads a keyfile and returns a LocalKeys provider.
+func LoadKeyfile(path string) (*LocalKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf Keyfile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewLocalKeys(kf)
+}
+
+// NewLocalKeys validates kf and returns a LocalKeys provider.
+func NewLocalKeys(kf Keyfile) (*LocalKeys, error) {
+	l := &LocalKeys{current: kf.Current, keys: map[string]cipher.AEAD{}}
+	for id, enc := range kf.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("key id %q must be non-empty and contain no colon", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes, base64-encoded", id)
+		}
+		block, _ := aes.NewCipher(key)
+		l.keys[id], _ = cipher.NewGCM(block)
+	}
+	if _, ok := l.keys[kf.Current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyfile", kf.Current)
+	}
+	blind, err := base64.StdEncoding.DecodeString(kf.BlindIndexKey)
+	if err != nil || len(blind) < 32 {
+		return nil, errors.New("blind_index_key must be at least 32 bytes, base64-encoded")
+	}
+	l.blind = blind
+	return l, nil
+}
+
+// CurrentKeyID implements KeyProvider.
+func (l *LocalKeys) CurrentKeyID() string { return l.current }
+
+// BlindIndexKey implements KeyProvider.
+func (l *LocalKeys) BlindIndexKey() []byte { return l.blind }
+
+// Wrap implements KeyProvider.
+func (l *LocalKeys) Wrap(keyID string, dek []byte) ([]byte, error) {
+	aead, ok := l.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dek, []byte(keyID)), nil
+}
+
+// Unwrap implements KeyProvider.
+func (l *LocalKeys) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := l.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(keyID))
+}
+
+// NewKey returns a random base64-encoded 32-byte key for a keyfile.
+func NewKey() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,180 @@
+// Package pii encrypts personal data at rest. Each value is sealed with
+// AES-256-GCM under a data key, and the data key is wrapped by a master key
+// held by a KeyProvider (envelope encryption). Sealed values carry the id of
+// the master key so they can be re-encrypted when the key rotates. Blind
+// indexes, keyed HMACs of normalized values, allow exact-match lookups on
+// encrypted columns.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// prefix marks a sealed value: enc:v1:<key id>:<wrapped data key>:<nonce+ciphertext>.
+const prefix = "enc:v1:"
+
+// ErrNoCipher is returned when encrypted data is read but no keys are
+// configured.
+var ErrNoCipher = errors.New("pii: encrypted data found but no keys are configured")
+
+// Cipher seals and opens field values. A Cipher reuses one data key per
+// master key for the life of the process, so sealing does not call the key
+// provider for every value, and caches unwrapped data keys for opening.
+type Cipher struct {
+	keys KeyProvider
+
+	mu        sync.Mutex
+	current   map[string]dataKey
+	unwrapped map[string]cipher.AEAD
+}
+
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped string
+}
+
+// New creates a Cipher over a key provider.
+func New(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys, current: map[string]dataKey{}, unwrapped: map[string]cipher.AEAD{}}
+}
+
+// Open returns a Cipher over the keyfile at path, or nil when path is
+// empty and personal data is stored in plaintext.
+func Open(path string) (*Cipher, error) {
+	if path == "" {
+		return nil, nil
+	}
+	keys, err := LoadKeyfile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(keys), nil
+}
+
+// CurrentKeyID returns the master key new values are sealed under.
+func (c *Cipher) CurrentKeyID() string { return c.keys.CurrentKeyID() }
+
+func newAEAD(key []byte) cipher.AEAD {
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// Seal encrypts v for the named field. The field is bound to the ciphertext
+// so a value cannot be moved to another column. Empty values stay empty,
+// and a nil Cipher returns v unchanged.
+func (c *Cipher) Seal(field, v string) (string, error) {
+	if v == "" || c == nil {
+		return v, nil
+	}
+	id := c.keys.CurrentKeyID()
+	c.mu.Lock()
+	dk, ok := c.current[id]
+	if !ok {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			c.mu.Unlock()
+			return "", err
+		}
+		wrapped, err := c.keys.Wrap(id, key)
+		if err != nil {
+			c.mu.Unlock()
+			return "", err
+		}
+		dk = dataKey{aead: newAEAD(key), wrapped: base64.RawStdEncoding.EncodeToString(wrapped)}
+		c.current[id] = dk
+		c.unwrapped[id+":"+dk.wrapped] = dk.aead
+	}
+	c.mu.Unlock()
+	nonce := make([]byte, dk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := dk.aead.Seal(nonce, nonce, []byte(v), []byte(field))
+	return prefix + id + ":" + dk.wrapped + ":" + base64.RawStdEncoding.EncodeToString(ct), nil
+}
+
+// Open decrypts a value sealed for field. Values without the sealed prefix
+// are returned unchanged, so plaintext written before encryption was enabled
+// still reads back.
+func (c *Cipher) Open(field, v string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	if c == nil {
+		return "", ErrNoCipher
+	}
+	parts := strings.SplitN(strings.TrimPrefix(v, prefix), ":", 3)
+	if len(parts) != 3 {
+		return "", errors.New("pii: malformed sealed value")
+	}
+	id, wrapped := parts[0], parts[1]
+	c.mu.Lock()
+	aead, ok := c.unwrapped[id+":"+wrapped]
+	c.mu.Unlock()
+	if !ok {
+		w, err := base64.RawStdEncoding.DecodeString(wrapped)
+		if err != nil {
+			return "", err
+		}
+		key, err := c.keys.Unwrap(id, w)
+		if err != nil {
+			return "", err
+		}
+		aead = newAEAD(key)
+		c.mu.Lock()
+		c.unwrapped[id+":"+wrapped] = aead
+		c.mu.Unlock()
+	}
+	ct, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(ct) < aead.NonceSize() {
+		return "", errors.New("pii: malformed sealed value")
+	}
+	n := aead.NonceSize()
+	pt, err := aead.Open(nil, ct[:n], ct[n:], []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return string(pt), nil
+}
+
+// OpenNull opens a nullable column, treating NULL as empty.
+func (c *Cipher) OpenNull(field string, v sql.NullString) (string, error) {
+	return c.Open(field, v.String)
+}
+
+// IsSealed reports whether v is a sealed value.
+func IsSealed(v string) bool { return strings.HasPrefix(v, prefix) }
+
+// KeyID returns the master key id a sealed value was written under, or ""
+// for plaintext.
+func KeyID(v string) string {
+	if !IsSealed(v) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(v, prefix), ":")
+	return id
+}
+
+// BlindIndex returns a keyed hash of a normalized value for exact-match
+// lookup. Kind separates the hash domains of different fields, so equal
+// values in different fields do not share an index entry. Empty values
+// index to "".
+func (c *Cipher) BlindIndex(kind, normalized string) string {
+	if normalized == "" {
+		return ""
+	}
+	m := hmac.New(sha256.New, c.keys.BlindIndexKey())
+	m.Write([]byte(kind + "\x00" + normalized))
+	return hex.EncodeToString(m.Sum(nil)[:16])
+}
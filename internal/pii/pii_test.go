@@ -0,0 +1,99 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+)
+
+func testKeys(t *testing.T, current string, ids ...string) *LocalKeys {
+	t.Helper()
+	kf := Keyfile{Current: current, Keys: map[string]string{}, BlindIndexKey: NewKey()}
+	for _, id := range ids {
+		kf.Keys[id] = NewKey()
+	}
+	k, err := NewLocalKeys(kf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	c := New(testKeys(t, "k1", "k1"))
+	sealed, err := c.Seal("customers.email", "jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || strings.Contains(sealed, "jane") || KeyID(sealed) != "k1" {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	if got, err := c.Open("customers.email", sealed); err != nil || got != "jane@example.com" {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+	// the field is bound to the ciphertext
+	if _, err := c.Open("customers.mobile", sealed); err == nil {
+		t.Error("opened a value under another field")
+	}
+	if got, _ := c.Open("customers.email", "legacy@example.com"); got != "legacy@example.com" {
+		t.Errorf("plaintext passthrough = %q", got)
+	}
+	if s, _ := c.Seal("customers.email", ""); s != "" {
+		t.Errorf("empty value sealed to %q", s)
+	}
+	var none *Cipher
+	if _, err := none.Open("customers.email", sealed); err != ErrNoCipher {
+		t.Errorf("nil cipher err = %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	kf := Keyfile{Current: "old", Keys: map[string]string{"old": NewKey(), "new": NewKey()}, BlindIndexKey: NewKey()}
+	oldKeys, _ := NewLocalKeys(kf)
+	sealed, _ := New(oldKeys).Seal("customers.first_name", "Jane")
+	kf.Current = "new"
+	newKeys, _ := NewLocalKeys(kf)
+	c := New(newKeys)
+	if got, err := c.Open("customers.first_name", sealed); err != nil || got != "Jane" {
+		t.Fatalf("Open after rotation = %q, %v", got, err)
+	}
+	resealed, _ := c.Seal("customers.first_name", "Jane")
+	if KeyID(sealed) != "old" || KeyID(resealed) != "new" {
+		t.Errorf("key ids = %q, %q", KeyID(sealed), KeyID(resealed))
+	}
+	delete(kf.Keys, "old")
+	retired, _ := NewLocalKeys(kf)
+	if _, err := New(retired).Open("customers.first_name", sealed); err != ErrUnknownKey {
+		t.Errorf("retired key err = %v", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	keys := testKeys(t, "k1", "k1")
+	a, b := New(keys), New(keys)
+	if a.BlindIndex("email", "jane@example.com") != b.BlindIndex("email", "jane@example.com") {
+		t.Error("blind index is not deterministic")
+	}
+	if a.BlindIndex("email", "x") == a.BlindIndex("mobile", "x") {
+		t.Error("kinds share a hash domain")
+	}
+	if a.BlindIndex("email", "") != "" {
+		t.Error("empty value indexed")
+	}
+	other := New(testKeys(t, "k1", "k1"))
+	if a.BlindIndex("email", "jane@example.com") == other.BlindIndex("email", "jane@example.com") {
+		t.Error("blind index does not depend on the key")
+	}
+}
+
+func TestNewLocalKeys(t *testing.T) {
+	for name, kf := range map[string]Keyfile{
+		"missing current": {Current: "k2", Keys: map[string]string{"k1": NewKey()}, BlindIndexKey: NewKey()},
+		"short key":       {Current: "k1", Keys: map[string]string{"k1": "c2hvcnQ="}, BlindIndexKey: NewKey()},
+		"colon in id":     {Current: "a:b", Keys: map[string]string{"a:b": NewKey()}, BlindIndexKey: NewKey()},
+		"no blind key":    {Current: "k1", Keys: map[string]string{"k1": NewKey()}},
+	} {
+		if _, err := NewLocalKeys(kf); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Erasure request statuses.
+const (
+	StatusRequested = "requested"
+	StatusRejected  = "rejected"
+	StatusCompleted = "completed"
+)
+
+// ErrNotRequested is returned when executing an erasure request that is not
+// awaiting a decision.
+var ErrNotRequested = problem.New(http.StatusConflict, "erasure_not_pending", "erasure request is not pending")
+
+// ErasureRequest tracks a customer's request to have their personal data
+// erased. Blockers lists the reasons it could not be carried out, such as
+// funds still held or loans outstanding; Summary counts the rows
+// pseudonymized when it completed.
+type ErasureRequest struct {
+	ID          int            `json:"id"`
+	CustomerID  int            `json:"customer_id"`
+	Status      string         `json:"status"`
+	Reason      string         `json:"reason"`
+	RequestedBy int            `json:"requested_by"`
+	Blockers    []string       `json:"blockers"`
+	Summary     map[string]int `json:"summary,omitempty"`
+	DecidedBy   *int           `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time     `json:"decided_at,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// blockerChecks find obligations that must be settled before a customer's
+// identity can be removed. Each query returns a count for customer $1.
+var blockerChecks = []struct {
+	Reason string
+	Query  string
+}{
+	{"accounts with a non-zero balance", "SELECT COUNT(*) FROM accounts WHERE customer_id = $1 AND balance <> 0"},
+	{"loans outstanding", "SELECT COUNT(*) FROM loans WHERE customer_id = $1 AND COALESCE(outstanding, 0) <> 0"},
+	{"active standing orders", "SELECT COUNT(*) FROM standing_orders WHERE customer_id = $1 AND status = 'active'"},
+}
+
+// mergedIDs selects the customers merged into customer $1, directly or
+// through an earlier merge. Their records describe the same person.
+const mergedIDs = `WITH RECURSIVE merged(id) AS (
+		SELECT id FROM customers WHERE status = 'merged' AND merged_into = $1
+		UNION SELECT c.id FROM customers c JOIN merged m ON c.merged_into = m.id WHERE c.status = 'merged')
+	SELECT id FROM merged`
+
+// pseudonymize are the statements that strip personal data for customer $1
+// and the records merged into it. Statements marked Named also take the
+// pseudonym as $2. Accounts, transactions, balances and ledger entries are
+// retained unchanged; they only reference the customer by id. Other
+// customers' payees for the customer's accounts keep the account number but
+// lose the holder name.
+var pseudonymize = []struct {
+	Name  string
+	Named bool
+	Query string
+}{
+	{"users", false, `UPDATE users SET email = 'erased-' || id || '@invalid', password_hash = ''
+		WHERE id = (SELECT user_id FROM customers WHERE id = $1)`},
+	{"customers", true, `UPDATE customers SET first_name = 'Erased', last_name = $2, email = NULL, mobile = NULL,
+		caf = jsonb_build_object('erased', true), status = 'erased', erased_at = now(),
+		email_bidx = NULL, mobile_bidx = NULL, search_bidx = NULL, pii_key_id = NULL,
+		email_verified = FALSE, mobile_verified = FALSE, version = version + 1, updated_at = now()
+		WHERE id = $1`},
+	{"merged_customers", false, `UPDATE customers SET first_name = 'Erased', last_name = 'Customer ' || id, email = NULL, mobile = NULL,
+		caf = jsonb_build_object('erased', true), erased_at = now(),
+		email_bidx = NULL, mobile_bidx = NULL, search_bidx = NULL, pii_key_id = NULL,
+		email_verified = FALSE, mobile_verified = FALSE, version = version + 1, updated_at = now()
+		WHERE id IN (` + mergedIDs + `)`},
+	{"merged_customer_history", false, `UPDATE customer_history SET first_name = 'Erased', last_name = 'Customer ' || customer_id,
+		email = NULL, mobile = NULL, caf = jsonb_build_object('erased', true)
+		WHERE customer_id IN (` + mergedIDs + `)`},
+	{"customer_history", true, `UPDATE customer_history SET first_name = 'Erased', last_name = $2, email = NULL, mobile = NULL,
+		caf = jsonb_build_object('erased', true) WHERE customer_id = $1`},
+	{"customer_verifications", false, `UPDATE customer_verifications SET target = 'erased',
+		status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END WHERE customer_id = $1`},
+	{"customer_merges", false, `UPDATE customer_merges SET merged_record = jsonb_build_object('id', merged_id, 'erased', true)
+		WHERE merged_id = $1 OR survivor_id = $1 OR merged_id IN (` + mergedIDs + `)`},
+	{"beneficiary_audit", false, `UPDATE beneficiary_audit SET before = NULL, after = NULL
+		WHERE beneficiary_id IN (SELECT id FROM beneficiaries WHERE customer_id = $1)`},
+	{"beneficiaries", false, `UPDATE beneficiaries SET nickname = 'erased', deleted_at = COALESCE(deleted_at, now())
+		WHERE customer_id = $1`},
+	{"payee_audit", false, `UPDATE beneficiary_audit SET
+		before = CASE WHEN before ? 'account_name' THEN jsonb_set(before, '{account_name}', '"Erased"') ELSE before END,
+		after = CASE WHEN after ? 'account_name' THEN jsonb_set(after, '{account_name}', '"Erased"') ELSE after END
+		WHERE beneficiary_id IN (SELECT b.id FROM beneficiaries b JOIN accounts a ON a.account_number = b.account_number
+			WHERE a.customer_id = $1)`},
+	{"payees", false, `UPDATE beneficiaries SET account_name = 'Erased'
+		WHERE account_name IS NOT NULL AND account_number IN (SELECT account_number FROM accounts WHERE customer_id = $1)`},
+	{"notifications", false, `UPDATE notifications SET payload = jsonb_build_object('customer_id', $1::int, 'erased', true)
+		WHERE payload->>'customer_id' = $1::text`},
+}
+
+// Pseudonym is the name left on an erased customer record.
+func Pseudonym(customerID int) string { return fmt.Sprintf("Customer %d", customerID) }
+
+// RequestErasure records an erasure request for a customer.
+func (s *Service) RequestErasure(customerID, actor int, reason string) (*ErasureRequest, error) {
+	e := &ErasureRequest{CustomerID: customerID, Status: StatusRequested, Reason: reason, RequestedBy: actor, Blockers: []string{}}
+	err := s.db.QueryRow(`INSERT INTO erasure_requests(customer_id, reason, requested_by)
+		SELECT id, $2, $3 FROM customers WHERE id = $1 AND status <> 'erased' RETURNING id, created_at`,
+		customerID, reason, actor).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetErasure returns an erasure request.
+func (s *Service) GetErasure(id int) (*ErasureRequest, error) {
+	e := &ErasureRequest{}
+	var summary []byte
+	var decidedBy sql.NullInt64
+	var decidedAt sql.NullTime
+	err := s.db.QueryRow(`SELECT id, customer_id, status, COALESCE(reason,''), COALESCE(requested_by,0), blockers, summary,
+			decided_by, decided_at, created_at
+		FROM erasure_requests WHERE id = $1`, id).
+		Scan(&e.ID, &e.CustomerID, &e.Status, &e.Reason, &e.RequestedBy, pq.Array(&e.Blockers), &summary,
+			&decidedBy, &decidedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(summary) > 0 {
+		if err := json.Unmarshal(summary, &e.Summary); err != nil {
+			return nil, err
+		}
+	}
+	if decidedBy.Valid {
+		v := int(decidedBy.Int64)
+		e.DecidedBy = &v
+	}
+	if decidedAt.Valid {
+		e.DecidedAt = &decidedAt.Time
+	}
+	return e, nil
+}
+
+// ExecuteErasure carries out a pending request. If the customer still has
+// obligations the request is rejected with the blockers listed; otherwise
+// their personal data is pseudonymized in one transaction.
+func (s *Service) ExecuteErasure(ctx context.Context, id, actor int) (*ErasureRequest, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var customerID int
+	var status string
+	if err := tx.QueryRowContext(ctx, "SELECT customer_id, status FROM erasure_requests WHERE id = $1 FOR UPDATE", id).
+		Scan(&customerID, &status); err != nil {
+		return nil, err
+	}
+	if status != StatusRequested {
+		return nil, ErrNotRequested
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT 1 FROM customers WHERE id = $1 FOR UPDATE", customerID); err != nil {
+		return nil, err
+	}
+	blockers := []string{}
+	for _, c := range blockerChecks {
+		var n int
+		if err := tx.QueryRowContext(ctx, c.Query, customerID).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			blockers = append(blockers, fmt.Sprintf("%d %s", n, c.Reason))
+		}
+	}
+	var summary map[string]int
+	status = StatusRejected
+	if len(blockers) == 0 {
+		status = StatusCompleted
+		summary = map[string]int{}
+		for _, p := range pseudonymize {
+			args := []interface{}{customerID}
+			if p.Named {
+				args = append(args, Pseudonym(customerID))
+			}
+			res, err := tx.ExecContext(ctx, p.Query, args...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Name, err)
+			}
+			n, _ := res.RowsAffected()
+			summary[p.Name] = int(n)
+		}
+	}
+	var summaryJSON interface{}
+	if summary != nil {
+		b, _ := json.Marshal(summary)
+		summaryJSON = b
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE erasure_requests SET status = $2, blockers = $3, summary = $4, decided_by = $5, decided_at = now()
+		WHERE id = $1`, id, status, pq.Array(blockers), summaryJSON, actor); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetErasure(id)
+}
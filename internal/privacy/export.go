@@ -0,0 +1,219 @@
+// Package privacy answers data subject requests: it exports everything the
+// bank holds about a customer and erases a customer's personal data by
+// pseudonymizing it, while keeping the accounts, transactions and ledger
+// entries the bank is required to retain.
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/pii"
+)
+
+// dataset is one file of an export. Query selects a single JSONB column per
+// row for customer $1. Sealed names the table whose field names the row's
+// encrypted values are bound to, if it has any.
+type dataset struct {
+	Name   string
+	Query  string
+	CSV    bool
+	Sealed string
+}
+
+// datasets lists everything exported about a customer.
+var datasets = []dataset{
+	{Name: "profile", Sealed: "customers", Query: `SELECT to_jsonb(c) - 'search_vector' - 'search_bidx' - 'email_bidx' - 'mobile_bidx'
+		FROM customers c WHERE c.id = $1`},
+	{Name: "user", Query: `SELECT jsonb_build_object('id', u.id, 'email', u.email, 'role', u.role, 'created_at', u.created_at)
+		FROM users u JOIN customers c ON c.user_id = u.id WHERE c.id = $1`},
+	{Name: "profile_history", Sealed: "customers", Query: `SELECT to_jsonb(h) FROM customer_history h WHERE h.customer_id = $1 ORDER BY h.version`},
+	{Name: "contact_verifications", Sealed: "customer_verifications", Query: `SELECT to_jsonb(v) FROM customer_verifications v WHERE v.customer_id = $1 ORDER BY v.id`},
+	{Name: "accounts", CSV: true, Query: `SELECT to_jsonb(a) FROM accounts a WHERE a.customer_id = $1 ORDER BY a.id`},
+	{Name: "transactions", CSV: true, Query: `SELECT to_jsonb(t) FROM transactions t
+		WHERE t.account_id IN (SELECT id FROM accounts WHERE customer_id = $1) ORDER BY t.id`},
+	{Name: "balance_snapshots", CSV: true, Query: `SELECT to_jsonb(s) FROM balance_snapshots s
+		WHERE s.account_id IN (SELECT id FROM accounts WHERE customer_id = $1) ORDER BY s.account_id, s.business_date`},
+	{Name: "loans", Query: `SELECT to_jsonb(l) FROM loans l WHERE l.customer_id = $1 ORDER BY l.id`},
+	{Name: "beneficiaries", Query: `SELECT to_jsonb(b) FROM beneficiaries b WHERE b.customer_id = $1 ORDER BY b.id`},
+	{Name: "beneficiary_audit", Query: `SELECT to_jsonb(x) FROM beneficiary_audit x
+		WHERE x.beneficiary_id IN (SELECT id FROM beneficiaries WHERE customer_id = $1) ORDER BY x.id`},
+	{Name: "standing_orders", Query: `SELECT to_jsonb(o) FROM standing_orders o WHERE o.customer_id = $1 ORDER BY o.id`},
+	{Name: "limit_increases", Query: `SELECT to_jsonb(i) FROM limit_increases i WHERE i.customer_id = $1 ORDER BY i.id`},
+	{Name: "duplicate_reviews", Query: `SELECT to_jsonb(d) FROM customer_duplicates d
+		WHERE d.customer_id = $1 OR d.candidate_id = $1 ORDER BY d.id`},
+	{Name: "merges", Query: `SELECT to_jsonb(m) FROM customer_merges m WHERE m.survivor_id = $1 OR m.merged_id = $1 ORDER BY m.id`},
+	{Name: "notifications", Query: `SELECT to_jsonb(n) FROM notifications n WHERE n.payload->>'customer_id' = $1::text ORDER BY n.id`},
+	{Name: "erasure_requests", Query: `SELECT to_jsonb(e) FROM erasure_requests e WHERE e.customer_id = $1 ORDER BY e.id`},
+}
+
+// Manifest describes the contents of an export archive.
+type Manifest struct {
+	CustomerID  int            `json:"customer_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Records     map[string]int `json:"records"`
+	Files       []string       `json:"files"`
+}
+
+// Service runs data subject requests against the database.
+type Service struct {
+	db     *sql.DB
+	cipher *pii.Cipher
+}
+
+// NewService creates a privacy service. The cipher opens encrypted personal
+// data for export and may be nil.
+func NewService(db *sql.DB, c *pii.Cipher) *Service { return &Service{db: db, cipher: c} }
+
+// Export writes a zip archive of everything held about a customer to w:
+// one JSON file per dataset, a CSV copy of the tabular financial records and
+// a manifest. It returns sql.ErrNoRows if the customer does not exist.
+func (s *Service) Export(ctx context.Context, customerID int, w io.Writer) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1)", customerID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	zw := zip.NewWriter(w)
+	m := &Manifest{CustomerID: customerID, GeneratedAt: time.Now().UTC(), Records: map[string]int{}}
+	for _, d := range datasets {
+		rows, err := s.load(ctx, d.Query, customerID)
+		if err == nil && d.Sealed != "" {
+			err = s.open(d.Sealed, rows)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Name, err)
+		}
+		m.Records[d.Name] = len(rows)
+		if err := writeFile(zw, d.Name+".json", func(f io.Writer) error {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(rows)
+		}); err != nil {
+			return err
+		}
+		m.Files = append(m.Files, d.Name+".json")
+		if d.CSV {
+			if err := writeFile(zw, d.Name+".csv", func(f io.Writer) error { return WriteCSV(f, rows) }); err != nil {
+				return err
+			}
+			m.Files = append(m.Files, d.Name+".csv")
+		}
+	}
+	if err := writeFile(zw, "manifest.json", func(f io.Writer) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (s *Service) load(ctx context.Context, query string, customerID int) ([]map[string]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []map[string]interface{}{}
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		rec := map[string]interface{}{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// open decrypts the sealed values of rows from table in place. A sealed
+// JSON column, such as caf, is parsed back into an object.
+func (s *Service) open(table string, rows []map[string]interface{}) error {
+	for _, rec := range rows {
+		for k, v := range rec {
+			sv, ok := v.(string)
+			if !ok || !pii.IsSealed(sv) {
+				continue
+			}
+			plain, err := s.cipher.Open(table+"."+k, sv)
+			if err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			var obj map[string]interface{}
+			if strings.HasPrefix(plain, "{") && json.Unmarshal([]byte(plain), &obj) == nil {
+				rec[k] = obj
+			} else {
+				rec[k] = plain
+			}
+		}
+	}
+	return nil
+}
+
+func writeFile(zw *zip.Writer, name string, fn func(io.Writer) error) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	return fn(f)
+}
+
+// WriteCSV writes records as CSV with one column per key, sorted by name.
+// Nested values are written as JSON.
+func WriteCSV(w io.Writer, records []map[string]interface{}) error {
+	seen := map[string]bool{}
+	var cols []string
+	for _, r := range records {
+		for k := range r {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	sort.Strings(cols)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := make([]string, len(cols))
+		for i, c := range cols {
+			switch v := r[c].(type) {
+			case nil:
+			case string:
+				row[i] = v
+			case json.Number:
+				row[i] = v.String()
+			case bool:
+				row[i] = fmt.Sprint(v)
+			default:
+				b, _ := json.Marshal(v)
+				row[i] = string(b)
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
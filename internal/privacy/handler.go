@@ -0,0 +1,119 @@
+package privacy
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for data subject requests.
+type Handler struct {
+	svc    *Service
+	owners auth.Owners
+}
+
+// NewHandler creates a privacy handler. owners resolves the login of the
+// customer a request is about.
+func NewHandler(s *Service, owners auth.Owners) *Handler { return &Handler{svc: s, owners: owners} }
+
+// Export handles GET /v1/privacy/export?customer_id= and returns a zip of
+// everything held about the customer. Admins or the customer only.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("customer_id"))
+	if err != nil || id <= 0 {
+		problem.Write(w, r, problem.Invalid(problem.Field("customer_id", "is required")))
+		return
+	}
+	if err := auth.AllowCustomer(r, h.owners, id, auth.RoleAdmin); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := h.svc.Export(r.Context(), id, &buf); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%d-export.zip"`, id))
+	w.Write(buf.Bytes())
+}
+
+// RequestErasure handles POST /v1/privacy/erasure with {"customer_id",
+// "reason"}. Staff or the customer may ask; an admin executes it.
+func (h *Handler) RequestErasure(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CustomerID int    `json:"customer_id" validate:"required,positive"`
+		Reason     string `json:"reason"`
+	}
+	if err := request.Decode(w, r, &req); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := auth.AllowCustomer(r, h.owners, req.CustomerID, auth.RoleTeller, auth.RoleAdmin); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	e, err := h.svc.RequestErasure(req.CustomerID, auth.UserID(r), req.Reason)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.New(http.StatusConflict, "already_erased", "customer already erased"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(e)
+}
+
+// GetErasure handles GET /v1/privacy/erasure/status?id=.
+func (h *Handler) GetErasure(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id <= 0 {
+		problem.Write(w, r, problem.Invalid(problem.Field("id", "is required")))
+		return
+	}
+	e, err := h.svc.GetErasure(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("erasure request not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := auth.AllowCustomer(r, h.owners, e.CustomerID, auth.RoleTeller, auth.RoleAdmin); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(e)
+}
+
+// ExecuteErasure handles POST /v1/privacy/erasure/execute with {"id"}. It
+// either completes the erasure or rejects it with the blockers found.
+// Admin only.
+func (h *Handler) ExecuteErasure(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID int `json:"id" validate:"required,positive"`
+	}
+	if err := request.Decode(w, r, &req); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	e, err := h.svc.ExecuteErasure(r.Context(), req.ID, auth.UserID(r))
+	switch {
+	case err == sql.ErrNoRows:
+		problem.Write(w, r, problem.NotFound("erasure request not found"))
+	case err != nil:
+		problem.Write(w, r, err)
+	default:
+		json.NewEncoder(w).Encode(e)
+	}
+}
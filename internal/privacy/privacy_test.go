@@ -0,0 +1,173 @@
+package privacy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/customer"
+	"github.com/example/real_time_core_banking_v9/internal/db"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestWriteCSV(t *testing.T) {
+	records := []map[string]interface{}{
+		{"id": json.Number("1000000"), "amount": json.Number("12.50"), "type": "deposit"},
+		{"id": json.Number("2"), "meta": map[string]interface{}{"k": "v"}, "flag": true},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, records); err != nil {
+		t.Fatal(err)
+	}
+	want := "amount,flag,id,meta,type\n12.50,,1000000,,deposit\n,true,2,\"{\"\"k\"\":\"\"v\"\"}\",\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestDatasetNamesUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, d := range datasets {
+		if seen[d.Name] {
+			t.Errorf("duplicate dataset %s", d.Name)
+		}
+		seen[d.Name] = true
+	}
+}
+
+// TestExecuteErasure checks the summary counts the rows each statement
+// changed, including the records merged into the customer.
+func TestExecuteErasure(t *testing.T) {
+	var args []driver.Value
+	rows := func(n int) [][]driver.Value { return make([][]driver.Value, n) }
+	now := time.Now()
+	s := NewService(sqltest.Open(
+		sqltest.Reply{Match: "FROM erasure_requests WHERE id = $1 FOR UPDATE", Cols: []string{"customer_id", "status"},
+			Rows: [][]driver.Value{{int64(1), StatusRequested}}},
+		sqltest.Reply{Match: "SELECT COUNT(*)", Cols: []string{"count"}, Rows: [][]driver.Value{{int64(0)}}},
+		sqltest.Reply{Match: "UPDATE customer_merges", Rows: rows(2)},
+		sqltest.Reply{Match: "UPDATE customers SET first_name = 'Erased', last_name = 'Customer ' || id", Rows: rows(2)},
+		sqltest.Reply{Match: "UPDATE customers", Rows: rows(1)},
+		sqltest.Reply{Match: "UPDATE erasure_requests", Args: &args},
+		sqltest.Reply{Match: "FROM erasure_requests", Cols: []string{"id", "customer_id", "status", "reason", "requested_by", "blockers", "summary",
+			"decided_by", "decided_at", "created_at"},
+			Rows: [][]driver.Value{{int64(1), int64(1), StatusCompleted, "", int64(7), "{}", nil, nil, nil, now}}},
+		sqltest.Reply{},
+	), nil)
+	if _, err := s.ExecuteErasure(context.Background(), 1, 9); err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 5 || args[1] != StatusCompleted {
+		t.Fatalf("args %v", args)
+	}
+	var summary map[string]int
+	if err := json.Unmarshal(args[3].([]byte), &summary); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"customers": 1, "merged_customers": 2, "customer_merges": 2, "payees": 0}
+	for name, n := range want {
+		if got, ok := summary[name]; !ok || got != n {
+			t.Errorf("summary[%s] = %d, want %d", name, got, n)
+		}
+	}
+}
+
+// TestExecuteErasurePostgres erases a customer with a merged duplicate and
+// a payee held by another customer, and reads the rows back. It needs
+// TEST_DATABASE_URL.
+func TestExecuteErasurePostgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// one connection, so the search path holds for every statement
+	conn.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("privacy_test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema + ", public"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec("DROP SCHEMA " + schema + " CASCADE")
+	if err := db.ExecMigrationsDir(conn, filepath.Join("..", "db", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`
+		INSERT INTO users(id, email, password_hash) VALUES (1, 'jane@example.com', 'hash');
+		INSERT INTO customers(id, user_id, first_name, last_name, email, mobile) VALUES
+			(1, 1, 'Jane', 'Doe', 'jane@example.com', '+15550100'),
+			(2, NULL, 'Jane', 'Doe', 'jd@example.com', '+15550101'),
+			(3, NULL, 'John', 'Roe', 'john@example.com', NULL);
+		UPDATE customers SET status = 'merged', merged_into = 1 WHERE id = 2;
+		INSERT INTO customer_merges(survivor_id, merged_id, merged_record, moved)
+			VALUES (1, 2, '{"id": 2, "first_name": "Jane", "email": "jd@example.com"}', '{}');
+		INSERT INTO accounts(id, customer_id, account_number, balance) VALUES (1, 1, 'ACC1', 0), (2, 3, 'ACC2', 10);
+		INSERT INTO transactions(account_id, amount, type) VALUES (1, 25, 'deposit');
+		INSERT INTO beneficiaries(customer_id, nickname, account_number, account_name, active_from)
+			VALUES (3, 'Sis', 'ACC1', 'Jane Doe', now());
+		INSERT INTO erasure_requests(id, customer_id, requested_by) VALUES (1, 1, 1)`); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewService(conn, nil).ExecuteErasure(context.Background(), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != StatusCompleted {
+		t.Fatalf("erasure %s: %v", e.Status, e.Blockers)
+	}
+	checks := []struct {
+		query, want string
+	}{
+		{"SELECT first_name || ' ' || last_name || ' ' || COALESCE(email, '-') FROM customers WHERE id = 1", "Erased Customer 1 -"},
+		{"SELECT first_name || ' ' || last_name || ' ' || COALESCE(email, '-') FROM customers WHERE id = 2", "Erased Customer 2 -"},
+		{"SELECT first_name || ' ' || last_name || ' ' || COALESCE(email, '-') FROM customers WHERE id = 3", "John Roe john@example.com"},
+		{"SELECT merged_record::text FROM customer_merges WHERE survivor_id = 1", `{"id": 2, "erased": true}`},
+		{"SELECT account_name FROM beneficiaries WHERE customer_id = 3", "Erased"},
+		{"SELECT email FROM users WHERE id = 1", "erased-1@invalid"},
+		{"SELECT amount::text FROM transactions WHERE account_id = 1", "25.00"},
+	}
+	for _, c := range checks {
+		var got string
+		if err := conn.QueryRow(c.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if got != c.want {
+			t.Errorf("%s = %q, want %q", c.query, got, c.want)
+		}
+	}
+}
+
+func TestGetErasureOwnerLookupError(t *testing.T) {
+	now := time.Now()
+	db := sqltest.Open(
+		sqltest.Reply{Match: "FROM erasure_requests", Cols: []string{"id", "customer_id", "status", "reason", "requested_by", "blockers", "summary",
+			"decided_by", "decided_at", "created_at"},
+			Rows: [][]driver.Value{{int64(1), int64(5), StatusRequested, "", int64(7), "{}", nil, nil, nil, now}}},
+		sqltest.Reply{Match: "SELECT user_id FROM customers", Err: errors.New("connection reset")},
+	)
+	h := NewHandler(NewService(db, nil), customer.NewRepo(db, nil))
+	req := httptest.NewRequest(http.MethodGet, "/v1/privacy/erasure/status?id=1", nil)
+	claims := jwt.MapClaims{"sub": float64(7), "role": auth.RoleUser}
+	rec := httptest.NewRecorder()
+	h.GetErasure(rec, req.WithContext(context.WithValue(req.Context(), "claims", claims)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,238 @@
+// Package problem writes API errors as RFC 7807 problem details
+// (application/problem+json). Domain packages return typed errors, either
+// an *Error or a type with a Problem method, and handlers pass every error
+// to Write, which picks the status code and a stable machine-readable code.
+// Anything unrecognised is logged and answered with a generic 500, so
+// driver and SQL messages never reach the client.
+package problem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+)
+
+// uniqueViolation is the Postgres error code for a duplicate key.
+const uniqueViolation = "23505"
+
+// ContentType is the media type of a problem body.
+const ContentType = "application/problem+json"
+
+// TypePrefix forms the type URI of a problem from its code.
+const TypePrefix = "urn:rtcb:problem:"
+
+// Stable error codes. Clients should switch on the code, not the detail.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeUnsupportedMedia     = "unsupported_media_type"
+	CodeTooLarge             = "request_too_large"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeInsufficientFunds    = "insufficient_funds"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Field returns a FieldError.
+func Field(field, message string) FieldError {
+	return FieldError{Field: field, Message: message}
+}
+
+// Error is a problem detail. Extra members, such as the breached limit,
+// are added to the body next to the standard ones.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+	Extra  map[string]interface{}
+	// Err is the underlying cause. It is logged, never sent.
+	Err error
+}
+
+// Problem is implemented by domain errors that carry their own problem
+// detail, such as a limit breach.
+type Problem interface {
+	Problem() *Error
+}
+
+// New returns a problem with the given status, code and detail.
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest is a malformed request, such as an unparseable body.
+func BadRequest(detail string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Invalid is a well-formed request with invalid fields.
+func Invalid(fields ...FieldError) *Error {
+	e := New(http.StatusUnprocessableEntity, CodeValidation, "the request has invalid fields")
+	e.Fields = fields
+	return e
+}
+
+// Unauthorized is a request without valid credentials.
+func Unauthorized(detail string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden is a request the caller's roles do not allow.
+func Forbidden(detail string) *Error {
+	if detail == "" {
+		detail = "you are not allowed to perform this action"
+	}
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound is a missing resource.
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// MethodNotAllowed is a request with a method the resource does not
+// support. The caller sets the Allow header.
+func MethodNotAllowed(allowed ...string) *Error {
+	return New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "use "+strings.Join(allowed, " or "))
+}
+
+// Conflict is a request that clashes with the resource's current state.
+func Conflict(detail string) *Error {
+	return New(http.StatusConflict, CodeConflict, detail)
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap returns a copy of e caused by err, so errors.Is matches both.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// Is matches another problem with the same status and code, so a copy made
+// by Wrap or WithDetail still matches its sentinel.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Status == e.Status && t.Code == e.Code
+}
+
+// WithDetail returns a copy of e with a different detail.
+func (e *Error) WithDetail(format string, args ...interface{}) *Error {
+	c := *e
+	c.Detail = fmt.Sprintf(format, args...)
+	return &c
+}
+
+// From converts err to a problem: an *Error or Problem anywhere in its
+// chain is used as is, sql.ErrNoRows is a 404, a unique constraint
+// violation a 409 and anything else a 500.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var p Problem
+	if errors.As(err, &p) {
+		return p.Problem()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("resource not found").Wrap(err)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return Conflict("a resource with the same key already exists").Wrap(err)
+	}
+	return New(http.StatusInternalServerError, CodeInternal, "an internal error occurred").Wrap(err)
+}
+
+// Write writes err as a problem detail. Server errors are logged with
+// their cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	if p.Status >= http.StatusInternalServerError {
+		logging.From(r.Context()).WithError(err).Error("request failed")
+	}
+	body := make(map[string]interface{}, len(p.Extra)+8)
+	for k, v := range p.Extra {
+		body[k] = v
+	}
+	body["type"] = TypePrefix + p.Code
+	body["title"] = http.StatusText(p.Status)
+	body["status"] = p.Status
+	body["code"] = p.Code
+	body["instance"] = r.URL.Path
+	if p.Detail != "" {
+		body["detail"] = p.Detail
+	}
+	if len(p.Fields) > 0 {
+		body["errors"] = p.Fields
+	}
+	if id := logging.RequestID(r.Context()); id != "" {
+		body["request_id"] = id
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Body is a decoded problem detail, for clients and tests.
+type Body struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Errors    []FieldError `json:"errors"`
+	RequestID string       `json:"request_id"`
+}
+
+// Fields collects field errors while checking a request.
+type Fields []FieldError
+
+// Add records message against field when bad is true.
+func (f *Fields) Add(bad bool, field, message string) {
+	if bad {
+		*f = append(*f, Field(field, message))
+	}
+}
+
+// Err returns the collected errors as an Invalid problem, or nil.
+func (f Fields) Err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return Invalid(f...)
+}
@@ -0,0 +1,115 @@
+package problem
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+)
+
+func write(t *testing.T, err error) (*httptest.ResponseRecorder, Body) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/v1/things", nil)
+	r = r.WithContext(logging.WithRequestID(r.Context(), "req-1"))
+	w := httptest.NewRecorder()
+	Write(w, r, err)
+	var b Body
+	if err := json.Unmarshal(w.Body.Bytes(), &b); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w, b
+}
+
+func TestWriteKnownErrors(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{sql.ErrNoRows, 404, CodeNotFound},
+		{fmt.Errorf("get account: %w", sql.ErrNoRows), 404, CodeNotFound},
+		{Forbidden(""), 403, CodeForbidden},
+		{New(http.StatusConflict, "not_mergeable", "x").Wrap(errors.New("cause")), 409, "not_mergeable"},
+	}
+	for _, c := range cases {
+		w, b := write(t, c.err)
+		if w.Code != c.status || b.Status != c.status || b.Code != c.code {
+			t.Errorf("%v: got %d %d %q, want %d %q", c.err, w.Code, b.Status, b.Code, c.status, c.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != ContentType {
+			t.Errorf("content type = %q", ct)
+		}
+		if b.Type != TypePrefix+c.code || b.Instance != "/v1/things" || b.RequestID != "req-1" {
+			t.Errorf("got %+v", b)
+		}
+	}
+}
+
+func TestWriteHidesInternalErrors(t *testing.T) {
+	w, b := write(t, errors.New(`pq: relation "accounts" does not exist`))
+	if w.Code != 500 || b.Code != CodeInternal {
+		t.Fatalf("got %d %q", w.Code, b.Code)
+	}
+	if strings.Contains(w.Body.String(), "relation") {
+		t.Errorf("body leaks cause: %s", w.Body.String())
+	}
+}
+
+func TestWriteFields(t *testing.T) {
+	var v Fields
+	v.Add(true, "amount", "must be positive")
+	v.Add(false, "narration", "is too long")
+	v.Add(true, "account_number", "is required")
+	w, b := write(t, v.Err())
+	if w.Code != http.StatusUnprocessableEntity || b.Code != CodeValidation {
+		t.Fatalf("got %d %q", w.Code, b.Code)
+	}
+	want := []FieldError{Field("amount", "must be positive"), Field("account_number", "is required")}
+	if fmt.Sprint(b.Errors) != fmt.Sprint(want) {
+		t.Errorf("errors = %v, want %v", b.Errors, want)
+	}
+	if (Fields{}).Err() != nil {
+		t.Error("empty Fields should be nil")
+	}
+}
+
+type breach struct{ limit float64 }
+
+func (b breach) Error() string { return "limit exceeded" }
+
+func (b breach) Problem() *Error {
+	e := New(http.StatusUnprocessableEntity, "limit_exceeded", "daily limit exceeded")
+	e.Extra = map[string]interface{}{"limit": b.limit}
+	return e
+}
+
+func TestWriteProblemExtra(t *testing.T) {
+	w, b := write(t, fmt.Errorf("withdraw: %w", breach{limit: 500}))
+	if b.Code != "limit_exceeded" {
+		t.Fatalf("code = %q", b.Code)
+	}
+	var raw map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &raw)
+	if raw["limit"] != 500.0 {
+		t.Errorf("limit = %v", raw["limit"])
+	}
+}
+
+func TestIsMatchesCopies(t *testing.T) {
+	sentinel := New(http.StatusConflict, "invalid_state", "order is not active")
+	if !errors.Is(sentinel.Wrap(sql.ErrTxDone), sentinel) || !errors.Is(sentinel.WithDetail("order %d", 7), sentinel) {
+		t.Error("copies should match their sentinel")
+	}
+	if !errors.Is(sentinel.Wrap(sql.ErrTxDone), sql.ErrTxDone) {
+		t.Error("wrapped cause should match")
+	}
+	if errors.Is(Conflict("x"), sentinel) {
+		t.Error("different code should not match")
+	}
+}
@@ -0,0 +1,237 @@
+// Package reconcile checks the integrity of the customer ledger: that
+// account balances agree with their journal, that transfer legs pair up and
+// net to zero, and that every referenced account exists.
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/trace"
+)
+
+// Check names.
+const (
+	CheckBalanceVsJournal = "balance_vs_journal"
+	CheckUnpairedLegs     = "unpaired_transfer_legs"
+	CheckOrphanRelated    = "orphan_related_account"
+	CheckJournalZeroSum   = "journal_zero_sum"
+)
+
+// Discrepancy is one integrity problem found by a check.
+type Discrepancy struct {
+	AccountID     int     `json:"account_id,omitempty"`
+	AccountNumber string  `json:"account_number,omitempty"`
+	TransactionID int     `json:"transaction_id,omitempty"`
+	JournalID     int64   `json:"journal_id,omitempty"`
+	Expected      float64 `json:"expected"`
+	Actual        float64 `json:"actual"`
+	Detail        string  `json:"detail"`
+}
+
+// CheckResult holds the outcome of one check.
+type CheckResult struct {
+	Name          string         `json:"name"`
+	Passed        bool           `json:"passed"`
+	Discrepancies []*Discrepancy `json:"discrepancies"`
+}
+
+// Report is the machine-readable output of a reconciliation run.
+type Report struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Passed      bool           `json:"passed"`
+	Checks      []*CheckResult `json:"checks"`
+}
+
+// Count returns the total number of discrepancies in the report.
+func (r *Report) Count() int {
+	n := 0
+	for _, c := range r.Checks {
+		n += len(c.Discrepancies)
+	}
+	return n
+}
+
+// Checker runs integrity checks against the database.
+type Checker struct{ db *sql.DB }
+
+// NewChecker creates a Checker.
+func NewChecker(db *sql.DB) *Checker { return &Checker{db: db} }
+
+// Run executes every check and returns the combined report.
+func (c *Checker) Run(ctx context.Context) (*Report, error) {
+	rep := &Report{GeneratedAt: time.Now().UTC(), Passed: true}
+	checks := []struct {
+		name string
+		fn   func(context.Context) ([]*Discrepancy, error)
+	}{
+		{CheckBalanceVsJournal, c.balanceVsJournal},
+		{CheckUnpairedLegs, c.unpairedLegs},
+		{CheckOrphanRelated, c.orphanRelated},
+		{CheckJournalZeroSum, c.journalZeroSum},
+	}
+	for _, ch := range checks {
+		ds, err := ch.fn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ch.name, err)
+		}
+		if ds == nil {
+			ds = []*Discrepancy{}
+		}
+		rep.Checks = append(rep.Checks, &CheckResult{Name: ch.name, Passed: len(ds) == 0, Discrepancies: ds})
+		if len(ds) > 0 {
+			rep.Passed = false
+		}
+	}
+	return rep, nil
+}
+
+// balanceVsJournal finds accounts whose stored balance differs from the sum
+// of their journal entries.
+func (c *Checker) balanceVsJournal(ctx context.Context) ([]*Discrepancy, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT a.id, a.account_number, COALESCE(SUM(`+account.SignedAmountSQL+`), 0) AS journal, a.balance
+		FROM accounts a LEFT JOIN transactions t ON t.account_id = a.id
+		GROUP BY a.id, a.account_number, a.balance
+		HAVING a.balance <> COALESCE(SUM(`+account.SignedAmountSQL+`), 0)
+		ORDER BY a.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{Detail: "account balance does not match the sum of its journal entries"}
+		if err := rows.Scan(&d.AccountID, &d.AccountNumber, &d.Expected, &d.Actual); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// unpairedLegs finds transfer legs without a matching opposite leg. Legs are
+// matched on journal id, or on their shared creation time for rows posted
+// before journal ids existed.
+func (c *Checker) unpairedLegs(ctx context.Context) ([]*Discrepancy, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT d.id, d.account_id, COALESCE(d.journal_id, 0), d.amount, d.type
+		FROM transactions d
+		WHERE d.type IN ('transfer_debit', 'transfer_credit') AND NOT EXISTS (
+			SELECT 1 FROM transactions c
+			WHERE c.type = CASE d.type WHEN 'transfer_debit' THEN 'transfer_credit' ELSE 'transfer_debit' END
+			  AND c.account_id = d.related_account_id AND c.related_account_id = d.account_id
+			  AND c.amount = d.amount
+			  AND (c.journal_id = d.journal_id OR (d.journal_id IS NULL AND c.created_at = d.created_at)))
+		ORDER BY d.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{}
+		var typ string
+		if err := rows.Scan(&d.TransactionID, &d.AccountID, &d.JournalID, &d.Expected, &typ); err != nil {
+			return nil, err
+		}
+		d.Detail = typ + " leg has no matching opposite leg"
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// orphanRelated finds entries whose related_account_id points at no account.
+func (c *Checker) orphanRelated(ctx context.Context) ([]*Discrepancy, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT t.id, t.account_id, t.related_account_id
+		FROM transactions t
+		WHERE COALESCE(t.related_account_id, 0) <> 0
+		  AND NOT EXISTS (SELECT 1 FROM accounts a WHERE a.id = t.related_account_id)
+		ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{}
+		var related int
+		if err := rows.Scan(&d.TransactionID, &d.AccountID, &related); err != nil {
+			return nil, err
+		}
+		d.Detail = fmt.Sprintf("related_account_id %d does not exist", related)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// journalZeroSum finds transfer journals whose legs do not net to zero.
+// Deposits, withdrawals and adjustments are single-legged against an
+// external counterparty and are not expected to balance on their own.
+func (c *Checker) journalZeroSum(ctx context.Context) ([]*Discrepancy, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT journal_id, SUM(`+account.SignedAmountSQL+`)
+		FROM transactions
+		WHERE journal_id IS NOT NULL AND type IN ('transfer_debit', 'transfer_credit')
+		GROUP BY journal_id
+		HAVING SUM(`+account.SignedAmountSQL+`) <> 0
+		ORDER BY journal_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Discrepancy
+	for rows.Next() {
+		d := &Discrepancy{Detail: "transfer journal does not net to zero"}
+		if err := rows.Scan(&d.JournalID, &d.Actual); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// Alert queues a reconciliation alert on the notifications list when the
+// report has discrepancies.
+func Alert(ctx context.Context, rdb *redis.Client, rep *Report) error {
+	if rep.Passed {
+		return nil
+	}
+	failed := map[string]int{}
+	for _, c := range rep.Checks {
+		if !c.Passed {
+			failed[c.Name] = len(c.Discrepancies)
+		}
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":          "reconciliation_alert",
+		"generated_at":  rep.GeneratedAt,
+		"discrepancies": rep.Count(),
+		"checks":        failed,
+		"traceparent":   trace.Inject(ctx),
+	})
+	return rdb.LPush(ctx, "notifications", b).Err()
+}
+
+// Job returns an EOD step body that reconciles the ledger and raises an
+// alert on discrepancies. Discrepancies are reported, not treated as a step
+// failure, so they never block the business date from closing.
+func Job(c *Checker, rdb *redis.Client) func(context.Context, time.Time) (interface{}, error) {
+	return func(ctx context.Context, _ time.Time) (interface{}, error) {
+		rep, err := c.Run(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := Alert(ctx, rdb, rep); err != nil {
+			return nil, err
+		}
+		return rep, nil
+	}
+}
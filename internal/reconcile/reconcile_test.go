@@ -0,0 +1,150 @@
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/db"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+// Each check's query, as matched by sqltest.
+const (
+	balanceQuery  = "FROM accounts a LEFT JOIN transactions"
+	unpairedQuery = "FROM transactions d"
+	orphanQuery   = "NOT EXISTS (SELECT 1 FROM accounts a"
+	zeroSumQuery  = "GROUP BY journal_id"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name  string
+		check string
+		reply sqltest.Reply
+		want  Discrepancy
+	}{
+		{"balance mismatch", CheckBalanceVsJournal,
+			sqltest.Reply{Match: balanceQuery, Cols: []string{"id", "account_number", "journal", "balance"},
+				Rows: [][]driver.Value{{int64(1), "ACC1", 50.0, 100.0}}},
+			Discrepancy{AccountID: 1, AccountNumber: "ACC1", Expected: 50, Actual: 100, Detail: "account balance does not match the sum of its journal entries"}},
+		{"unpaired transfer leg", CheckUnpairedLegs,
+			sqltest.Reply{Match: unpairedQuery, Cols: []string{"id", "account_id", "journal_id", "amount", "type"},
+				Rows: [][]driver.Value{{int64(7), int64(1), int64(42), 30.0, "transfer_debit"}}},
+			Discrepancy{TransactionID: 7, AccountID: 1, JournalID: 42, Expected: 30, Detail: "transfer_debit leg has no matching opposite leg"}},
+		{"orphaned row", CheckOrphanRelated,
+			sqltest.Reply{Match: orphanQuery, Cols: []string{"id", "account_id", "related_account_id"},
+				Rows: [][]driver.Value{{int64(9), int64(2), int64(999)}}},
+			Discrepancy{TransactionID: 9, AccountID: 2, Detail: "related_account_id 999 does not exist"}},
+		{"journal not netting to zero", CheckJournalZeroSum,
+			sqltest.Reply{Match: zeroSumQuery, Cols: []string{"journal_id", "sum"},
+				Rows: [][]driver.Value{{int64(42), -10.0}}},
+			Discrepancy{JournalID: 42, Actual: -10, Detail: "transfer journal does not net to zero"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			replies := []sqltest.Reply{c.reply}
+			for _, q := range []string{balanceQuery, unpairedQuery, orphanQuery, zeroSumQuery} {
+				replies = append(replies, sqltest.Reply{Match: q})
+			}
+			rep, err := NewChecker(sqltest.Open(replies...)).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Passed || rep.Count() != 1 {
+				t.Fatalf("passed %v with %d discrepancies", rep.Passed, rep.Count())
+			}
+			for _, ch := range rep.Checks {
+				if ch.Passed != (ch.Name != c.check) {
+					t.Errorf("check %s passed = %v", ch.Name, ch.Passed)
+				}
+				if ch.Name == c.check && *ch.Discrepancies[0] != c.want {
+					t.Errorf("got %+v, want %+v", *ch.Discrepancies[0], c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunConsistentLedger(t *testing.T) {
+	var replies []sqltest.Reply
+	for _, q := range []string{balanceQuery, unpairedQuery, orphanQuery, zeroSumQuery} {
+		replies = append(replies, sqltest.Reply{Match: q})
+	}
+	rep, err := NewChecker(sqltest.Open(replies...)).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Passed || len(rep.Checks) != 4 || rep.Checks[0].Discrepancies == nil {
+		t.Fatalf("report %+v", rep)
+	}
+}
+
+// TestChecksPostgres seeds each kind of discrepancy into a scratch schema
+// and runs the real queries. It needs TEST_DATABASE_URL.
+func TestChecksPostgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	conn, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// one connection, so the search path holds for every statement
+	conn.SetMaxOpenConns(1)
+	schema := fmt.Sprintf("reconcile_test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec("CREATE SCHEMA " + schema + "; SET search_path TO " + schema + ", public"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec("DROP SCHEMA " + schema + " CASCADE")
+	if err := db.ExecMigrationsDir(conn, filepath.Join("..", "db", "migrations")); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name  string
+		seed  string
+		check string
+	}{
+		{"balance mismatch", `
+			INSERT INTO accounts(id, account_number, balance) VALUES (1, 'ACC1', 100);
+			INSERT INTO transactions(account_id, amount, type) VALUES (1, 50, 'deposit')`,
+			CheckBalanceVsJournal},
+		{"broken double entry", `
+			INSERT INTO accounts(id, account_number, balance) VALUES (1, 'ACC1', -30), (2, 'ACC2', 20);
+			INSERT INTO transactions(account_id, related_account_id, amount, type, journal_id) VALUES
+				(1, 2, 30, 'transfer_debit', 42), (2, 1, 20, 'transfer_credit', 42)`,
+			CheckUnpairedLegs},
+		{"orphaned row", `
+			INSERT INTO accounts(id, account_number, balance) VALUES (1, 'ACC1', 10);
+			INSERT INTO transactions(account_id, related_account_id, amount, type) VALUES (1, 999, 10, 'deposit')`,
+			CheckOrphanRelated},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := conn.Exec("TRUNCATE transactions, accounts CASCADE; " + c.seed); err != nil {
+				t.Fatal(err)
+			}
+			rep, err := NewChecker(conn).Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, ch := range rep.Checks {
+				if ch.Name == c.check && ch.Passed {
+					t.Errorf("%s did not report the %s", ch.Name, c.name)
+				}
+			}
+			if rep.Passed {
+				t.Error("report passed")
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+// Package redact keeps credentials and personal data out of the logs.
+// Installed on a logrus logger it scrubs every entry before it is written:
+// fields are redacted by key name, messages have bearer tokens, JWTs,
+// e-mail addresses and sensitive JSON or key=value pairs replaced, and
+// Value turns a struct into a loggable copy redacted by field tag or name.
+//
+// Secrets are replaced outright, account numbers keep their last four
+// characters and personal data is masked or replaced.
+package redact
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/mask"
+)
+
+// Redacted replaces a secret or personal value.
+const Redacted = "[REDACTED]"
+
+// Kinds of sensitive data, also accepted in a `redact:"..."` struct tag.
+// The tag "-" leaves a field as it is.
+const (
+	KindSecret  = "secret"
+	KindAccount = "account"
+	KindEmail   = "email"
+	KindPhone   = "phone"
+	KindPII     = "pii"
+)
+
+// keys maps normalized key names to the kind of data they hold.
+var keys = map[string]string{
+	"authorization": KindSecret, "token": KindSecret, "accesstoken": KindSecret, "refreshtoken": KindSecret,
+	"jwt": KindSecret, "password": KindSecret, "passwordhash": KindSecret, "secret": KindSecret,
+	"apikey": KindSecret, "cookie": KindSecret, "setcookie": KindSecret,
+
+	"accountnumber": KindAccount, "relatedaccountnumber": KindAccount, "fromaccount": KindAccount,
+	"toaccount": KindAccount, "from": KindAccount, "to": KindAccount, "counterparty": KindAccount, "iban": KindAccount,
+
+	"email": KindEmail, "mobile": KindPhone, "phone": KindPhone,
+
+	"firstname": KindPII, "lastname": KindPII, "name": KindPII, "accountname": KindPII, "holder": KindPII,
+	"nationalid": KindPII, "passportnumber": KindPII, "taxid": KindPII, "dateofbirth": KindPII,
+	"address": KindPII, "target": KindPII, "caf": KindPII, "kyc": KindPII,
+}
+
+// normalize folds a key such as "Account-Number" or "account_number" to
+// "accountnumber".
+func normalize(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+// KindOf returns the kind of data held under key, or "" if it is not
+// sensitive.
+func KindOf(key string) string { return keys[normalize(key)] }
+
+// Apply redacts v as data of the given kind. An unknown kind returns v.
+func Apply(kind, v string) string {
+	switch kind {
+	case KindSecret, KindPII:
+		if v == "" {
+			return v
+		}
+		return Redacted
+	case KindAccount:
+		return mask.AccountNumber(v)
+	case KindEmail:
+		return mask.Email(v)
+	case KindPhone:
+		return mask.Tail(v, 4)
+	}
+	return v
+}
+
+// Key redacts v according to the name it is logged under.
+func Key(key, v string) string { return Apply(KindOf(key), v) }
+
+var (
+	bearerRE = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`)
+	jwtRE    = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	emailRE  = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// "key": "value" in JSON and key=value or key: value in text
+	jsonPairRE = regexp.MustCompile(`"([A-Za-z_\-]+)"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+	textPairRE = regexp.MustCompile(`\b([A-Za-z_\-]+)\s*[=:]\s*([^\s,;&"})\]]+)`)
+)
+
+// String scrubs free text: bearer and basic credentials, JWTs, sensitive
+// JSON and key=value pairs and e-mail addresses.
+func String(s string) string {
+	s = bearerRE.ReplaceAllString(s, "${1} "+Redacted)
+	s = jwtRE.ReplaceAllString(s, Redacted)
+	s = jsonPairRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := jsonPairRE.FindStringSubmatch(m)
+		kind := KindOf(sub[1])
+		if kind == "" {
+			return m
+		}
+		return `"` + sub[1] + `":"` + Apply(kind, sub[2]) + `"`
+	})
+	s = textPairRE.ReplaceAllStringFunc(s, func(m string) string {
+		sub := textPairRE.FindStringSubmatch(m)
+		kind := KindOf(sub[1])
+		if kind == "" || sub[2] == Redacted {
+			return m
+		}
+		return strings.TrimSuffix(m, sub[2]) + Apply(kind, sub[2])
+	})
+	return emailRE.ReplaceAllStringFunc(s, mask.Email)
+}
+
+// Value returns a copy of v that is safe to log. Structs become maps keyed
+// by their JSON field names, and string fields are redacted by their
+// `redact` tag, or failing that by their name. Maps are redacted by key.
+func Value(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return value(reflect.ValueOf(v), "")
+}
+
+func value(v reflect.Value, kind string) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return value(v.Elem(), kind)
+	case reflect.String:
+		if kind == "" {
+			return String(v.String())
+		}
+		return Apply(kind, v.String())
+	case reflect.Struct:
+		// values such as time.Time log through their own formatting
+		if _, ok := v.Interface().(fmt.Stringer); ok {
+			return v.Interface()
+		}
+		out := map[string]interface{}{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			k := f.Tag.Get("redact")
+			switch k {
+			case "-":
+				out[name] = v.Field(i).Interface()
+				continue
+			case "":
+				k = KindOf(name)
+			}
+			if k == KindSecret || k == KindPII {
+				if !v.Field(i).IsZero() {
+					out[name] = Redacted
+				}
+				continue
+			}
+			out[name] = value(v.Field(i), k)
+		}
+		return out
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := map[string]interface{}{}
+		for _, k := range v.MapKeys() {
+			kk := KindOf(k.String())
+			if (kk == KindSecret || kk == KindPII) && !v.MapIndex(k).IsZero() {
+				out[k.String()] = Redacted
+				continue
+			}
+			out[k.String()] = value(v.MapIndex(k), kk)
+		}
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return String(string(v.Bytes()))
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = value(v.Index(i), kind)
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// Fields converts v with Value into logrus fields.
+func Fields(v interface{}) logrus.Fields {
+	m, _ := Value(v).(map[string]interface{})
+	return logrus.Fields(m)
+}
+
+// Formatter redacts entries before passing them to the next formatter.
+type Formatter struct{ Next logrus.Formatter }
+
+// Format implements logrus.Formatter.
+func (f *Formatter) Format(e *logrus.Entry) ([]byte, error) {
+	c := *e
+	c.Message = String(e.Message)
+	c.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		switch x := v.(type) {
+		case error:
+			if k == logrus.ErrorKey {
+				c.Data[k] = String(x.Error())
+			} else {
+				c.Data[k] = Key(k, String(x.Error()))
+			}
+		case string:
+			if kind := KindOf(k); kind != "" {
+				c.Data[k] = Apply(kind, x)
+			} else {
+				c.Data[k] = String(x)
+			}
+		case int, int64, float64, bool:
+			c.Data[k] = v
+		default:
+			if kind := KindOf(k); kind == KindSecret || kind == KindPII {
+				c.Data[k] = Redacted
+			} else {
+				c.Data[k] = Value(v)
+			}
+		}
+	}
+	return f.Next.Format(&c)
+}
+
+// Install makes l redact every entry, wrapping its current formatter. Call
+// it after setting the formatter.
+func Install(l *logrus.Logger) {
+	if _, ok := l.Formatter.(*Formatter); ok {
+		return
+	}
+	l.SetFormatter(&Formatter{Next: l.Formatter})
+}
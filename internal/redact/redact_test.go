@@ -0,0 +1,91 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const token = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOjF9.c2lnbmF0dXJlLXNlY3JldA"
+
+func capture(t *testing.T) (*logrus.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	Install(l)
+	return l, &buf
+}
+
+func TestTokenNeverLogged(t *testing.T) {
+	l, buf := capture(t)
+	type login struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Session  string `json:"session" redact:"secret"`
+	}
+	l.Infof("header: %v", "Bearer "+token)
+	l.Infof("parts: %v", []string{"Bearer", token})
+	l.Infof("payload %s", `{"type":"login","token":"`+token+`"}`)
+	l.Infof("url /v1/callback?token=%s&x=1", token)
+	l.WithField("authorization", "Bearer "+token).Info("request")
+	l.WithField("claims", map[string]interface{}{"jwt": token}).Info("claims")
+	l.WithError(errors.New("parse " + token + ": expired")).Warn("auth")
+	l.WithFields(Fields(login{Email: "jane@example.com", Password: "hunter22", Session: token})).Info("login")
+	out := buf.String()
+	for _, secret := range []string{token, "c2lnbmF0dXJlLXNlY3JldA", "hunter22", "jane@"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output contains %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestAccountNumbersAndPII(t *testing.T) {
+	l, buf := capture(t)
+	type account struct {
+		CustomerID    int     `json:"customer_id"`
+		AccountNumber string  `json:"account_number"`
+		Balance       float64 `json:"balance"`
+	}
+	l.WithFields(Fields(account{CustomerID: 7, AccountNumber: "ACC0012345678", Balance: 10})).Info("create")
+	l.WithField("from", "ACC0099998888").Info("transfer")
+	l.Infof("processing notification: %s", `{"type":"contact_verification","target":"+15551234567","first_name":"Jane"}`)
+	l.Infof("CreateAccount %v", map[string]string{"account_number": "ACC0077776666"})
+	out := buf.String()
+	for _, leaked := range []string{"ACC0012345678", "ACC0099998888", "ACC0077776666", "+15551234567", "Jane"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("log output contains %q:\n%s", leaked, out)
+		}
+	}
+	for _, kept := range []string{"*********5678", "*********8888", "*********6666", `"customer_id":7`, "contact_verification"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("log output lacks %q:\n%s", kept, out)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	type inner struct {
+		Mobile string
+		Note   string `redact:"-"`
+	}
+	got := Value(struct {
+		Name  string `json:"name"`
+		Inner *inner `json:"inner"`
+		Skip  string `json:"-"`
+	}{"Jane Doe", &inner{Mobile: "+15551234567", Note: "Jane"}, "x"}).(map[string]interface{})
+	if got["name"] != Redacted {
+		t.Errorf("name = %v", got["name"])
+	}
+	in := got["inner"].(map[string]interface{})
+	if in["Mobile"] != "********4567" || in["Note"] != "Jane" {
+		t.Errorf("inner = %v", in)
+	}
+	if _, ok := got["-"]; ok {
+		t.Error("json:\"-\" field logged")
+	}
+}
@@ -0,0 +1,149 @@
+// Package request decodes and validates JSON request bodies. Decode
+// enforces the content type, a size limit, known fields and a single JSON
+// value, then checks the `validate` struct tags of the result, so handlers
+// get either a valid request or a problem ready for problem.Write.
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// MaxBodyBytes caps the size of a request body.
+const MaxBodyBytes = 1 << 20
+
+// Param returns the path wildcard name of r, falling back to the query
+// parameter query for the legacy routes that pass it there.
+func Param(r *http.Request, name, query string) string {
+	if v := r.PathValue(name); v != "" {
+		return v
+	}
+	return r.URL.Query().Get(query)
+}
+
+// PathID returns the integer path wildcard name of r, or 0 on a legacy
+// route without it. A value that is not a positive integer names no
+// resource, so it is a not found problem.
+func PathID(r *http.Request, name string) (int, error) {
+	v := r.PathValue(name)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil || id <= 0 {
+		return 0, problem.NotFound("no resource with " + name + " " + strconv.Quote(v))
+	}
+	return id, nil
+}
+
+// DecodeFor decodes the body of a request acting on the resource named by
+// the integer path wildcard "id". *id is prefilled from the path, so the
+// body may omit it, and a body naming another id is refused. On a legacy
+// route without the wildcard the id comes from the body alone.
+func DecodeFor(w http.ResponseWriter, r *http.Request, dst interface{}, id *int) error {
+	path, err := PathID(r, "id")
+	if err != nil {
+		return err
+	}
+	*id = path
+	if err := Decode(w, r, dst); err != nil {
+		return err
+	}
+	if path != 0 && *id != path {
+		return problem.Invalid(problem.Field("id", "must match the id in the path"))
+	}
+	return nil
+}
+
+// ID returns the id of the resource a bodiless action applies to: the
+// path wildcard "id", or on a legacy route the "id" field of the body.
+func ID(w http.ResponseWriter, r *http.Request) (int, error) {
+	if id, err := PathID(r, "id"); id != 0 || err != nil {
+		return id, err
+	}
+	var rr struct {
+		ID int `json:"id" validate:"required,positive"`
+	}
+	if err := Decode(w, r, &rr); err != nil {
+		return 0, err
+	}
+	return rr.ID, nil
+}
+
+// Decode reads the JSON body of r into dst and validates it. The body must
+// be application/json (or another +json type), at most MaxBodyBytes, a
+// single value and contain only fields dst declares.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	ct := r.Header.Get("Content-Type")
+	if mt, _, err := mime.ParseMediaType(ct); err != nil || (mt != "application/json" && !strings.HasSuffix(mt, "+json")) {
+		return problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, "the request body must be application/json")
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return problem.BadRequest("the request body must contain a single JSON object")
+	}
+	return Validate(dst)
+}
+
+// unknownField prefixes the error encoding/json returns for a field dst
+// does not declare; the package has no type for it.
+const unknownField = "json: unknown field "
+
+// decodeError turns a json decoding error into a problem, naming the field
+// where it can.
+func decodeError(err error) error {
+	var (
+		syntax   *json.SyntaxError
+		typ      *json.UnmarshalTypeError
+		tooLarge *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return problem.New(http.StatusRequestEntityTooLarge, problem.CodeTooLarge,
+			fmt.Sprintf("the request body must not exceed %d bytes", tooLarge.Limit)).Wrap(err)
+	case errors.Is(err, io.EOF):
+		return problem.BadRequest("the request body is empty")
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return problem.BadRequest("the request body is not valid JSON").Wrap(err)
+	case errors.As(err, &typ):
+		if typ.Field == "" {
+			return problem.BadRequest("the request body must be " + jsonType(typ.Type.Kind().String())).Wrap(err)
+		}
+		return problem.Invalid(problem.Field(typ.Field, "must be "+jsonType(typ.Type.Kind().String())))
+	case strings.HasPrefix(err.Error(), unknownField):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), unknownField), `"`)
+		return problem.Invalid(problem.Field(name, "is not a known field"))
+	}
+	return problem.BadRequest("the request body could not be decoded").Wrap(err)
+}
+
+// jsonType names a Go kind the way a client sees it, with its article.
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "bool":
+		return "a boolean"
+	case kind == "slice", kind == "array":
+		return "a list"
+	case kind == "map", kind == "struct":
+		return "an object"
+	}
+	return "a " + kind
+}
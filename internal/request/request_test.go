@@ -0,0 +1,157 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+type deposit struct {
+	AccountNumber string  `json:"account_number" validate:"required,max=10"`
+	Amount        float64 `json:"amount" validate:"required,positive"`
+	Direction     string  `json:"direction" validate:"oneof=credit debit"`
+}
+
+func decode(body, contentType string) (*deposit, *problem.Error) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/accounts/deposit", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	var d deposit
+	if err := Decode(httptest.NewRecorder(), r, &d); err != nil {
+		return nil, problem.From(err)
+	}
+	return &d, nil
+}
+
+func TestDecode(t *testing.T) {
+	d, p := decode(`{"account_number": "ACC1", "amount": 10}`, "application/json; charset=utf-8")
+	if p != nil || d.AccountNumber != "ACC1" || d.Amount != 10 {
+		t.Fatalf("got %+v, %v", d, p)
+	}
+	cases := []struct {
+		body, contentType string
+		status            int
+		field             string
+	}{
+		{`{"account_number": "ACC1", "amount": 10}`, "", 415, ""},
+		{`account_number=ACC1`, "application/x-www-form-urlencoded", 415, ""},
+		{``, "application/json", 400, ""},
+		{`{"account_number": `, "application/json", 400, ""},
+		{`{"account_number": "ACC1", "amount": 10} {}`, "application/json", 400, ""},
+		{`[]`, "application/json", 400, ""},
+		{`{"account_number": "ACC1", "amount": "ten"}`, "application/json", 422, "amount"},
+		{`{"account_number": "ACC1", "amount": 10, "memo": "x"}`, "application/json", 422, "memo"},
+		{`{"account_number": "ACC1", "amount": -1}`, "application/json", 422, "amount"},
+		{`{"account_number": "` + strings.Repeat("9", MaxBodyBytes) + `"}`, "application/json", 413, ""},
+	}
+	for _, c := range cases {
+		_, p := decode(c.body, c.contentType)
+		if p == nil {
+			t.Errorf("%.40q: no error", c.body)
+			continue
+		}
+		if p.Status != c.status {
+			t.Errorf("%.40q: status %d, want %d (%v)", c.body, p.Status, c.status, p)
+		}
+		if c.field != "" && (len(p.Fields) != 1 || p.Fields[0].Field != c.field) {
+			t.Errorf("%.40q: fields %v, want %s", c.body, p.Fields, c.field)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type customer struct {
+		Name    string            `json:"name" validate:"required,min=2,max=5"`
+		Email   string            `json:"email" validate:"email"`
+		Mobile  string            `json:"mobile" validate:"e164"`
+		Age     int               `json:"age" validate:"min=18"`
+		Tags    []string          `json:"tags" validate:"max=1"`
+		Nick    *string           `json:"nick" validate:"required"`
+		Address address           `json:"address"`
+		KYC     map[string]string `json:"kyc"`
+	}
+	err := Validate(&customer{Name: "Annabel", Email: "Ann <ann@example.com>", Mobile: "0712345678", Age: 17, Tags: []string{"a", "b"}})
+	want := []problem.FieldError{
+		problem.Field("name", "must be at most 5 characters"),
+		problem.Field("email", "must be an email address"),
+		problem.Field("mobile", "must be in E.164 format, e.g. +14155550100"),
+		problem.Field("age", "must be at least 18"),
+		problem.Field("tags", "must have at most 1 item"),
+		problem.Field("nick", "is required"),
+		problem.Field("address.city", "is required"),
+	}
+	if p := problem.From(err); fmt.Sprint(p.Fields) != fmt.Sprint(want) {
+		t.Errorf("got %v\nwant %v", p.Fields, want)
+	}
+	nick := "an"
+	ok := customer{Name: "Ann", Email: "ann@example.com", Mobile: "+14155550100", Nick: &nick, Address: address{City: "Pune"}}
+	if err := Validate(&ok); err != nil {
+		t.Errorf("valid customer: %v", err)
+	}
+	if err := Validate(&deposit{AccountNumber: "A", Amount: 1, Direction: "sideways"}); err == nil {
+		t.Error("expected oneof error")
+	}
+}
+
+func TestParam(t *testing.T) {
+	mux := http.NewServeMux()
+	var got []string
+	h := func(w http.ResponseWriter, r *http.Request) { got = append(got, Param(r, "number", "account_number")) }
+	mux.HandleFunc("GET /v1/accounts/{number}/balance", h)
+	mux.HandleFunc("GET /v1/accounts/balance", h)
+	for _, target := range []string{"/v1/accounts/ACC1/balance", "/v1/accounts/balance?account_number=ACC2"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	if fmt.Sprint(got) != "[ACC1 ACC2]" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestDecodeFor(t *testing.T) {
+	type rename struct {
+		ID       int    `json:"id" validate:"required,positive"`
+		Nickname string `json:"nickname" validate:"required"`
+	}
+	mux := http.NewServeMux()
+	var got rename
+	var gotErr error
+	h := func(w http.ResponseWriter, r *http.Request) {
+		got = rename{}
+		gotErr = DecodeFor(w, r, &got, &got.ID)
+	}
+	mux.HandleFunc("PATCH /v1/beneficiaries/{id}", h)
+	mux.HandleFunc("POST /v1/beneficiaries/update", h)
+	cases := []struct {
+		method, target, body string
+		id                   int
+		status               int
+	}{
+		{http.MethodPatch, "/v1/beneficiaries/3", `{"nickname":"Mum"}`, 3, 0},
+		{http.MethodPatch, "/v1/beneficiaries/3", `{"id":3,"nickname":"Mum"}`, 3, 0},
+		{http.MethodPatch, "/v1/beneficiaries/3", `{"id":4,"nickname":"Mum"}`, 0, http.StatusUnprocessableEntity},
+		{http.MethodPatch, "/v1/beneficiaries/x", `{"nickname":"Mum"}`, 0, http.StatusNotFound},
+		{http.MethodPost, "/v1/beneficiaries/update", `{"id":5,"nickname":"Mum"}`, 5, 0},
+		{http.MethodPost, "/v1/beneficiaries/update", `{"nickname":"Mum"}`, 0, http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+		var p *problem.Error
+		switch {
+		case c.status == 0 && (gotErr != nil || got.ID != c.id):
+			t.Errorf("%s %s: id %d, err %v", c.method, c.body, got.ID, gotErr)
+		case c.status != 0 && (!errors.As(gotErr, &p) || p.Status != c.status):
+			t.Errorf("%s %s %s: err %v, want status %d", c.method, c.target, c.body, gotErr, c.status)
+		}
+	}
+}
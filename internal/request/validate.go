@@ -0,0 +1,168 @@
+package request
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Validate checks the `validate` tags of the struct v points to and returns
+// an Invalid problem listing every failing field by its JSON name. Rules
+// are comma separated:
+//
+//	required     the value is not zero; a pointer is not nil
+//	min=n, max=n a number's value, or the length of a string, list or map
+//	positive     a number is greater than zero
+//	oneof=a b c  a string is one of the listed words
+//	email        a string is a bare email address
+//	e164         a string is a phone number in E.164 format
+//
+// Rules other than required pass for zero values, so optional fields are
+// only checked when given. Nested structs are checked with dotted names.
+// An unknown rule is a programming error and panics.
+func Validate(v interface{}) error {
+	var f problem.Fields
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Struct {
+		check(&f, rv, "")
+	}
+	return f.Err()
+}
+
+// E164 matches a phone number in E.164 format, such as +14155550100.
+var E164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func check(f *problem.Fields, rv reflect.Value, prefix string) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, fv := jsonName(sf), rv.Field(i)
+		if name == "-" {
+			continue
+		}
+		if sf.Anonymous && fv.Kind() == reflect.Struct {
+			check(f, fv, prefix)
+			continue
+		}
+		name = prefix + name
+		if msg := checkField(fv, sf.Tag.Get("validate")); msg != "" {
+			*f = append(*f, problem.Field(name, msg))
+			continue
+		}
+		if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+			check(f, fv, name+".")
+		}
+	}
+}
+
+// jsonName is the name encoding/json gives the field.
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// checkField applies the rules in tag to v and returns the message of the
+// first that fails, or "".
+func checkField(v reflect.Value, tag string) string {
+	if tag == "" {
+		return ""
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if v.IsZero() {
+				return "is required"
+			}
+			continue
+		}
+		if v.IsZero() {
+			continue
+		}
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if msg := apply(v, name, arg); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func apply(v reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("request: bad %s=%q", name, arg))
+		}
+		got, verb, noun := measure(v, name)
+		if arg == "1" {
+			noun = strings.TrimSuffix(noun, "s")
+		}
+		switch {
+		case name == "min" && got < n:
+			return fmt.Sprintf("must %s at least %s%s", verb, arg, noun)
+		case name == "max" && got > n:
+			return fmt.Sprintf("must %s at most %s%s", verb, arg, noun)
+		}
+	case "positive":
+		if n, _, _ := measure(v, name); n <= 0 {
+			return "must be positive"
+		}
+	case "oneof":
+		words := strings.Fields(arg)
+		for _, w := range words {
+			if v.String() == w {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(words, ", ")
+	case "email":
+		if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+			return "must be an email address"
+		}
+	case "e164":
+		if !E164.MatchString(v.String()) {
+			return "must be in E.164 format, e.g. +14155550100"
+		}
+	default:
+		panic("request: unknown rule " + name)
+	}
+	return ""
+}
+
+// measure returns what min and max compare for v: a number's value or a
+// string's, list's or map's length, with the verb and unit that describe
+// it in a message.
+func measure(v reflect.Value, rule string) (float64, string, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "be", ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "be", ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "be", ""
+	case reflect.String:
+		return float64(len([]rune(v.String()))), "be", " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), "have", " items"
+	}
+	panic(fmt.Sprintf("request: %s on %s", rule, v.Kind()))
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// OpenAPI returns an OpenAPI 3 document describing the registered routes:
+// their path parameters, whether they need a bearer token, the roles that
+// may call them (as x-roles) and the problem responses they can return.
+func (rt *Router) OpenAPI(title, version string) map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, route := range rt.routes {
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"responses":   responses(route),
+		}
+		if route.Tag != "" {
+			op["tags"] = []string{route.Tag}
+		}
+		if params := pathParams(route.Path); len(params) > 0 {
+			op["parameters"] = params
+		}
+		if !route.Public {
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+		if len(route.Roles) > 0 {
+			op["x-roles"] = route.Roles
+		}
+		if route.Successor != "" {
+			op["deprecated"] = true
+			op["description"] = "Replaced by " + route.Successor + "."
+		}
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]interface{}{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+			"schemas": map[string]interface{}{"Problem": problemSchema},
+		},
+	}
+}
+
+// OpenAPIHandler serves the document as JSON. It is built on first
+// request, after every route has been registered.
+func (rt *Router) OpenAPIHandler(title, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rt.OpenAPI(title, version))
+	}
+}
+
+// pathParams lists the {name} wildcards of path as OpenAPI parameters.
+func pathParams(path string) []map[string]interface{} {
+	var params []map[string]interface{}
+	for _, seg := range strings.Split(path, "/") {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") || seg == "{$}" {
+			continue
+		}
+		params = append(params, map[string]interface{}{
+			"name":     strings.TrimSuffix(strings.Trim(seg, "{}"), "..."),
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]string{"type": "string"},
+		})
+	}
+	return params
+}
+
+// operationID derives a stable id such as getAccountsNumberTransactions.
+func operationID(route Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(route.Method))
+	for _, seg := range strings.Split(route.Path, "/") {
+		seg = strings.Trim(seg, "{}.$")
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+func responses(route Route) map[string]interface{} {
+	problemRef := func(desc string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": desc,
+			"content": map[string]interface{}{
+				"application/problem+json": map[string]interface{}{
+					"schema": map[string]string{"$ref": "#/components/schemas/Problem"},
+				},
+			},
+		}
+	}
+	res := map[string]interface{}{
+		"2XX":     map[string]string{"description": "Success"},
+		"default": problemRef("Error"),
+	}
+	if !route.Public {
+		res["401"] = problemRef("Missing or invalid bearer token")
+	}
+	if len(route.Roles) > 0 {
+		res["403"] = problemRef("Caller lacks the " + strings.Join(route.Roles, " or ") + " role")
+	}
+	return res
+}
+
+var problemSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"type", "title", "status", "code"},
+	"properties": map[string]interface{}{
+		"type":       map[string]string{"type": "string"},
+		"title":      map[string]string{"type": "string"},
+		"status":     map[string]string{"type": "integer"},
+		"code":       map[string]string{"type": "string"},
+		"detail":     map[string]string{"type": "string"},
+		"instance":   map[string]string{"type": "string"},
+		"request_id": map[string]string{"type": "string"},
+		"errors": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"field":   map[string]string{"type": "string"},
+					"message": map[string]string{"type": "string"},
+				},
+			},
+		},
+	},
+}
@@ -0,0 +1,149 @@
+// Package router registers the API on a ServeMux with Go 1.22 method and
+// wildcard patterns, such as "GET /v1/accounts/{number}". Every Route
+// carries metadata: whether it needs a bearer token, which roles may call
+// it, its OpenAPI summary and tag, and the route that replaces it. The
+// router builds each route's middleware chain from that metadata, labels
+// metrics, traces and access logs with the route pattern and generates the
+// OpenAPI document from the same table, so the three cannot drift apart.
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Middleware wraps a route's handler.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Route is one endpoint and its metadata.
+type Route struct {
+	// Method and Path form the ServeMux pattern. Path may hold {name}
+	// wildcards, read by handlers with r.PathValue.
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// Public routes need no bearer token.
+	Public bool
+	// Roles, when set, limits the route to users with one of them.
+	Roles []string
+	// Summary and Tag describe the route in the OpenAPI document.
+	Summary string
+	Tag     string
+	// Successor marks a legacy alias: its responses carry a Deprecation
+	// header and a Link to the path that replaces it.
+	Successor string
+	// Middleware runs after authentication, outermost first.
+	Middleware []Middleware
+}
+
+// Router is an http.Handler serving a table of routes.
+type Router struct {
+	mux     *http.ServeMux
+	secret  string
+	routes  []Route
+	methods []string
+}
+
+// New returns a router that verifies bearer tokens with secret. Requests
+// that match no route get a 404 problem, and requests for a path that
+// exists under other methods get a 405 problem with an Allow header.
+func New(secret string) *Router {
+	rt := &Router{mux: http.NewServeMux(), secret: secret}
+	rt.mux.HandleFunc("/", rt.unmatched)
+	return rt
+}
+
+// Handle registers route. Like ServeMux it panics on a pattern that
+// conflicts with one already registered.
+func (rt *Router) Handle(route Route) {
+	rt.mux.HandleFunc(route.Method+" "+route.Path, rt.chain(route))
+	rt.routes = append(rt.routes, route)
+	for _, m := range rt.methods {
+		if m == route.Method {
+			return
+		}
+	}
+	rt.methods = append(rt.methods, route.Method)
+}
+
+// Routes returns the registered routes in registration order.
+func (rt *Router) Routes() []Route { return rt.routes }
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Pattern returns the path pattern of the route r matches, for metric and
+// span labels, or "" when it matches none.
+func (rt *Router) Pattern(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	if pattern == "/" {
+		return ""
+	}
+	return pattern
+}
+
+func (rt *Router) chain(route Route) http.HandlerFunc {
+	h := route.Handler
+	for i := len(route.Middleware) - 1; i >= 0; i-- {
+		h = route.Middleware[i](h)
+	}
+	if route.Successor != "" {
+		h = deprecated(h, route.Successor)
+	}
+	if !route.Public {
+		if len(route.Roles) > 0 {
+			h = auth.RequireRole(h, route.Roles...)
+		}
+		h = auth.WithAuth(h, rt.secret)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.SetRoute(r.Context(), route.Path)
+		h(w, r)
+	}
+}
+
+func deprecated(next http.HandlerFunc, successor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// unmatched answers requests no route matched. If the path matches a route
+// under another method it is a 405, otherwise a 404.
+func (rt *Router) unmatched(w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, m := range rt.methods {
+		probe := *r
+		probe.Method = m
+		if _, pattern := rt.mux.Handler(&probe); pattern != "/" {
+			allowed = append(allowed, m)
+		}
+	}
+	if len(allowed) == 0 {
+		problem.Write(w, r, problem.NotFound("no such resource"))
+		return
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	problem.Write(w, r, problem.MethodNotAllowed(allowed...))
+}
+
+// NoStore is middleware that keeps responses out of shared and browser
+// caches, for tokens and exports of personal data.
+func NoStore(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
+	}
+}
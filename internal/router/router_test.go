@@ -0,0 +1,136 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+)
+
+const secret = "test-secret"
+
+func token(t *testing.T, role string) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 1, "role": role, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + s
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Method + " " + r.PathValue("number")))
+}
+
+func newRouter() *Router {
+	rt := New(secret)
+	rt.Handle(Route{Method: http.MethodGet, Path: "/v1/accounts/{number}", Handler: echo, Tag: "Account", Summary: "Get an account"})
+	rt.Handle(Route{Method: http.MethodPost, Path: "/v1/accounts/{number}/deposits", Handler: echo, Tag: "Account", Summary: "Deposit"})
+	rt.Handle(Route{Method: http.MethodPost, Path: "/v1/accounts/{number}/adjustments", Handler: echo, Roles: []string{auth.RoleAdmin}})
+	rt.Handle(Route{Method: http.MethodGet, Path: "/v1/accounts/balance", Handler: echo, Successor: "/v1/accounts/{number}"})
+	rt.Handle(Route{Method: http.MethodPost, Path: "/v1/login", Handler: echo, Public: true, Middleware: []Middleware{NoStore}})
+	return rt
+}
+
+func serve(rt *Router, method, target, authz string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if authz != "" {
+		r.Header.Set("Authorization", authz)
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	return w
+}
+
+func TestRouting(t *testing.T) {
+	rt := newRouter()
+	user, adm := token(t, auth.RoleUser), token(t, auth.RoleAdmin)
+	cases := []struct {
+		method, target, authz string
+		status                int
+		body, allow           string
+	}{
+		{"GET", "/v1/accounts/ACC1", user, 200, "GET ACC1", ""},
+		{"HEAD", "/v1/accounts/ACC1", user, 200, "", ""},
+		{"POST", "/v1/accounts/ACC1/deposits", user, 200, "POST ACC1", ""},
+		{"GET", "/v1/accounts/ACC1", "", 401, "", ""},
+		{"POST", "/v1/accounts/ACC1/adjustments", user, 403, "", ""},
+		{"POST", "/v1/accounts/ACC1/adjustments", adm, 200, "POST ACC1", ""},
+		{"POST", "/v1/login", "", 200, "POST ", ""},
+		// method checks come before authentication
+		{"DELETE", "/v1/accounts/ACC1", "", 405, "", "GET"},
+		{"GET", "/v1/accounts/ACC1/deposits", user, 405, "", "POST"},
+		{"GET", "/v1/nothing", user, 404, "", ""},
+	}
+	for _, c := range cases {
+		w := serve(rt, c.method, c.target, c.authz)
+		if w.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d: %s", c.method, c.target, w.Code, c.status, w.Body)
+			continue
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s %s: body %q, want %q", c.method, c.target, w.Body, c.body)
+		}
+		if got := w.Header().Get("Allow"); got != c.allow {
+			t.Errorf("%s %s: Allow %q, want %q", c.method, c.target, got, c.allow)
+		}
+		if w.Code >= 400 && w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s %s: content type %q", c.method, c.target, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestRouteMiddleware(t *testing.T) {
+	rt := newRouter()
+	w := serve(rt, "GET", "/v1/accounts/balance", token(t, auth.RoleUser))
+	if w.Header().Get("Deprecation") != "true" || w.Header().Get("Link") != `</v1/accounts/{number}>; rel="successor-version"` {
+		t.Errorf("legacy route headers: %v", w.Header())
+	}
+	if w := serve(rt, "POST", "/v1/login", ""); w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("login headers: %v", w.Header())
+	}
+}
+
+func TestPattern(t *testing.T) {
+	rt := newRouter()
+	for target, want := range map[string]string{
+		"/v1/accounts/ACC1":          "/v1/accounts/{number}",
+		"/v1/accounts/balance":       "/v1/accounts/balance",
+		"/v1/accounts/ACC1/deposits": "",
+		"/elsewhere":                 "",
+	} {
+		if got := rt.Pattern(httptest.NewRequest(http.MethodGet, target, nil)); got != want {
+			t.Errorf("%s: pattern %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	doc := newRouter().OpenAPI("test", "1")
+	paths := doc["paths"].(map[string]map[string]interface{})
+	if len(paths) != 5 {
+		t.Errorf("got %d paths", len(paths))
+	}
+	get := paths["/v1/accounts/{number}"]["get"].(map[string]interface{})
+	params := get["parameters"].([]map[string]interface{})
+	if len(params) != 1 || params[0]["name"] != "number" || params[0]["in"] != "path" {
+		t.Errorf("parameters = %v", params)
+	}
+	if get["security"] == nil || get["operationId"] != "getV1AccountsNumber" || get["summary"] != "Get an account" {
+		t.Errorf("operation = %v", get)
+	}
+	if login := paths["/v1/login"]["post"].(map[string]interface{}); login["security"] != nil {
+		t.Error("public route should not need a token")
+	}
+	adjust := paths["/v1/accounts/{number}/adjustments"]["post"].(map[string]interface{})
+	if _, ok := adjust["responses"].(map[string]interface{})["403"]; !ok {
+		t.Error("route with roles should document 403")
+	}
+	if paths["/v1/accounts/balance"]["get"].(map[string]interface{})["deprecated"] != true {
+		t.Error("legacy route should be deprecated")
+	}
+}
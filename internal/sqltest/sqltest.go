@@ -0,0 +1,101 @@
+// Package sqltest provides a database/sql driver that answers statements
+// from canned replies, for testing code that builds and reads SQL without a
+// running database. It checks the Go side of a query: the arguments it is
+// given and what is done with the rows it returns.
+package sqltest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reply answers every statement whose SQL contains Match.
+type Reply struct {
+	Match string
+	Cols  []string
+	Rows  [][]driver.Value
+	// Err, when set, is returned instead of the rows.
+	Err error
+	// Args, when set, receives the arguments of the last matching statement.
+	Args *[]driver.Value
+}
+
+// Open returns a database that answers statements with the first reply that
+// matches them. Statements no reply matches fail. Execs report one affected
+// row per reply row.
+func Open(replies ...Reply) *sql.DB {
+	return sql.OpenDB(connector{&conn{replies: replies}})
+}
+
+type connector struct{ c *conn }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.c, nil }
+func (c connector) Driver() driver.Driver                        { return drv{c.c} }
+
+type drv struct{ c *conn }
+
+func (d drv) Open(string) (driver.Conn, error) { return d.c, nil }
+
+type conn struct{ replies []Reply }
+
+func (c *conn) find(query string, args []driver.NamedValue) (Reply, error) {
+	for _, r := range c.replies {
+		if !strings.Contains(query, r.Match) {
+			continue
+		}
+		if r.Args != nil {
+			*r.Args = (*r.Args)[:0]
+			for _, a := range args {
+				*r.Args = append(*r.Args, a.Value)
+			}
+		}
+		return r, r.Err
+	}
+	return Reply{}, fmt.Errorf("sqltest: no reply for %q", query)
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.find(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{cols: r.Cols, rows: r.Rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.find(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(r.Rows)), nil
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *conn) Close() error                        { return nil }
+func (c *conn) Begin() (driver.Tx, error)           { return tx{}, nil }
+
+type tx struct{}
+
+func (tx) Commit() error   { return nil }
+func (tx) Rollback() error { return nil }
+
+type rows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
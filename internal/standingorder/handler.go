@@ -0,0 +1,264 @@
+package standingorder
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for standing orders.
+type Handler struct {
+	repo   *Repo
+	owners auth.Owners
+}
+
+// NewHandler creates a standing order handler. owners resolves the login
+// of the customer an order belongs to.
+func NewHandler(r *Repo, owners auth.Owners) *Handler { return &Handler{repo: r, owners: owners} }
+
+// CreateOrder handles POST /v1/standing-orders.
+func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	type req struct {
+		CustomerID    int        `json:"customer_id" validate:"required,positive"`
+		From          string     `json:"from" validate:"required"`
+		To            string     `json:"to" validate:"required"`
+		Amount        float64    `json:"amount" validate:"required,positive"`
+		Narration     string     `json:"narration"`
+		Frequency     string     `json:"frequency" validate:"required,oneof=once daily weekly monthly end_of_month"`
+		StartAt       time.Time  `json:"start_at" validate:"required"`
+		EndAt         *time.Time `json:"end_at"`
+		MaxRetries    int        `json:"max_retries" validate:"min=0"`
+		RetryInterval string     `json:"retry_interval"`
+	}
+	var rr req
+	if err := request.Decode(w, r, &rr); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if rr.From == rr.To {
+		problem.Write(w, r, account.ErrSameAccount)
+		return
+	}
+	if err := h.allowed(r, rr.CustomerID); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	holder, err := h.repo.AccountCustomer(rr.From)
+	if err != nil && err != sql.ErrNoRows {
+		problem.Write(w, r, err)
+		return
+	}
+	if holder == 0 || holder != rr.CustomerID {
+		problem.Write(w, r, problem.Invalid(problem.Field("from", "must be an account of the customer")))
+		return
+	}
+	if rr.StartAt.Before(time.Now().Add(-time.Minute)) {
+		problem.Write(w, r, problem.Invalid(problem.Field("start_at", "must not be in the past")))
+		return
+	}
+	if rr.EndAt != nil && rr.EndAt.Before(rr.StartAt) {
+		problem.Write(w, r, problem.Invalid(problem.Field("end_at", "must be after start_at")))
+		return
+	}
+	interval := time.Hour
+	if rr.RetryInterval != "" {
+		d, err := time.ParseDuration(rr.RetryInterval)
+		if err != nil || d < time.Minute {
+			problem.Write(w, r, problem.Invalid(problem.Field("retry_interval", "must be a duration of at least 1m")))
+			return
+		}
+		interval = d
+	}
+	first := First(rr.Frequency, rr.StartAt)
+	o := &Order{
+		CustomerID:    rr.CustomerID,
+		FromAccount:   rr.From,
+		ToAccount:     rr.To,
+		Amount:        rr.Amount,
+		Narration:     rr.Narration,
+		Frequency:     rr.Frequency,
+		StartAt:       rr.StartAt,
+		EndAt:         rr.EndAt,
+		NextRunAt:     &first,
+		MaxRetries:    rr.MaxRetries,
+		RetryInterval: int(interval / time.Second),
+	}
+	if err := h.repo.Create(o); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(o)
+}
+
+// ListOrders handles GET /v1/standing-orders?customer_id=.
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("customer_id"))
+	if id == 0 {
+		problem.Write(w, r, problem.Invalid(problem.Field("customer_id", "is required")))
+		return
+	}
+	if err := h.allowed(r, id); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.ListByCustomer(id, p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Order).Key))
+}
+
+// ListExecutions handles GET /v1/standing-orders/{id}/executions.
+func (h *Handler) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(request.Param(r, "id", "id"))
+	if id == 0 {
+		problem.Write(w, r, problem.Invalid(problem.Field("id", "is required")))
+		return
+	}
+	if _, err := h.owned(r, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p, err := page.FromQuery(r.URL.Query(), page.Desc)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	list, err := h.repo.ListExecutions(id, p)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(page.New(list, p, (*Execution).Key))
+}
+
+// SkipOrder handles POST /v1/standing-orders/{id}/skip to skip the next run. It
+// answers 409 while the worker is executing that run.
+func (h *Handler) SkipOrder(w http.ResponseWriter, r *http.Request) {
+	id := decodeID(w, r)
+	if id == 0 {
+		return
+	}
+	o, err := h.owned(r, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if (o.Status != StatusActive && o.Status != StatusPaused) || o.NextRunAt == nil {
+		writeError(w, r, ErrInvalidState)
+		return
+	}
+	if err := h.repo.Skip(o.ID, *o.NextRunAt, nextRun(o, *o.NextRunAt)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.writeOrder(w, r, o.ID)
+}
+
+// PauseOrder handles POST /v1/standing-orders/{id}/pause.
+func (h *Handler) PauseOrder(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, StatusPaused, StatusActive)
+}
+
+// ResumeOrder handles POST /v1/standing-orders/{id}/resume. The order continues
+// with its first run after now; runs that fell due while it was paused are
+// not paid.
+func (h *Handler) ResumeOrder(w http.ResponseWriter, r *http.Request) {
+	id := decodeID(w, r)
+	if id == 0 {
+		return
+	}
+	if _, err := h.owned(r, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	o, err := h.repo.Resume(id, time.Now())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+// CancelOrder handles POST /v1/standing-orders/{id}/cancel.
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, StatusCancelled, StatusActive, StatusPaused)
+}
+
+func (h *Handler) setStatus(w http.ResponseWriter, r *http.Request, to string, from ...string) {
+	id := decodeID(w, r)
+	if id == 0 {
+		return
+	}
+	if _, err := h.owned(r, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	o, err := h.repo.SetStatus(id, to, from...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+// allowed reports whether the caller is staff or the customer themselves.
+// It returns a problem when the customer does not exist or the caller may
+// not act for them.
+func (h *Handler) allowed(r *http.Request, customerID int) error {
+	return auth.AllowCustomer(r, h.owners, customerID, auth.RoleTeller, auth.RoleAdmin)
+}
+
+// owned returns the order with the given id if the caller may manage it.
+func (h *Handler) owned(r *http.Request, id int) (*Order, error) {
+	o, err := h.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.allowed(r, o.CustomerID); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (h *Handler) writeOrder(w http.ResponseWriter, r *http.Request, id int) {
+	o, err := h.repo.Get(id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(o)
+}
+
+// decodeID reads the {"id"} body of the order actions. It writes the
+// problem and returns 0 when the body is not valid.
+func decodeID(w http.ResponseWriter, r *http.Request) int {
+	id, err := request.ID(w, r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return 0
+	}
+	return id
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == sql.ErrNoRows {
+		err = problem.NotFound("standing order not found")
+	}
+	problem.Write(w, r, err)
+}
@@ -0,0 +1,338 @@
+package standingorder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/example/real_time_core_banking_v9/internal/page"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+)
+
+// Repo provides database methods for standing orders and their executions.
+type Repo struct{ db *sql.DB }
+
+// NewRepo initializes and returns a new standing order repository instance.
+func NewRepo(db *sql.DB) *Repo { return &Repo{db: db} }
+
+// Order statuses.
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Execution outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeRetry   = "retry"
+	OutcomeFailed  = "failed"
+	OutcomeSkipped = "skipped"
+)
+
+// ErrInvalidState is returned when a status change is not allowed from the
+// order's current status.
+var ErrInvalidState = problem.New(http.StatusConflict, "invalid_state", "standing order is not in a state that allows this")
+
+// ErrAlreadyRun is returned by CompleteRunTx when the run has already been
+// completed, by an earlier attempt whose transfer committed.
+var ErrAlreadyRun = errors.New("standing order run already executed")
+
+// ErrOrderRunning is returned by Skip while a worker is executing the order.
+var ErrOrderRunning = problem.New(http.StatusConflict, "order_running", "standing order is being executed; try again shortly")
+
+// Order is a future-dated or recurring transfer.
+type Order struct {
+	ID            int        `json:"id"`
+	CustomerID    int        `json:"customer_id"`
+	FromAccount   string     `json:"from_account"`
+	ToAccount     string     `json:"to_account"`
+	Amount        float64    `json:"amount"`
+	Narration     string     `json:"narration"`
+	Frequency     string     `json:"frequency"`
+	StartAt       time.Time  `json:"start_at"`
+	EndAt         *time.Time `json:"end_at,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+	RetryAt       *time.Time `json:"retry_at,omitempty"`
+	Attempts      int        `json:"attempts"`
+	MaxRetries    int        `json:"max_retries"`
+	RetryInterval int        `json:"retry_interval_seconds"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Execution records one attempt to run an order.
+type Execution struct {
+	ID           int       `json:"id"`
+	OrderID      int       `json:"order_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	Attempt      int       `json:"attempt"`
+	Status       string    `json:"status"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const cols = `id, customer_id, from_account, to_account, amount, COALESCE(narration,''), frequency, start_at, end_at,
+	next_run_at, retry_at, attempts, max_retries, retry_interval_seconds, status, created_at`
+
+func scan(s interface{ Scan(...interface{}) error }) (*Order, error) {
+	o := &Order{}
+	var end, next, retry sql.NullTime
+	if err := s.Scan(&o.ID, &o.CustomerID, &o.FromAccount, &o.ToAccount, &o.Amount, &o.Narration, &o.Frequency, &o.StartAt, &end,
+		&next, &retry, &o.Attempts, &o.MaxRetries, &o.RetryInterval, &o.Status, &o.CreatedAt); err != nil {
+		return nil, err
+	}
+	if end.Valid {
+		o.EndAt = &end.Time
+	}
+	if next.Valid {
+		o.NextRunAt = &next.Time
+	}
+	if retry.Valid {
+		o.RetryAt = &retry.Time
+	}
+	return o, nil
+}
+
+func (r *Repo) list(q string, args ...interface{}) ([]*Order, error) {
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Order
+	for rows.Next() {
+		o, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// Create inserts a new active standing order.
+func (r *Repo) Create(o *Order) error {
+	o.Status = StatusActive
+	return r.db.QueryRow(`
+		INSERT INTO standing_orders(customer_id, from_account, to_account, amount, narration, frequency, start_at, end_at,
+			next_run_at, max_retries, retry_interval_seconds, status)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING id, created_at`,
+		o.CustomerID, o.FromAccount, o.ToAccount, o.Amount, o.Narration, o.Frequency, o.StartAt, o.EndAt,
+		o.NextRunAt, o.MaxRetries, o.RetryInterval, o.Status).Scan(&o.ID, &o.CreatedAt)
+}
+
+// AccountCustomer returns the id of the customer holding an account.
+func (r *Repo) AccountCustomer(accountNumber string) (int, error) {
+	var id sql.NullInt64
+	err := r.db.QueryRow("SELECT customer_id FROM accounts WHERE account_number = $1", accountNumber).Scan(&id)
+	return int(id.Int64), err
+}
+
+// Get returns a standing order by id.
+func (r *Repo) Get(id int) (*Order, error) {
+	return scan(r.db.QueryRow("SELECT "+cols+" FROM standing_orders WHERE id=$1", id))
+}
+
+// Key returns the pagination cursor position of o.
+func (o *Order) Key() page.Cursor { return page.Cursor{ID: o.ID} }
+
+// Key returns the pagination cursor position of e.
+func (e *Execution) Key() page.Cursor { return page.Cursor{ID: e.ID} }
+
+// ListByCustomer returns one page of a customer's standing orders, fetching
+// p.Limit+1 rows so the caller can tell whether another page follows.
+func (r *Repo) ListByCustomer(customerID int, p page.Params) ([]*Order, error) {
+	args := []interface{}{customerID, p.Limit + 1}
+	where := "customer_id=$1"
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where += " AND id " + p.Cmp() + " $3"
+	}
+	return r.list("SELECT "+cols+" FROM standing_orders WHERE "+where+" ORDER BY id "+p.Dir()+" LIMIT $2", args...)
+}
+
+// ClaimDue locks up to limit active orders whose run or retry time has
+// passed, so concurrent workers never pick up the same order.
+func (r *Repo) ClaimDue(now time.Time, limit int) ([]*Order, error) {
+	return r.list(`UPDATE standing_orders SET locked_until = $1::timestamptz + interval '5 minutes'
+		WHERE id IN (
+			SELECT id FROM standing_orders
+			WHERE status = 'active' AND COALESCE(retry_at, next_run_at) <= $1
+			  AND (locked_until IS NULL OR locked_until < $1)
+			ORDER BY COALESCE(retry_at, next_run_at)
+			LIMIT $2 FOR UPDATE SKIP LOCKED)
+		RETURNING `+cols, now, limit)
+}
+
+// Release unlocks claimed orders that were not executed.
+func (r *Repo) Release(ids []int) error {
+	_, err := r.db.Exec("UPDATE standing_orders SET locked_until=NULL WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
+
+// Advance moves an order from its run at prev to the next scheduled run, or
+// completes it when next is zero, clearing any retry state and the worker
+// lock. It does nothing if the order is no longer due at prev, so a run is
+// never advanced twice.
+func (r *Repo) Advance(id int, prev, next time.Time) error {
+	nextRun, status := advanceTo(next)
+	_, err := r.db.Exec(`UPDATE standing_orders
+		SET next_run_at=$1, status=COALESCE($2, status), retry_at=NULL, attempts=0, locked_until=NULL
+		WHERE id=$3 AND next_run_at=$4`, nextRun, status, id, prev)
+	return err
+}
+
+// CompleteRunTx advances an order from its run at prev to next, as Advance
+// does, and records the run as successful, both in tx: the transaction
+// that posts the run's transfer. A run is therefore paid at most once; if
+// the order is no longer due at prev it returns ErrAlreadyRun and the
+// transfer must be rolled back.
+func (r *Repo) CompleteRunTx(ctx context.Context, tx *sql.Tx, id int, prev, next time.Time, attempt int) error {
+	nextRun, status := advanceTo(next)
+	res, err := tx.ExecContext(ctx, `UPDATE standing_orders
+		SET next_run_at=$1, status=COALESCE($2, status), retry_at=NULL, attempts=0, locked_until=NULL
+		WHERE id=$3 AND next_run_at=$4`, nextRun, status, id, prev)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAlreadyRun
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO standing_order_executions(order_id, scheduled_for, attempt, status) VALUES ($1,$2,$3,$4)",
+		id, prev, attempt, OutcomeSuccess)
+	return err
+}
+
+// Skip records the order's run at prev as skipped and moves it to next, or
+// completes it when next is zero. The order must be active or paused, still
+// due at prev and not claimed by a worker; the update checks all three, so a
+// run is never both skipped and executed. It returns ErrOrderRunning while a
+// worker holds the order and ErrInvalidState otherwise.
+func (r *Repo) Skip(id int, prev, next time.Time) error {
+	nextRun, status := advanceTo(next)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE standing_orders
+		SET next_run_at=$1, status=COALESCE($2, status), retry_at=NULL, attempts=0
+		WHERE id=$3 AND next_run_at=$4 AND status IN ('active', 'paused')
+		  AND (locked_until IS NULL OR locked_until < now())`, nextRun, status, id, prev)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err != nil {
+			return err
+		}
+		var locked bool
+		if err := r.db.QueryRow("SELECT COALESCE(locked_until > now(), false) FROM standing_orders WHERE id=$1", id).Scan(&locked); err != nil {
+			return err
+		}
+		if locked {
+			return ErrOrderRunning
+		}
+		return ErrInvalidState
+	}
+	if _, err := tx.Exec("INSERT INTO standing_order_executions(order_id, scheduled_for, attempt, status) VALUES ($1,$2,0,$3)",
+		id, prev, OutcomeSkipped); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// advanceTo returns the next_run_at and status to store for a next run,
+// completing the order when next is zero.
+func advanceTo(next time.Time) (nextRun, status interface{}) {
+	if next.IsZero() {
+		return nil, StatusCompleted
+	}
+	return next, nil
+}
+
+// ScheduleRetry sets the time of the next attempt for the current run.
+func (r *Repo) ScheduleRetry(id int, at time.Time, attempts int) error {
+	_, err := r.db.Exec("UPDATE standing_orders SET retry_at=$1, attempts=$2, locked_until=NULL WHERE id=$3", at, attempts, id)
+	return err
+}
+
+// SetStatus changes the status of an order whose current status is one of from.
+func (r *Repo) SetStatus(id int, to string, from ...string) (*Order, error) {
+	o, err := scan(r.db.QueryRow("UPDATE standing_orders SET status=$1, retry_at=NULL, attempts=0 WHERE id=$2 AND status = ANY($3) RETURNING "+cols,
+		to, id, pq.Array(from)))
+	if err == sql.ErrNoRows {
+		if _, gerr := r.Get(id); gerr == sql.ErrNoRows {
+			return nil, gerr
+		}
+		return nil, ErrInvalidState
+	}
+	return o, err
+}
+
+// Resume reactivates a paused order at resumeRun, clearing any retry state.
+// It returns ErrInvalidState unless the order is paused.
+func (r *Repo) Resume(id int, now time.Time) (*Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	o, err := scan(tx.QueryRow("SELECT "+cols+" FROM standing_orders WHERE id=$1 FOR UPDATE", id))
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != StatusPaused {
+		return nil, ErrInvalidState
+	}
+	nextRun, status := advanceTo(resumeRun(o, now))
+	o, err = scan(tx.QueryRow(`UPDATE standing_orders SET status=COALESCE($1, $2), next_run_at=$3, retry_at=NULL, attempts=0
+		WHERE id=$4 RETURNING `+cols, status, StatusActive, nextRun, id))
+	if err != nil {
+		return nil, err
+	}
+	return o, tx.Commit()
+}
+
+// RecordExecution stores the outcome of one attempt to run an order.
+func (r *Repo) RecordExecution(orderID int, scheduledFor time.Time, attempt int, status, errMsg string) error {
+	_, err := r.db.Exec("INSERT INTO standing_order_executions(order_id, scheduled_for, attempt, status, error) VALUES ($1,$2,$3,$4,NULLIF($5,''))",
+		orderID, scheduledFor, attempt, status, errMsg)
+	return err
+}
+
+// ListExecutions returns one page of the execution history of an order,
+// fetching p.Limit+1 rows.
+func (r *Repo) ListExecutions(orderID int, p page.Params) ([]*Execution, error) {
+	args := []interface{}{orderID, p.Limit + 1}
+	where := "order_id=$1"
+	if p.After != nil {
+		args = append(args, p.After.ID)
+		where += " AND id " + p.Cmp() + " $3"
+	}
+	rows, err := r.db.Query("SELECT id, order_id, scheduled_for, attempt, status, COALESCE(error,''), created_at FROM standing_order_executions WHERE "+
+		where+" ORDER BY id "+p.Dir()+" LIMIT $2", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Execution
+	for rows.Next() {
+		e := &Execution{}
+		if err := rows.Scan(&e.ID, &e.OrderID, &e.ScheduledFor, &e.Attempt, &e.Status, &e.Error, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
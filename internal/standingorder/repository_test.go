@@ -0,0 +1,83 @@
+package standingorder
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+var orderCols = []string{"id", "customer_id", "from_account", "to_account", "amount", "narration", "frequency", "start_at", "end_at",
+	"next_run_at", "retry_at", "attempts", "max_retries", "retry_interval_seconds", "status", "created_at"}
+
+func orderRow(o *Order) []driver.Value {
+	var next driver.Value
+	if o.NextRunAt != nil {
+		next = *o.NextRunAt
+	}
+	return []driver.Value{int64(o.ID), int64(5), o.FromAccount, o.ToAccount, o.Amount, "", o.Frequency, o.StartAt, nil,
+		next, nil, int64(0), int64(o.MaxRetries), int64(o.RetryInterval), o.Status, o.StartAt}
+}
+
+func TestResumeRun(t *testing.T) {
+	now := date(2024, time.June, 10)
+	cases := []struct {
+		name string
+		freq string
+		next time.Time
+		want time.Time
+	}{
+		{"next run still ahead", Monthly, date(2024, time.June, 15), date(2024, time.June, 15)},
+		{"months of missed runs", Monthly, date(2024, time.January, 15), date(2024, time.June, 15)},
+		{"missed daily runs", Daily, date(2024, time.May, 1), date(2024, time.June, 11)},
+		{"missed one-off run", Once, date(2024, time.May, 1), now},
+	}
+	for _, c := range cases {
+		o := &Order{Frequency: c.freq, StartAt: c.next, NextRunAt: &c.next}
+		if got := resumeRun(o, now); !got.Equal(c.want) {
+			t.Errorf("%s: resumes at %v, want %v", c.name, got, c.want)
+		}
+	}
+	end := date(2024, time.March, 31)
+	o := &Order{Frequency: Monthly, StartAt: date(2024, time.January, 15), NextRunAt: &end, EndAt: &end}
+	if got := resumeRun(o, now); !got.IsZero() {
+		t.Errorf("ended order resumes at %v", got)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	jan := date(2024, time.January, 15)
+	o := monthly(1, jan)
+	o.Status = StatusPaused
+	var pauseArgs, resumeArgs []driver.Value
+	resumed := *o
+	resumed.Status = StatusActive
+	repo := NewRepo(sqltest.Open(
+		sqltest.Reply{Match: "SET status=$1", Cols: orderCols, Rows: [][]driver.Value{orderRow(o)}, Args: &pauseArgs},
+		sqltest.Reply{Match: "FOR UPDATE", Cols: orderCols, Rows: [][]driver.Value{orderRow(o)}},
+		sqltest.Reply{Match: "SET status=COALESCE", Cols: orderCols, Rows: [][]driver.Value{orderRow(&resumed)}, Args: &resumeArgs},
+	))
+
+	if _, err := repo.SetStatus(1, StatusPaused, StatusActive); err != nil {
+		t.Fatal(err)
+	}
+	if pauseArgs[0] != StatusPaused {
+		t.Fatalf("pause args %v", pauseArgs)
+	}
+	// resumed in June, the order skips the runs from January to May
+	if _, err := repo.Resume(1, date(2024, time.June, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := resumeArgs[2].(time.Time); !ok || !next.Equal(date(2024, time.June, 15)) || resumeArgs[0] != nil || resumeArgs[1] != StatusActive {
+		t.Fatalf("resume args %v", resumeArgs)
+	}
+
+	active := *o
+	active.Status = StatusActive
+	repo = NewRepo(sqltest.Open(sqltest.Reply{Match: "FOR UPDATE", Cols: orderCols, Rows: [][]driver.Value{orderRow(&active)}}))
+	if _, err := repo.Resume(1, date(2024, time.June, 10)); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("resuming an active order = %v", err)
+	}
+}
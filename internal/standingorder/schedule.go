@@ -0,0 +1,69 @@
+package standingorder
+
+import "time"
+
+// Frequencies a standing order can run at.
+const (
+	Once       = "once"
+	Daily      = "daily"
+	Weekly     = "weekly"
+	Monthly    = "monthly"
+	EndOfMonth = "end_of_month"
+)
+
+// ValidFrequency reports whether f is a supported frequency.
+func ValidFrequency(f string) bool {
+	switch f {
+	case Once, Daily, Weekly, Monthly, EndOfMonth:
+		return true
+	}
+	return false
+}
+
+// First returns the first run time for an order starting at start.
+func First(freq string, start time.Time) time.Time {
+	if freq == EndOfMonth {
+		return endOfMonth(start.Year(), start.Month(), start)
+	}
+	return start
+}
+
+// Next returns the run after prev, or the zero time when the order does not
+// recur. Monthly orders keep the day of month of start, clamped to shorter
+// months, so a payment started on the 31st runs on the last day of February
+// and then on the 31st again.
+func Next(freq string, start, prev time.Time) time.Time {
+	switch freq {
+	case Daily:
+		return prev.AddDate(0, 0, 1)
+	case Weekly:
+		return prev.AddDate(0, 0, 7)
+	case Monthly:
+		y, m := nextMonth(prev)
+		day := start.Day()
+		if last := daysIn(y, m); day > last {
+			day = last
+		}
+		return time.Date(y, m, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	case EndOfMonth:
+		y, m := nextMonth(prev)
+		return endOfMonth(y, m, start)
+	}
+	return time.Time{}
+}
+
+func nextMonth(t time.Time) (int, time.Month) {
+	y, m := t.Year(), t.Month()+1
+	if m > time.December {
+		y, m = y+1, time.January
+	}
+	return y, m
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func endOfMonth(y int, m time.Month, clock time.Time) time.Time {
+	return time.Date(y, m, daysIn(y, m), clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+}
@@ -0,0 +1,54 @@
+package standingorder
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 30, 0, 0, time.UTC)
+}
+
+func TestNextMonthlyClampsToMonthEnd(t *testing.T) {
+	start := date(2024, time.January, 31)
+	feb := Next(Monthly, start, start)
+	if !feb.Equal(date(2024, time.February, 29)) {
+		t.Fatalf("feb run = %v", feb)
+	}
+	mar := Next(Monthly, start, feb)
+	if !mar.Equal(date(2024, time.March, 31)) {
+		t.Fatalf("mar run = %v", mar)
+	}
+}
+
+func TestEndOfMonth(t *testing.T) {
+	start := date(2024, time.November, 10)
+	first := First(EndOfMonth, start)
+	if !first.Equal(date(2024, time.November, 30)) {
+		t.Fatalf("first run = %v", first)
+	}
+	if next := Next(EndOfMonth, start, first); !next.Equal(date(2024, time.December, 31)) {
+		t.Fatalf("next run = %v", next)
+	}
+}
+
+func TestNextOnceAndWeekly(t *testing.T) {
+	start := date(2024, time.March, 1)
+	if !Next(Once, start, start).IsZero() {
+		t.Fatal("one-off order should not recur")
+	}
+	if got := Next(Weekly, start, start); !got.Equal(date(2024, time.March, 8)) {
+		t.Fatalf("weekly run = %v", got)
+	}
+}
+
+func TestNextRunRespectsEnd(t *testing.T) {
+	end := date(2024, time.March, 2)
+	o := &Order{Frequency: Daily, StartAt: date(2024, time.March, 1), EndAt: &end}
+	if got := nextRun(o, o.StartAt); !got.Equal(end) {
+		t.Fatalf("next = %v", got)
+	}
+	if got := nextRun(o, end); !got.IsZero() {
+		t.Fatalf("expected order to end, got %v", got)
+	}
+}
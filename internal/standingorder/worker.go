@@ -0,0 +1,221 @@
+// Package standingorder stores future-dated and recurring transfers and runs
+// them from a background worker through the same posting path as
+// account transfers.
+package standingorder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/health"
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+	"github.com/example/real_time_core_banking_v9/internal/metrics"
+	"github.com/example/real_time_core_banking_v9/internal/trace"
+)
+
+// Channel is recorded on transactions posted by standing orders.
+const Channel = "standing_order"
+
+// claimBatch is how many due orders a single run locks at once.
+const claimBatch = 50
+
+// Poster posts a transfer. It is satisfied by *account.Service.
+type Poster interface {
+	Transfer(ctx context.Context, t account.TransferRequest) error
+}
+
+// store is the part of *Repo the worker uses.
+type store interface {
+	ClaimDue(now time.Time, limit int) ([]*Order, error)
+	Release(ids []int) error
+	Advance(id int, prev, next time.Time) error
+	CompleteRunTx(ctx context.Context, tx *sql.Tx, id int, prev, next time.Time, attempt int) error
+	ScheduleRetry(id int, at time.Time, attempts int) error
+	RecordExecution(orderID int, scheduledFor time.Time, attempt int, status, errMsg string) error
+}
+
+// queue receives notifications. It is satisfied by *redis.Client.
+type queue interface {
+	LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+}
+
+// Worker executes due standing orders.
+type Worker struct {
+	repo   store
+	poster Poster
+	rdb    queue
+	now    func() time.Time
+}
+
+// NewWorker creates a standing order worker.
+func NewWorker(repo *Repo, poster Poster, rdb *redis.Client) *Worker {
+	return &Worker{repo: repo, poster: poster, rdb: rdb, now: time.Now}
+}
+
+// StartWorker runs due standing orders every interval until ctx is
+// cancelled, reporting each pass to hb.
+func StartWorker(ctx context.Context, w *Worker, interval time.Duration, hb *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.RunDue(ctx); err != nil {
+			logrus.Errorf("standing orders: %v", err)
+			hb.Fail(err)
+		} else {
+			hb.Beat()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue claims and executes every order whose run time has passed. Once
+// ctx is cancelled it finishes the order in progress, which is never
+// interrupted part way through its transfer, and releases the rest of the
+// batch so the next start picks them up at once.
+func (w *Worker) RunDue(ctx context.Context) error {
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		orders, err := w.repo.ClaimDue(w.now(), claimBatch)
+		if err != nil {
+			return err
+		}
+		for i, o := range orders {
+			if ctx.Err() != nil {
+				ids := make([]int, 0, len(orders)-i)
+				for _, rest := range orders[i:] {
+					ids = append(ids, rest.ID)
+				}
+				return w.repo.Release(ids)
+			}
+			w.execute(context.WithoutCancel(ctx), o)
+		}
+		if len(orders) < claimBatch {
+			return nil
+		}
+	}
+}
+
+// execute runs one order under its own request id and trace, so the
+// transfer it posts and the notification it queues can be followed in the
+// logs and traces.
+func (w *Worker) execute(ctx context.Context, o *Order) {
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	ctx, span := trace.Start(ctx, "standing_order.execute", trace.KindInternal, trace.Int("order_id", o.ID))
+	defer span.End()
+	logging.AddFields(ctx, logrus.Fields{"order_id": o.ID, "trace_id": trace.TraceIDFrom(ctx)})
+	scheduledFor := *o.NextRunAt
+	attempt := o.Attempts + 1
+	next := nextRun(o, scheduledFor)
+	err := w.poster.Transfer(ctx, account.TransferRequest{
+		From:      o.FromAccount,
+		To:        o.ToAccount,
+		Amount:    o.Amount,
+		Channel:   Channel,
+		Narration: o.Narration,
+		// the run is completed with the transfer, so it is paid only once
+		InTx: func(ctx context.Context, tx *sql.Tx) error {
+			return w.repo.CompleteRunTx(ctx, tx, o.ID, scheduledFor, next, attempt)
+		},
+	})
+	span.RecordError(err)
+	switch {
+	case err == nil:
+		executions.Inc(OutcomeSuccess)
+		w.notify(ctx, "standing_order_success", o, scheduledFor, nil)
+		return
+	case errors.Is(err, ErrAlreadyRun):
+		logging.From(ctx).Warnf("standing order %d: run at %s was already executed", o.ID, scheduledFor.Format(time.RFC3339))
+		if err := w.repo.Release([]int{o.ID}); err != nil {
+			logging.From(ctx).Errorf("standing order %d: release: %v", o.ID, err)
+		}
+		return
+	case errors.Is(err, account.ErrInsufficientFunds) && o.Attempts < o.MaxRetries:
+		w.record(ctx, o, scheduledFor, attempt, OutcomeRetry, err)
+		at := w.now().Add(time.Duration(o.RetryInterval) * time.Second)
+		if err := w.repo.ScheduleRetry(o.ID, at, attempt); err != nil {
+			logging.From(ctx).Errorf("standing order %d: schedule retry: %v", o.ID, err)
+		}
+		return
+	default:
+		w.record(ctx, o, scheduledFor, attempt, OutcomeFailed, err)
+		w.notify(ctx, "standing_order_failed", o, scheduledFor, err)
+	}
+	if err := w.repo.Advance(o.ID, scheduledFor, next); err != nil {
+		logging.From(ctx).Errorf("standing order %d: advance: %v", o.ID, err)
+	}
+}
+
+// nextRun returns the run after prev, or zero once the order has ended.
+func nextRun(o *Order, prev time.Time) time.Time {
+	next := Next(o.Frequency, o.StartAt, prev)
+	if o.EndAt != nil && next.After(*o.EndAt) {
+		return time.Time{}
+	}
+	return next
+}
+
+// resumeRun returns the run a paused order resumes at: its next run while
+// that is still ahead, otherwise the first scheduled run after now, so runs
+// missed while paused are not paid. A one-off order that fell due while
+// paused runs at once. Zero means the order has ended.
+func resumeRun(o *Order, now time.Time) time.Time {
+	if o.NextRunAt == nil {
+		return time.Time{}
+	}
+	next := *o.NextRunAt
+	if o.Frequency == Once && next.Before(now) {
+		return now
+	}
+	for !next.IsZero() && !next.After(now) {
+		next = nextRun(o, next)
+	}
+	return next
+}
+
+var executions = metrics.Default.NewCounter("rtcb_standing_order_executions_total",
+	"Standing order execution attempts, by outcome.", "outcome")
+
+func (w *Worker) record(ctx context.Context, o *Order, scheduledFor time.Time, attempt int, outcome string, err error) {
+	executions.Inc(outcome)
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if err := w.repo.RecordExecution(o.ID, scheduledFor, attempt, outcome, msg); err != nil {
+		logging.From(ctx).Errorf("standing order %d: record execution: %v", o.ID, err)
+	}
+}
+
+func (w *Worker) notify(ctx context.Context, typ string, o *Order, scheduledFor time.Time, err error) {
+	payload := map[string]interface{}{
+		"type":          typ,
+		"order_id":      o.ID,
+		"customer_id":   o.CustomerID,
+		"from":          o.FromAccount,
+		"to":            o.ToAccount,
+		"amount":        o.Amount,
+		"scheduled_for": scheduledFor,
+		"request_id":    logging.RequestID(ctx),
+		"traceparent":   trace.Inject(ctx),
+	}
+	if err != nil {
+		payload["error"] = err.Error()
+	}
+	b, _ := json.Marshal(payload)
+	if err := w.rdb.LPush(ctx, "notifications", b).Err(); err != nil {
+		logging.From(ctx).Warnf("standing order %d: queue notification: %v", o.ID, err)
+	}
+}
@@ -0,0 +1,290 @@
+package standingorder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+)
+
+// memStore keeps orders in memory with the claim, lock and advance rules
+// the SQL in Repo applies.
+type memStore struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	orders map[int]*Order
+	locked map[int]time.Time
+	execs  []Execution
+}
+
+func newMemStore(now func() time.Time, orders ...*Order) *memStore {
+	s := &memStore{now: now, orders: map[int]*Order{}, locked: map[int]time.Time{}}
+	for _, o := range orders {
+		o.Status = StatusActive
+		s.orders[o.ID] = o
+	}
+	return s
+}
+
+func due(o *Order) time.Time {
+	if o.RetryAt != nil {
+		return *o.RetryAt
+	}
+	return *o.NextRunAt
+}
+
+func (s *memStore) ClaimDue(now time.Time, limit int) ([]*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Order
+	for id := 1; id <= len(s.orders) && len(out) < limit; id++ {
+		o := s.orders[id]
+		if o.Status != StatusActive || o.NextRunAt == nil || due(o).After(now) || s.locked[id].After(now) {
+			continue
+		}
+		s.locked[id] = now.Add(5 * time.Minute)
+		c := *o
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+func (s *memStore) Release(ids []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.locked, id)
+	}
+	return nil
+}
+
+func (s *memStore) Advance(id int, prev, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if o.NextRunAt == nil || !o.NextRunAt.Equal(prev) {
+		return nil
+	}
+	s.advance(o, next)
+	delete(s.locked, id)
+	return nil
+}
+
+// CompleteRunTx follows Repo.CompleteRunTx; the transaction is the
+// poster's concern.
+func (s *memStore) CompleteRunTx(_ context.Context, _ *sql.Tx, id int, prev, next time.Time, attempt int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if o.NextRunAt == nil || !o.NextRunAt.Equal(prev) {
+		return ErrAlreadyRun
+	}
+	s.advance(o, next)
+	delete(s.locked, id)
+	s.execs = append(s.execs, Execution{OrderID: id, ScheduledFor: prev, Attempt: attempt, Status: OutcomeSuccess})
+	return nil
+}
+
+func (s *memStore) advance(o *Order, next time.Time) {
+	if next.IsZero() {
+		o.NextRunAt, o.Status = nil, StatusCompleted
+	} else {
+		o.NextRunAt = &next
+	}
+	o.RetryAt, o.Attempts = nil, 0
+}
+
+// Skip follows Repo.Skip.
+func (s *memStore) Skip(id int, prev, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if s.locked[id].After(s.now()) {
+		return ErrOrderRunning
+	}
+	if o.NextRunAt == nil || !o.NextRunAt.Equal(prev) || (o.Status != StatusActive && o.Status != StatusPaused) {
+		return ErrInvalidState
+	}
+	s.advance(o, next)
+	s.execs = append(s.execs, Execution{OrderID: id, ScheduledFor: prev, Status: OutcomeSkipped})
+	return nil
+}
+
+func (s *memStore) ScheduleRetry(id int, at time.Time, attempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[id].RetryAt, s.orders[id].Attempts = &at, attempts
+	delete(s.locked, id)
+	return nil
+}
+
+func (s *memStore) RecordExecution(orderID int, scheduledFor time.Time, attempt int, status, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.execs = append(s.execs, Execution{OrderID: orderID, ScheduledFor: scheduledFor, Attempt: attempt, Status: status, Error: errMsg})
+	return nil
+}
+
+func (s *memStore) outcomes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, e := range s.execs {
+		out = append(out, e.Status)
+	}
+	return out
+}
+
+// posterFunc posts a transfer with f and, like account.Service, runs its
+// InTx step before reporting success.
+type posterFunc func(ctx context.Context, t account.TransferRequest) error
+
+func (f posterFunc) Transfer(ctx context.Context, t account.TransferRequest) error {
+	if err := f(ctx, t); err != nil {
+		return err
+	}
+	if t.InTx != nil {
+		return t.InTx(ctx, nil)
+	}
+	return nil
+}
+
+type memQueue struct{ n int }
+
+func (q *memQueue) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	q.n++
+	return redis.NewIntCmd(ctx)
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func monthly(id int, first time.Time) *Order {
+	return &Order{ID: id, FromAccount: "ACC1", ToAccount: "ACC2", Amount: 10, Frequency: Monthly,
+		StartAt: first, NextRunAt: &first, MaxRetries: 1, RetryInterval: 3600}
+}
+
+func TestRunDueClaimsDueOrders(t *testing.T) {
+	c := &clock{date(2024, time.March, 1)}
+	store := newMemStore(c.now, monthly(1, c.t), monthly(2, c.t.AddDate(0, 0, 3)))
+	var posted []string
+	w := &Worker{repo: store, rdb: &memQueue{}, now: c.now, poster: posterFunc(func(_ context.Context, t account.TransferRequest) error {
+		posted = append(posted, t.From)
+		return nil
+	})}
+
+	if err := w.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(posted) != 1 || store.orders[1].NextRunAt.Month() != time.April || store.orders[2].NextRunAt.Month() != time.March {
+		t.Fatalf("posted %v, next runs %v and %v", posted, store.orders[1].NextRunAt, store.orders[2].NextRunAt)
+	}
+	if _, locked := store.locked[1]; locked {
+		t.Fatal("advanced order is still locked")
+	}
+	// nothing else is due until the second order's start
+	if err := w.RunDue(context.Background()); err != nil || len(posted) != 1 {
+		t.Fatalf("second pass posted %v: %v", posted, err)
+	}
+	c.t = c.t.AddDate(0, 0, 3)
+	if err := w.RunDue(context.Background()); err != nil || len(posted) != 2 {
+		t.Fatalf("third pass posted %v: %v", posted, err)
+	}
+}
+
+func TestRunDueRetriesInsufficientFunds(t *testing.T) {
+	c := &clock{date(2024, time.March, 1)}
+	store := newMemStore(c.now, monthly(1, c.t))
+	q := &memQueue{}
+	w := &Worker{repo: store, rdb: q, now: c.now, poster: posterFunc(func(context.Context, account.TransferRequest) error {
+		return account.ErrInsufficientFunds
+	})}
+
+	if err := w.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	o := store.orders[1]
+	if o.Attempts != 1 || o.RetryAt == nil || !o.RetryAt.Equal(c.t.Add(time.Hour)) || q.n != 0 {
+		t.Fatalf("after first attempt: %+v, %d notifications", o, q.n)
+	}
+	// not retried before retry_at
+	c.t = c.t.Add(30 * time.Minute)
+	if err := w.RunDue(context.Background()); err != nil || len(store.execs) != 1 {
+		t.Fatalf("retried early: %v %v", store.outcomes(), err)
+	}
+	// the last retry fails the run, notifies and moves on to the next month
+	c.t = c.t.Add(30 * time.Minute)
+	if err := w.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := store.outcomes()
+	if len(got) != 2 || got[0] != OutcomeRetry || got[1] != OutcomeFailed {
+		t.Fatalf("outcomes %v", got)
+	}
+	if o.Attempts != 0 || o.RetryAt != nil || o.NextRunAt.Month() != time.April || q.n != 1 {
+		t.Fatalf("after last attempt: %+v, %d notifications", o, q.n)
+	}
+}
+
+func TestSkipWhileRunning(t *testing.T) {
+	c := &clock{date(2024, time.March, 1)}
+	o := monthly(1, c.t)
+	store := newMemStore(c.now, o)
+	var skipErr error
+	w := &Worker{repo: store, rdb: &memQueue{}, now: c.now, poster: posterFunc(func(context.Context, account.TransferRequest) error {
+		// a customer skips the run the worker is executing
+		skipErr = store.Skip(1, c.t, c.t.AddDate(0, 1, 0))
+		return nil
+	})}
+
+	if err := w.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(skipErr, ErrOrderRunning) {
+		t.Fatalf("skip during run = %v", skipErr)
+	}
+	if got := store.outcomes(); len(got) != 1 || got[0] != OutcomeSuccess || o.NextRunAt.Month() != time.April {
+		t.Fatalf("outcomes %v, next run %v", got, o.NextRunAt)
+	}
+	// once released the next run can be skipped, but only once
+	april := *o.NextRunAt
+	if err := store.Skip(1, april, Next(Monthly, o.StartAt, april)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Skip(1, april, Next(Monthly, o.StartAt, april)); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("second skip = %v", err)
+	}
+	if o.NextRunAt.Month() != time.May {
+		t.Fatalf("next run %v", o.NextRunAt)
+	}
+}
+
+// A run whose transfer committed before the worker died is not completed
+// again, which would roll its second transfer back, when a worker still
+// holding the old claim executes it.
+func TestRunCompletedOnce(t *testing.T) {
+	c := &clock{date(2024, time.March, 1)}
+	o := monthly(1, c.t)
+	store := newMemStore(c.now, o)
+	q := &memQueue{}
+	w := &Worker{repo: store, rdb: q, now: c.now, poster: posterFunc(func(context.Context, account.TransferRequest) error { return nil })}
+	stale, _ := store.ClaimDue(c.t, 1)
+	if err := store.CompleteRunTx(context.Background(), nil, 1, c.t, Next(Monthly, o.StartAt, c.t), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	w.execute(context.Background(), stale[0])
+	if got := store.outcomes(); len(got) != 1 || got[0] != OutcomeSuccess || o.NextRunAt.Month() != time.April || q.n != 0 {
+		t.Fatalf("outcomes %v, next run %v, %d notifications", got, o.NextRunAt, q.n)
+	}
+	if _, locked := store.locked[1]; locked {
+		t.Fatal("order still locked")
+	}
+}
@@ -0,0 +1,133 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+// camt053NS is the ISO 20022 bank-to-customer statement namespace.
+const camt053NS = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtDocument struct {
+	XMLName xml.Name      `xml:"Document"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Stmt    camtStatement `xml:"BkToCstmrStmt"`
+}
+
+type camtStatement struct {
+	GrpHdr struct {
+		MsgId   string `xml:"MsgId"`
+		CreDtTm string `xml:"CreDtTm"`
+	} `xml:"GrpHdr"`
+	Stmt struct {
+		Id      string `xml:"Id"`
+		CreDtTm string `xml:"CreDtTm"`
+		FrToDt  struct {
+			FrDtTm string `xml:"FrDtTm"`
+			ToDtTm string `xml:"ToDtTm"`
+		} `xml:"FrToDt"`
+		Acct struct {
+			Id   string `xml:"Id>Othr>Id"`
+			Ccy  string `xml:"Ccy"`
+			Ownr string `xml:"Ownr>Nm,omitempty"`
+		} `xml:"Acct"`
+		Bal       []camtBalance `xml:"Bal"`
+		TxsSummry struct {
+			TtlNtries    camtSummary `xml:"TtlNtries"`
+			TtlCdtNtries camtSummary `xml:"TtlCdtNtries"`
+			TtlDbtNtries camtSummary `xml:"TtlDbtNtries"`
+		} `xml:"TxsSummry"`
+		Ntry []camtEntry `xml:"Ntry"`
+	} `xml:"Stmt"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Type      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Date      string     `xml:"Dt>Dt"`
+}
+
+type camtSummary struct {
+	NbOfNtries string `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtEntry struct {
+	NtryRef     string     `xml:"NtryRef"`
+	Amt         camtAmount `xml:"Amt"`
+	CdtDbtInd   string     `xml:"CdtDbtInd"`
+	Sts         string     `xml:"Sts"`
+	BookgDt     string     `xml:"BookgDt>Dt"`
+	ValDt       string     `xml:"ValDt>Dt"`
+	AcctSvcrRef string     `xml:"AcctSvcrRef"`
+	BkTxCd      string     `xml:"BkTxCd>Prtry>Cd"`
+	Ustrd       string     `xml:"NtryDtls>TxDtls>RmtInf>Ustrd,omitempty"`
+}
+
+func creditDebit(credit bool) string {
+	if credit {
+		return "CRDT"
+	}
+	return "DBIT"
+}
+
+// WriteCamt053 writes s as an ISO 20022 camt.053.001.02 XML document.
+func WriteCamt053(w io.Writer, s *Statement) error {
+	created := s.GeneratedAt.Format("2006-01-02T15:04:05Z07:00")
+	doc := camtDocument{Xmlns: camt053NS}
+	st := &doc.Stmt
+	st.GrpHdr.MsgId = s.AccountNumber + "-" + s.ID
+	st.GrpHdr.CreDtTm = created
+	st.Stmt.Id = s.ID
+	st.Stmt.CreDtTm = created
+	st.Stmt.FrToDt.FrDtTm = s.From + "T00:00:00"
+	st.Stmt.FrToDt.ToDtTm = s.To + "T23:59:59"
+	st.Stmt.Acct.Id = s.AccountNumber
+	st.Stmt.Acct.Ccy = s.Currency
+	st.Stmt.Acct.Ownr = s.Holder
+	st.Stmt.Bal = []camtBalance{
+		{Type: "OPBD", Amt: camtAmount{s.Currency, amount(s.Opening)}, CdtDbtInd: creditDebit(s.Opening >= 0), Date: s.From},
+		{Type: "CLBD", Amt: camtAmount{s.Currency, amount(s.Closing)}, CdtDbtInd: creditDebit(s.Closing >= 0), Date: s.To},
+	}
+	var credits, debits int
+	for _, l := range s.Lines {
+		if l.Credit() {
+			credits++
+		} else {
+			debits++
+		}
+		st.Stmt.Ntry = append(st.Stmt.Ntry, camtEntry{
+			NtryRef:     strconv.Itoa(l.TransactionID),
+			Amt:         camtAmount{s.Currency, amount(l.Amount)},
+			CdtDbtInd:   creditDebit(l.Credit()),
+			Sts:         "BOOK",
+			BookgDt:     l.BookingDate,
+			ValDt:       l.ValueDate,
+			AcctSvcrRef: strconv.Itoa(l.TransactionID),
+			BkTxCd:      l.Type,
+			Ustrd:       l.Narration,
+		})
+	}
+	sum := st.Stmt.TxsSummry
+	sum.TtlNtries = camtSummary{strconv.Itoa(len(s.Lines)), amount(s.TotalCredit + s.TotalDebit)}
+	sum.TtlCdtNtries = camtSummary{strconv.Itoa(credits), amount(s.TotalCredit)}
+	sum.TtlDbtNtries = camtSummary{strconv.Itoa(debits), amount(s.TotalDebit)}
+	st.Stmt.TxsSummry = sum
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,34 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes s as CSV with one row per entry, framed by opening and
+// closing balance rows. Debits and credits are in separate unsigned columns
+// so the file imports cleanly into spreadsheets and ERP systems.
+func WriteCSV(w io.Writer, s *Statement) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"account_number", "currency", "booking_date", "value_date", "transaction_id", "type", "narration", "debit", "credit", "balance"},
+		{s.AccountNumber, s.Currency, s.From, s.From, "", "", "Opening balance", "", "", strconv.FormatFloat(s.Opening, 'f', 2, 64)},
+	}
+	for _, l := range s.Lines {
+		debit, credit := "", amount(l.Amount)
+		if !l.Credit() {
+			debit, credit = credit, ""
+		}
+		rows = append(rows, []string{
+			s.AccountNumber, s.Currency, l.BookingDate, l.ValueDate, strconv.Itoa(l.TransactionID), l.Type, l.Narration,
+			debit, credit, strconv.FormatFloat(l.Balance, 'f', 2, 64),
+		})
+	}
+	rows = append(rows, []string{s.AccountNumber, s.Currency, s.To, s.To, "", "", "Closing balance",
+		amount(s.TotalDebit), amount(s.TotalCredit), strconv.FormatFloat(s.Closing, 'f', 2, 64)})
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
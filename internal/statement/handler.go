@@ -0,0 +1,106 @@
+package statement
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/problem"
+	"github.com/example/real_time_core_banking_v9/internal/request"
+)
+
+// Handler manages HTTP requests for statement exports.
+type Handler struct {
+	repo     *Repo
+	accounts *account.Repo
+	owners   auth.Owners
+}
+
+// NewHandler creates a statement handler. accounts and owners resolve the
+// login of the customer holding an account.
+func NewHandler(r *Repo, accounts *account.Repo, owners auth.Owners) *Handler {
+	return &Handler{repo: r, accounts: accounts, owners: owners}
+}
+
+// Export handles GET /v1/accounts/{number}/statement?from=&to=&format=, and
+// the legacy /v1/accounts/statement?account_number=.
+// Dates are booking dates (YYYY-MM-DD) and default to the month to date;
+// format is json, csv, pdf, camt053 or mt940 and defaults to json. Only the
+// account holder and staff may export a statement.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	acct := request.Param(r, "number", "account_number")
+	if acct == "" {
+		problem.Write(w, r, problem.Invalid(problem.Field("account_number", "is required")))
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = FormatJSON
+	}
+	switch format {
+	case FormatJSON, FormatCSV, FormatPDF, FormatCamt053, FormatMT940:
+	default:
+		problem.Write(w, r, problem.Invalid(problem.Field("format", "must be one of json, csv, pdf, camt053, mt940")))
+		return
+	}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("from", "must be YYYY-MM-DD")))
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(calendar.DateLayout, v); err != nil {
+			problem.Write(w, r, problem.Invalid(problem.Field("to", "must be YYYY-MM-DD")))
+			return
+		}
+	}
+	if to.Before(from) {
+		problem.Write(w, r, problem.Invalid(problem.Field("to", "must not be before from")))
+		return
+	}
+	a, err := h.accounts.GetByAccountNumber(r.Context(), acct)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("account not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if err := auth.AllowCustomer(r, h.owners, a.CustomerID, auth.RoleTeller, auth.RoleAdmin); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	s, err := h.repo.Load(acct, from, to)
+	if err == sql.ErrNoRows {
+		problem.Write(w, r, problem.NotFound("account not found"))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	// render fully before writing so a failure still yields a clean error
+	var buf bytes.Buffer
+	if err := Render(&buf, s, format); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	ctype, ext := ContentType(format)
+	w.Header().Set("Content-Type", ctype)
+	if format != FormatJSON {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s-%s.%s"`, s.AccountNumber, s.ID, ext))
+	}
+	w.Write(buf.Bytes())
+}
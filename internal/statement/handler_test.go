@@ -0,0 +1,34 @@
+package statement
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/auth"
+	"github.com/example/real_time_core_banking_v9/internal/customer"
+	"github.com/example/real_time_core_banking_v9/internal/sqltest"
+)
+
+func TestExportForbiddenToOtherUsers(t *testing.T) {
+	db := sqltest.Open(
+		sqltest.Reply{Match: "FROM accounts WHERE account_number=$1", Cols: []string{"id", "customer_id", "account_number", "currency", "product", "balance", "created_at"},
+			Rows: [][]driver.Value{{int64(1), int64(5), "ACC1", "USD", "savings", 100.0, time.Now()}}},
+		sqltest.Reply{Match: "SELECT user_id FROM customers", Cols: []string{"user_id"}, Rows: [][]driver.Value{{int64(7)}}},
+	)
+	h := NewHandler(NewRepo(db, nil), account.NewRepo(db), customer.NewRepo(db, nil))
+	req := httptest.NewRequest(http.MethodGet, "/v1/accounts/ACC1/statement", nil)
+	req.SetPathValue("number", "ACC1")
+	claims := jwt.MapClaims{"sub": float64(8), "role": auth.RoleUser}
+	rec := httptest.NewRecorder()
+	h.Export(rec, req.WithContext(context.WithValue(req.Context(), "claims", claims)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,97 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+)
+
+// WriteMT940 writes s as a SWIFT MT940 customer statement message (text
+// block only, CRLF line endings) as accepted by most ERP bank imports.
+func WriteMT940(w io.Writer, s *Statement) error {
+	var b strings.Builder
+	field := func(tag, value string) { b.WriteString(":" + tag + ":" + value + "\r\n") }
+	field("20", swiftText(s.ID, 16))
+	field("25", swiftText(s.AccountNumber, 35))
+	field("28C", "1/1")
+	field("60F", mtBalance(s.Opening, s.From, s.Currency))
+	for _, l := range s.Lines {
+		mark := "C"
+		if !l.Credit() {
+			mark = "D"
+		}
+		field("61", fmt.Sprintf("%s%s%s%sN%sNONREF//%d",
+			mtDate(l.ValueDate, "060102"), mtDate(l.BookingDate, "0102"), mark, mtAmount(l.Amount), mtCode(l.Type), l.TransactionID))
+		if l.Narration != "" {
+			field("86", strings.Join(wrap(swiftText(l.Narration, 390), 65), "\r\n"))
+		}
+	}
+	field("62F", mtBalance(s.Closing, s.To, s.Currency))
+	b.WriteString("-\r\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mtBalance formats a :60F:/:62F: balance: mark, date, currency, amount.
+func mtBalance(bal float64, date, currency string) string {
+	mark := "C"
+	if bal < 0 {
+		mark = "D"
+	}
+	return mark + mtDate(date, "060102") + currency + mtAmount(bal)
+}
+
+// mtAmount formats an unsigned amount with a decimal comma.
+func mtAmount(f float64) string { return strings.Replace(amount(f), ".", ",", 1) }
+
+func mtDate(date, layout string) string {
+	d, err := time.Parse(calendar.DateLayout, date)
+	if err != nil {
+		return strings.Repeat("0", len(layout))
+	}
+	return d.Format(layout)
+}
+
+// mtCode maps a transaction type to a SWIFT transaction type identification
+// code.
+func mtCode(typ string) string {
+	switch typ {
+	case "transfer_debit", "transfer_credit":
+		return "TRF"
+	case "fee":
+		return "CHG"
+	case "interest":
+		return "INT"
+	}
+	return "MSC"
+}
+
+// swiftText reduces v to the SWIFT X character set and truncates it to max
+// characters.
+func swiftText(v string, max int) string {
+	out := make([]rune, 0, len(v))
+	for _, r := range v {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("/-?:().,'+ ", r):
+			out = append(out, r)
+		default:
+			out = append(out, ' ')
+		}
+		if len(out) == max {
+			break
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func wrap(v string, width int) []string {
+	var out []string
+	for len(v) > width {
+		out = append(out, v[:width])
+		v = v[width:]
+	}
+	return append(out, v)
+}
@@ -0,0 +1,143 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page geometry in points.
+const (
+	pdfWidth     = 595
+	pdfHeight    = 842
+	pdfMargin    = 40
+	pdfRowHeight = 11
+	pdfTableTop  = 700
+	pdfTableEnd  = 60
+)
+
+// pdfRow is the fixed-width layout of a table row in Courier 8pt.
+const pdfRow = "%-10s %-10s %-15s %-26s %11s %11s %12s"
+
+// pdfDoc is a minimal PDF 1.4 writer for text-only pages. It uses the
+// standard Helvetica and Courier fonts, which every viewer provides, so no
+// fonts need to be embedded.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	cur   *bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDoc) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(d.cur, "BT /%s %.0f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+func (d *pdfDoc) rule(y float64) {
+	fmt.Fprintf(d.cur, "%d %.2f m %d %.2f l S\n", pdfMargin, y, pdfWidth-pdfMargin, y)
+}
+
+// newPage starts a page with the statement header and the table heading.
+func (d *pdfDoc) newPage(s *Statement) {
+	d.cur = &bytes.Buffer{}
+	d.pages = append(d.pages, d.cur)
+	d.text("F2", 16, pdfMargin, 800, "Account Statement")
+	d.text("F1", 10, pdfMargin, 780, fmt.Sprintf("Account: %s (%s)", s.AccountNumber, s.Currency))
+	d.text("F1", 10, pdfMargin, 766, "Account holder: "+s.Holder)
+	d.text("F1", 10, pdfMargin, 752, fmt.Sprintf("Period: %s to %s", s.From, s.To))
+	d.text("F1", 8, pdfMargin, 738, "Generated "+s.GeneratedAt.Format("2006-01-02 15:04 MST"))
+	d.text("F3", 8, pdfMargin, pdfTableTop+14, fmt.Sprintf(pdfRow, "Booked", "Value", "Type", "Description", "Debit", "Credit", "Balance"))
+	d.rule(pdfTableTop + 10)
+	d.y = pdfTableTop
+}
+
+// row writes a table row, breaking to a new page when the page is full.
+func (d *pdfDoc) row(s *Statement, line string) {
+	if d.y < pdfTableEnd {
+		d.newPage(s)
+	}
+	d.text("F3", 8, pdfMargin, d.y, line)
+	d.y -= pdfRowHeight
+}
+
+// WritePDF renders s as a paginated A4 PDF document.
+func WritePDF(w io.Writer, s *Statement) error {
+	d := &pdfDoc{}
+	d.newPage(s)
+	d.row(s, fmt.Sprintf(pdfRow, s.From, "", "", "Opening balance", "", "", signed(s.Opening)))
+	for _, l := range s.Lines {
+		debit, credit := "", amount(l.Amount)
+		if !l.Credit() {
+			debit, credit = credit, ""
+		}
+		d.row(s, fmt.Sprintf(pdfRow, l.BookingDate, l.ValueDate, clip(l.Type, 15), clip(l.Narration, 26), debit, credit, signed(l.Balance)))
+	}
+	d.row(s, fmt.Sprintf(pdfRow, s.To, "", "", "Closing balance", amount(s.TotalDebit), amount(s.TotalCredit), signed(s.Closing)))
+	for i, p := range d.pages {
+		d.cur = p
+		d.text("F1", 8, pdfWidth-pdfMargin-60, 30, fmt.Sprintf("Page %d of %d", i+1, len(d.pages)))
+	}
+	return d.write(w)
+}
+
+// write serializes the document: catalog, page tree, fonts, then a page and
+// content stream object per page, followed by the cross-reference table.
+func (d *pdfDoc) write(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfEscape makes s safe inside a PDF literal string, replacing anything
+// outside printable ASCII.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func signed(f float64) string { return fmt.Sprintf("%.2f", f) }
+
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "~"
+}
@@ -0,0 +1,79 @@
+package statement
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/example/real_time_core_banking_v9/internal/account"
+	"github.com/example/real_time_core_banking_v9/internal/calendar"
+	"github.com/example/real_time_core_banking_v9/internal/customer"
+	"github.com/example/real_time_core_banking_v9/internal/pii"
+)
+
+// Repo loads statement data.
+type Repo struct {
+	db     *sql.DB
+	cipher *pii.Cipher
+}
+
+// NewRepo creates a statement repository. The cipher opens sealed holder
+// names and may be nil.
+func NewRepo(db *sql.DB, c *pii.Cipher) *Repo { return &Repo{db: db, cipher: c} }
+
+// Load builds the statement of an account for booking dates in [from, to].
+// The closing balance is the live balance with postings booked after to
+// backed out, so it agrees with the account even if it was opened, before
+// opening balances were journaled, with a balance that has no entry.
+func (r *Repo) Load(accountNumber string, from, to time.Time) (*Statement, error) {
+	s := &Statement{
+		AccountNumber: accountNumber,
+		From:          from.Format(calendar.DateLayout),
+		To:            to.Format(calendar.DateLayout),
+		GeneratedAt:   time.Now().UTC(),
+		Lines:         []*Line{},
+	}
+	var id int
+	var live, after float64
+	var first, last sql.NullString
+	err := r.db.QueryRow(`
+		SELECT a.id, COALESCE(a.currency,'USD'), a.balance, c.first_name, c.last_name
+		FROM accounts a LEFT JOIN customers c ON c.id = a.customer_id
+		WHERE a.account_number=$1`, accountNumber).Scan(&id, &s.Currency, &live, &first, &last)
+	if err != nil {
+		return nil, err
+	}
+	if s.Holder, err = customer.HolderName(r.cipher, first, last); err != nil {
+		return nil, err
+	}
+	if err := r.db.QueryRow(`SELECT COALESCE(SUM(`+account.SignedAmountSQL+`),0) FROM transactions
+		WHERE account_id=$1 AND booking_date > $2`, id, to).Scan(&after); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(`
+		SELECT id, to_char(booking_date,'YYYY-MM-DD'), to_char(COALESCE(value_date, booking_date),'YYYY-MM-DD'),
+			COALESCE(type,''), COALESCE(narration,''), `+account.SignedAmountSQL+`
+		FROM transactions
+		WHERE account_id=$1 AND booking_date BETWEEN $2 AND $3
+		ORDER BY booking_date, id`, id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var period float64
+	for rows.Next() {
+		l := &Line{}
+		if err := rows.Scan(&l.TransactionID, &l.BookingDate, &l.ValueDate, &l.Type, &l.Narration, &l.Amount); err != nil {
+			return nil, err
+		}
+		period += l.Amount
+		s.Lines = append(s.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.Opening = round(live - after - period)
+	s.ID = fmt.Sprintf("%s-%s", from.Format("20060102"), to.Format("20060102"))
+	s.compute()
+	return s, nil
+}
@@ -0,0 +1,110 @@
+// Package statement builds account statements over a booking date range and
+// renders them for download as CSV, PDF, ISO 20022 camt.053 or SWIFT MT940.
+// Every format carries the opening and closing balance and a running balance
+// per entry.
+package statement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Export formats.
+const (
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatPDF     = "pdf"
+	FormatCamt053 = "camt053"
+	FormatMT940   = "mt940"
+)
+
+// Line is one booked entry on a statement. Amount is signed by its effect on
+// the balance and Balance is the running balance after the entry.
+type Line struct {
+	TransactionID int     `json:"transaction_id"`
+	BookingDate   string  `json:"booking_date"`
+	ValueDate     string  `json:"value_date"`
+	Type          string  `json:"type"`
+	Narration     string  `json:"narration"`
+	Amount        float64 `json:"amount"`
+	Balance       float64 `json:"balance"`
+}
+
+// Credit reports whether the entry increased the balance.
+func (l *Line) Credit() bool { return l.Amount >= 0 }
+
+// Statement is an account's entries between two booking dates, inclusive.
+type Statement struct {
+	ID            string    `json:"id"`
+	AccountNumber string    `json:"account_number"`
+	Currency      string    `json:"currency"`
+	Holder        string    `json:"holder"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Opening       float64   `json:"opening_balance"`
+	Closing       float64   `json:"closing_balance"`
+	TotalCredit   float64   `json:"total_credit"`
+	TotalDebit    float64   `json:"total_debit"`
+	Lines         []*Line   `json:"lines"`
+}
+
+// compute fills in the running balances, totals and closing balance from the
+// opening balance and the signed line amounts.
+func (s *Statement) compute() {
+	bal := s.Opening
+	s.TotalCredit, s.TotalDebit = 0, 0
+	for _, l := range s.Lines {
+		bal = round(bal + l.Amount)
+		l.Balance = bal
+		if l.Credit() {
+			s.TotalCredit += l.Amount
+		} else {
+			s.TotalDebit -= l.Amount
+		}
+	}
+	s.TotalCredit, s.TotalDebit = round(s.TotalCredit), round(s.TotalDebit)
+	s.Closing = bal
+}
+
+// ContentType returns the MIME type and file extension of a format.
+func ContentType(format string) (string, string) {
+	switch format {
+	case FormatCSV:
+		return "text/csv", "csv"
+	case FormatPDF:
+		return "application/pdf", "pdf"
+	case FormatCamt053:
+		return "application/xml", "xml"
+	case FormatMT940:
+		return "text/plain", "sta"
+	}
+	return "application/json", "json"
+}
+
+// Render writes s to w in the given format.
+func Render(w io.Writer, s *Statement, format string) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, s)
+	case FormatCSV:
+		return WriteCSV(w, s)
+	case FormatPDF:
+		return WritePDF(w, s)
+	case FormatCamt053:
+		return WriteCamt053(w, s)
+	case FormatMT940:
+		return WriteMT940(w, s)
+	}
+	return fmt.Errorf("unknown statement format %q", format)
+}
+
+func writeJSON(w io.Writer, s *Statement) error { return json.NewEncoder(w).Encode(s) }
+
+func round(f float64) float64 { return math.Round(f*100) / 100 }
+
+// amount formats an unsigned amount with two decimals.
+func amount(f float64) string { return fmt.Sprintf("%.2f", math.Abs(f)) }
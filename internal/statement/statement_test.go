@@ -0,0 +1,111 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sample() *Statement {
+	s := &Statement{
+		ID: "20240101-20240131", AccountNumber: "ACC123", Currency: "USD", Holder: "Jane Doe",
+		From: "2024-01-01", To: "2024-01-31", GeneratedAt: time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC),
+		Opening: 100,
+		Lines: []*Line{
+			{TransactionID: 1, BookingDate: "2024-01-05", ValueDate: "2024-01-05", Type: "deposit", Narration: "Salary (Jan)", Amount: 250.5},
+			{TransactionID: 2, BookingDate: "2024-01-10", ValueDate: "2024-01-11", Type: "transfer_debit", Narration: "Rent", Amount: -400},
+		},
+	}
+	s.compute()
+	return s
+}
+
+func TestCompute(t *testing.T) {
+	s := sample()
+	if s.Lines[0].Balance != 350.5 || s.Lines[1].Balance != -49.5 {
+		t.Errorf("running balances = %v, %v", s.Lines[0].Balance, s.Lines[1].Balance)
+	}
+	if s.Closing != -49.5 || s.TotalCredit != 250.5 || s.TotalDebit != 400 {
+		t.Errorf("closing=%v credit=%v debit=%v", s.Closing, s.TotalCredit, s.TotalDebit)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, sample()); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("got %d rows, want 5", len(rows))
+	}
+	if rows[3][7] != "400.00" || rows[3][9] != "-49.50" || rows[4][9] != "-49.50" {
+		t.Errorf("unexpected rows: %v", rows[3:])
+	}
+}
+
+func TestWriteMT940(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMT940(&buf, sample()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		":25:ACC123\r\n",
+		":60F:C240101USD100,00\r\n",
+		":61:2401050105C250,50NMSCNONREF//1\r\n",
+		":86:Salary (Jan)\r\n",
+		":61:2401110110D400,00NTRFNONREF//2\r\n",
+		":62F:D240131USD49,50\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("MT940 missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteCamt053(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCamt053(&buf, sample()); err != nil {
+		t.Fatal(err)
+	}
+	var doc camtDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	st := doc.Stmt.Stmt
+	if len(st.Ntry) != 2 || st.Ntry[1].CdtDbtInd != "DBIT" || st.Ntry[1].Amt.Value != "400.00" {
+		t.Errorf("unexpected entries: %+v", st.Ntry)
+	}
+	if len(st.Bal) != 2 || st.Bal[1].Type != "CLBD" || st.Bal[1].CdtDbtInd != "DBIT" || st.Bal[1].Amt.Value != "49.50" {
+		t.Errorf("unexpected balances: %+v", st.Bal)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	s := sample()
+	for i := 0; i < 120; i++ {
+		s.Lines = append(s.Lines, &Line{TransactionID: 10 + i, BookingDate: "2024-01-20", ValueDate: "2024-01-20", Type: "deposit", Amount: 1})
+	}
+	s.compute()
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-1.4") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatal("not a PDF document")
+	}
+	if !strings.Contains(out, "/Count 3") || !strings.Contains(out, "Page 3 of 3") {
+		t.Error("expected three pages")
+	}
+	if !strings.Contains(out, `Salary \(Jan\)`) {
+		t.Error("narration not escaped")
+	}
+}
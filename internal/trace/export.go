@@ -0,0 +1,178 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// scope names the instrumentation in exported spans.
+const scope = "github.com/example/real_time_core_banking_v9/internal/trace"
+
+// JSONExporter writes each finished span as one OTLP/JSON
+// ExportTraceServiceRequest per line.
+type JSONExporter struct {
+	service string
+
+	mu sync.Mutex
+	w  *bufio.Writer
+	c  io.Closer
+}
+
+// NewJSONExporter writes spans for service to w. If w is an io.Closer it
+// is closed with the exporter.
+func NewJSONExporter(service string, w io.Writer) *JSONExporter {
+	e := &JSONExporter{service: service, w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok && w != os.Stdout && w != os.Stderr {
+		e.c = c
+	}
+	return e
+}
+
+// Export implements Exporter. Lines are flushed as they are written so a
+// crash loses at most the span being written.
+func (e *JSONExporter) Export(s *Span) error {
+	b, err := json.Marshal(e.request(s))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(b)
+	e.w.WriteByte('\n')
+	return e.w.Flush()
+}
+
+// Close implements Exporter.
+func (e *JSONExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.w.Flush()
+	if e.c != nil {
+		if cerr := e.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              Kind           `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	// otlpValue is an AnyValue; 64-bit integers are strings in OTLP/JSON.
+	otlpValue struct {
+		String *string  `json:"stringValue,omitempty"`
+		Bool   *bool    `json:"boolValue,omitempty"`
+		Int    *string  `json:"intValue,omitempty"`
+		Double *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+func (e *JSONExporter) request(s *Span) otlpRequest {
+	s.mu.Lock()
+	span := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        keyValues(s.attrs),
+		Status:            otlpStatus{Code: s.status, Message: s.statusMsg},
+	}
+	s.mu.Unlock()
+	if s.parent.IsValid() {
+		span.ParentSpanID = s.parent.String()
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: keyValues([]Attr{String("service.name", e.service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scope}, Spans: []otlpSpan{span}}},
+	}}}
+}
+
+func keyValues(attrs []Attr) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpValue
+		switch x := a.Value.(type) {
+		case string:
+			v.String = &x
+		case bool:
+			v.Bool = &x
+		case int:
+			s := strconv.Itoa(x)
+			v.Int = &s
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.Int = &s
+		case float64:
+			v.Double = &x
+		default:
+			s := fmt.Sprint(x)
+			v.String = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
+
+// Open builds a tracer for service. exporter is "none" (or empty),
+// "stdout" or "file"; the file exporter appends to path, default
+// traces.jsonl. It returns nil when tracing is off.
+func Open(service, exporter, path string, onError func(error)) (*Tracer, error) {
+	switch exporter {
+	case "", "none":
+		return nil, nil
+	case "stdout", "console":
+		return NewTracer(service, NewJSONExporter(service, os.Stdout), onError), nil
+	case "file":
+		if path == "" {
+			path = "traces.jsonl"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("trace: open %s: %w", path, err)
+		}
+		return NewTracer(service, NewJSONExporter(service, f), onError), nil
+	default:
+		return nil, fmt.Errorf("trace: unsupported exporter %q", exporter)
+	}
+}
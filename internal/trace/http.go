@@ -0,0 +1,73 @@
+package trace
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+)
+
+// HeaderTraceparent is the W3C trace context header.
+const HeaderTraceparent = "traceparent"
+
+// statusRecorder captures the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Middleware starts a server span for every request, continuing the trace
+// of an inbound traceparent header, and adds its trace id to the request's
+// log fields. route names the registered route, as for metrics.Middleware.
+// It must run inside logging.Middleware.
+func Middleware(next http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header.Get(HeaderTraceparent))
+		rt := route(r)
+		if rt == "" {
+			rt = "unmatched"
+		}
+		// no url.path: resource paths carry account numbers
+		ctx, span := Start(ctx, r.Method+" "+rt, KindServer,
+			String("http.request.method", r.Method),
+			String("http.route", rt),
+		)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+		logging.AddFields(ctx, logrus.Fields{"trace_id": span.SpanContext().TraceID.String()})
+		if id := logging.RequestID(ctx); id != "" {
+			span.SetAttributes(String("request_id", id))
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			span.SetError(strconv.Itoa(rec.status) + " " + http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package trace
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisHook records a client span for each Redis command or pipeline issued
+// inside a trace. Add it with rdb.AddHook.
+type RedisHook struct{}
+
+// BeforeProcess implements redis.Hook.
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = StartChild(ctx, "redis "+cmd.Name(), KindClient,
+		String("db.system", "redis"), String("db.operation", cmd.Name()))
+	return ctx, nil
+}
+
+// AfterProcess implements redis.Hook.
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedis(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implements redis.Hook.
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = StartChild(ctx, "redis pipeline", KindClient,
+		String("db.system", "redis"), Int("db.redis.commands", len(cmds)))
+	return ctx, nil
+}
+
+// AfterProcessPipeline implements redis.Hook.
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, c := range cmds {
+		if c.Err() != nil {
+			err = c.Err()
+		}
+	}
+	endRedis(ctx, err)
+	return nil
+}
+
+// endRedis ends the span started by the Before hook. The span in ctx is
+// only ours if it is a Redis client span; otherwise no span was started.
+func endRedis(ctx context.Context, err error) {
+	s := FromContext(ctx)
+	if s == nil || s.kind != KindClient {
+		return
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		s.RecordError(err)
+	}
+	s.End()
+}
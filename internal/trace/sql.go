@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+)
+
+// WrapConnector returns a connector whose connections record a client span
+// for every statement run with a context that carries a trace. Use it with
+// sql.OpenDB. Statements run through the context-free database/sql methods,
+// such as db.Query, have no parent and are not recorded.
+func WrapConnector(c driver.Connector) driver.Connector { return &connector{c} }
+
+type connector struct{ driver.Connector }
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{cn}, nil
+}
+
+// startSQL starts the span for one statement. Only the statement text is
+// recorded: arguments may hold customer data.
+func startSQL(ctx context.Context, query string) (context.Context, *Span) {
+	op := strings.ToUpper(strings.Fields(query + " x")[0])
+	return StartChild(ctx, op, KindClient,
+		String("db.system", "postgresql"),
+		String("db.operation", op),
+		String("db.statement", query),
+	)
+}
+
+// endSQL ends s, treating driver.ErrSkip as a fallback rather than a failure.
+func endSQL(s *Span, err error) {
+	if err != nil && err != driver.ErrSkip {
+		s.RecordError(err)
+	}
+	s.End()
+}
+
+// conn wraps a driver connection. database/sql checks for the optional
+// interfaces, so each one is implemented by delegating, falling back to
+// what database/sql would do if the driver does not support it.
+type conn struct{ driver.Conn }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		st  driver.Stmt
+		err error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: st, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	_, span := startSQL(ctx, "BEGIN")
+	var (
+		t   driver.Tx
+		err error
+	)
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = b.BeginTx(ctx, opts)
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	endSQL(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, ctx: ctx}, nil
+}
+
+// tx records commit and rollback in the trace the transaction began in, as
+// a slow commit is part of a slow request.
+type tx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (t *tx) Commit() error {
+	_, span := startSQL(t.ctx, "COMMIT")
+	err := t.Tx.Commit()
+	endSQL(span, err)
+	return err
+}
+
+func (t *tx) Rollback() error {
+	_, span := startSQL(t.ctx, "ROLLBACK")
+	err := t.Tx.Rollback()
+	endSQL(span, err)
+	return err
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	_, span := startSQL(ctx, query)
+	res, err := e.ExecContext(ctx, query, args)
+	endSQL(span, err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	_, span := startSQL(ctx, query)
+	rows, err := q.QueryContext(ctx, query, args)
+	endSQL(span, err)
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// stmt wraps a prepared statement so its executions are recorded too.
+type stmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	_, span := startSQL(ctx, s.query)
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(values(args))
+	}
+	endSQL(span, err)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	_, span := startSQL(ctx, s.query)
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(values(args))
+	}
+	endSQL(span, err)
+	return rows, err
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
@@ -0,0 +1,300 @@
+// Package trace records OpenTelemetry-compatible spans without the OTel SDK.
+// Spans carry W3C trace context, so a traceparent can be read from incoming
+// requests and written into queued messages, and finished spans are written
+// as OTLP JSON, one export request per line, the format the OTel
+// Collector's file receiver and exporter use.
+//
+// Tracing is off until a Tracer is installed with SetTracer. While off,
+// Start returns a nil *Span, and every Span method is safe on nil.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is not all zeroes.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is not all zeroes.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether sc has a trace and span id.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent reads a W3C traceparent header value.
+func ParseTraceparent(v string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, errors.New("trace: malformed traceparent")
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, errors.New("trace: malformed traceparent")
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, errors.New("trace: malformed trace id")
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, errors.New("trace: malformed span id")
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, errors.New("trace: malformed flags")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("trace: zero trace or span id")
+	}
+	return sc, nil
+}
+
+// Kind is the role of a span, numbered as in OTLP.
+type Kind int
+
+// Span kinds.
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+	KindProducer Kind = 4
+	KindConsumer Kind = 5
+)
+
+// Attr is a span attribute. Value is a string, bool, int, int64 or float64.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String, Int, Float and Bool build attributes.
+func String(k, v string) Attr        { return Attr{k, v} }
+func Int(k string, v int) Attr       { return Attr{k, int64(v)} }
+func Float(k string, v float64) Attr { return Attr{k, v} }
+func Bool(k string, v bool) Attr     { return Attr{k, v} }
+
+// Status codes, numbered as in OTLP.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Span is one timed operation in a trace.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	name   string
+	kind   Kind
+	start  time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     []Attr
+	status    int
+	statusMsg string
+	ended     bool
+}
+
+// SpanContext returns the identity of s, or a zero value for a nil span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds attributes to s.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// SetError marks s as failed with msg.
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.status, s.statusMsg = StatusError, msg
+	s.mu.Unlock()
+}
+
+// RecordError marks s as failed with err, if err is not nil.
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetError(err.Error())
+	}
+}
+
+// End finishes s and hands it to the exporter. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(s *Span) error
+	Close() error
+}
+
+// Tracer creates spans for one service and passes them to an exporter.
+type Tracer struct {
+	service string
+	exp     Exporter
+	onError func(error)
+}
+
+// NewTracer creates a tracer. Export errors are passed to onError, which
+// may be nil.
+func NewTracer(service string, exp Exporter, onError func(error)) *Tracer {
+	return &Tracer{service: service, exp: exp, onError: onError}
+}
+
+// Close flushes and closes the exporter.
+func (t *Tracer) Close() error { return t.exp.Close() }
+
+func (t *Tracer) export(s *Span) {
+	if err := t.exp.Export(s); err != nil && t.onError != nil {
+		t.onError(err)
+	}
+}
+
+var current atomic.Pointer[Tracer]
+
+// SetTracer installs t as the process tracer; nil turns tracing off.
+func SetTracer(t *Tracer) { current.Store(t) }
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemote returns ctx carrying a parent span context received from
+// another process, so the next span started from it joins that trace.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// parentOf returns the span context a new span in ctx descends from.
+func parentOf(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// Start begins a span as a child of the span or remote parent in ctx, or as
+// the root of a new trace. It returns ctx unchanged and a nil span while
+// tracing is off.
+func Start(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	t := current.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent := parentOf(ctx)
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent.IsValid() {
+		s.sc.TraceID, s.parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+	}
+	rand.Read(s.sc.SpanID[:])
+	s.sc.Sampled = true
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartChild is Start for spans that are only worth recording inside a
+// trace, such as SQL statements and Redis commands: without a parent in ctx
+// it starts nothing.
+func StartChild(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	if !parentOf(ctx).IsValid() {
+		return ctx, nil
+	}
+	return Start(ctx, name, kind, attrs...)
+}
+
+// Inject returns the traceparent of the span in ctx, or "" if there is none.
+func Inject(ctx context.Context) string {
+	sc := parentOf(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.Traceparent()
+}
+
+// Extract returns ctx carrying the remote parent in traceparent, or ctx
+// unchanged if traceparent is empty or malformed.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemote(ctx, sc)
+}
+
+// TraceIDFrom returns the trace id of the span in ctx as hex, or "".
+func TraceIDFrom(ctx context.Context) string {
+	sc := parentOf(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
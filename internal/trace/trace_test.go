@@ -0,0 +1,277 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/example/real_time_core_banking_v9/internal/logging"
+)
+
+// memExporter collects finished spans.
+type memExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (m *memExporter) Export(s *Span) error {
+	m.mu.Lock()
+	m.spans = append(m.spans, s)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memExporter) Close() error { return nil }
+
+func (m *memExporter) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, s := range m.spans {
+		out = append(out, s.name)
+	}
+	return out
+}
+
+func install(t *testing.T) *memExporter {
+	t.Helper()
+	exp := &memExporter{}
+	SetTracer(NewTracer("test", exp, nil))
+	t.Cleanup(func() { SetTracer(nil) })
+	return exp
+}
+
+func TestTraceparent(t *testing.T) {
+	const v = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("parsed %+v", sc)
+	}
+	if got := sc.Traceparent(); got != v {
+		t.Fatalf("round trip = %q", got)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Errorf("ParseTraceparent(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	SetTracer(nil)
+	ctx, span := Start(context.Background(), "op", KindInternal)
+	if span != nil || FromContext(ctx) != nil || Inject(ctx) != "" {
+		t.Fatal("span started with tracing off")
+	}
+	// nil spans are no-ops
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(io.EOF)
+	span.End()
+}
+
+func TestPropagation(t *testing.T) {
+	exp := install(t)
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	ctx, root := Start(Extract(context.Background(), parent), "consume", KindConsumer)
+	if got := root.SpanContext().TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id = %s, want the remote one", got)
+	}
+	if root.parent.String() != "00f067aa0ba902b7" {
+		t.Fatalf("parent = %s", root.parent)
+	}
+	_, child := StartChild(ctx, "SELECT", KindClient)
+	if child == nil || child.parent != root.sc.SpanID || child.sc.TraceID != root.sc.TraceID {
+		t.Fatal("child not linked to its parent")
+	}
+	if got, _ := ParseTraceparent(Inject(ctx)); got.SpanID != root.sc.SpanID {
+		t.Fatal("Inject did not carry the current span")
+	}
+	child.End()
+	root.End()
+	root.End()
+	if got := exp.names(); len(got) != 2 {
+		t.Fatalf("exported %v, want each span once", got)
+	}
+
+	if _, s := StartChild(context.Background(), "SELECT", KindClient); s != nil {
+		t.Fatal("StartChild started a span without a parent")
+	}
+	if Extract(context.Background(), "garbage") != context.Background() {
+		t.Fatal("malformed traceparent was accepted")
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	SetTracer(NewTracer("rtcb-api", NewJSONExporter("rtcb-api", &buf), nil))
+	defer SetTracer(nil)
+
+	_, s := Start(context.Background(), "POST /v1/accounts/transfer", KindServer,
+		String("http.route", "/v1/accounts/transfer"), Int("http.response.status_code", 500), Bool("retry", false), Float("ratio", 0.5))
+	s.SetError("boom")
+	s.End()
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID, SpanID, Name              string
+					Kind                               int
+					StartTimeUnixNano, EndTimeUnixNano string
+					Attributes                         []struct {
+						Key   string
+						Value map[string]interface{}
+					}
+					Status struct {
+						Code    int
+						Message string
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "}\n") || strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("want one line per span: %q", buf.String())
+	}
+	rs := req.ResourceSpans[0]
+	if rs.Resource.Attributes[0].Key != "service.name" || rs.Resource.Attributes[0].Value["stringValue"] != "rtcb-api" {
+		t.Fatalf("resource = %+v", rs.Resource)
+	}
+	sp := rs.ScopeSpans[0].Spans[0]
+	if sp.Name != "POST /v1/accounts/transfer" || sp.Kind != int(KindServer) || len(sp.TraceID) != 32 || len(sp.SpanID) != 16 {
+		t.Fatalf("span = %+v", sp)
+	}
+	if sp.StartTimeUnixNano == "" || sp.EndTimeUnixNano < sp.StartTimeUnixNano {
+		t.Fatalf("times = %s..%s", sp.StartTimeUnixNano, sp.EndTimeUnixNano)
+	}
+	if sp.Status.Code != StatusError || sp.Status.Message != "boom" {
+		t.Fatalf("status = %+v", sp.Status)
+	}
+	want := map[string]string{"http.route": "stringValue", "http.response.status_code": "intValue", "retry": "boolValue", "ratio": "doubleValue"}
+	for _, a := range sp.Attributes {
+		if _, ok := a.Value[want[a.Key]]; !ok {
+			t.Errorf("attribute %s = %v, want a %s", a.Key, a.Value, want[a.Key])
+		}
+	}
+	if v := sp.Attributes[1].Value["intValue"]; v != "500" {
+		t.Errorf("intValue = %#v, want the string \"500\"", v)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := install(t)
+	var traceID string
+	h := logging.Middleware(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = FromContext(r.Context()).SpanContext().TraceID.String()
+		w.WriteHeader(http.StatusBadGateway)
+	}), func(*http.Request) string { return "/v1/accounts/transfer" }))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/accounts/transfer", nil)
+	req.Header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("handler saw trace %q", traceID)
+	}
+	if got := exp.names(); len(got) != 1 || got[0] != "POST /v1/accounts/transfer" {
+		t.Fatalf("spans = %v", got)
+	}
+	s := exp.spans[0]
+	if s.kind != KindServer || s.status != StatusError {
+		t.Fatalf("span kind %d status %d", s.kind, s.status)
+	}
+}
+
+// fakeDriver is a minimal context-aware driver.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+func (fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+func TestSQLSpans(t *testing.T) {
+	exp := install(t)
+	db := sql.OpenDB(WrapConnector(fakeConnector{}))
+	defer db.Close()
+
+	// no trace in ctx: nothing is recorded
+	if _, err := db.Exec("UPDATE accounts SET balance=$1 WHERE id=$2", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := exp.names(); len(got) != 0 {
+		t.Fatalf("spans without a parent: %v", got)
+	}
+
+	ctx, root := Start(context.Background(), "POST /v1/accounts/transfer", KindServer)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "update accounts SET balance=$1 WHERE id=$2", 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	want := []string{"BEGIN", "UPDATE", "COMMIT", "POST /v1/accounts/transfer"}
+	if got := exp.names(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("spans = %v, want %v", got, want)
+	}
+	upd := exp.spans[1]
+	if upd.parent != root.sc.SpanID || upd.kind != KindClient {
+		t.Fatal("statement span not a client child of the request")
+	}
+	for _, a := range upd.attrs {
+		if a.Key == "db.statement" && a.Value != "update accounts SET balance=$1 WHERE id=$2" {
+			t.Fatalf("db.statement = %v", a.Value)
+		}
+	}
+}
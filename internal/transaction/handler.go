@@ -6,36 +6,131 @@ import (
     "encoding/json"
     "net/http"
     "strconv"
+    "strings"
     "time"
 
     "github.com/go-redis/redis/v8"
     "github.com/sirupsen/logrus"
+
+    "github.com/example/real_time_core_banking_v9/internal/calendar"
+    "github.com/example/real_time_core_banking_v9/internal/health"
+    "github.com/example/real_time_core_banking_v9/internal/logging"
+    "github.com/example/real_time_core_banking_v9/internal/metrics"
+    "github.com/example/real_time_core_banking_v9/internal/page"
+    "github.com/example/real_time_core_banking_v9/internal/problem"
+    "github.com/example/real_time_core_banking_v9/internal/redact"
+    "github.com/example/real_time_core_banking_v9/internal/trace"
 )
 
-type Handler struct { repo *Repo; acctRepo interface{}; rdb *redis.Client }
-func NewHandler(r *Repo, acctRepo interface{}, rdb *redis.Client) *Handler { return &Handler{repo:r, acctRepo:acctRepo, rdb:rdb} }
+// Handler serves transaction listings. Dates in query parameters are read in
+// loc, the bank's time zone.
+type Handler struct { repo *Repo; acctRepo interface{}; rdb *redis.Client; loc *time.Location }
+func NewHandler(r *Repo, acctRepo interface{}, rdb *redis.Client, loc *time.Location) *Handler { return &Handler{repo:r, acctRepo:acctRepo, rdb:rdb, loc:loc} }
 
+// ListTransactions handles GET /v1/accounts/{number}/transactions and the
+// legacy GET /v1/transactions/list?account_id=. Besides the from/to window,
+// which defaults to the last month, it accepts type (comma separated),
+// min_amount, max_amount, q (narration text), counterparty (account
+// number), order and the limit/cursor pagination parameters.
 func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
     q := r.URL.Query()
-    from := q.Get("from")
-    to := q.Get("to")
-    if from=="" { from = time.Now().AddDate(0, -1, 0).Format(time.RFC3339) }
-    if to=="" { to = time.Now().Format(time.RFC3339) }
-    aid := q.Get("account_id")
-    if aid=="" { http.Error(w, "missing", http.StatusBadRequest); return }
-    id, _ := strconv.Atoi(aid)
-    list, err := h.repo.ListForAccount(id, from, to)
-    if err!=nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
-    json.NewEncoder(w).Encode(list)
+    now := time.Now()
+    f := Filter{From: now.AddDate(0, -1, 0), To: now, Text: q.Get("q"), Counterparty: q.Get("counterparty")}
+    for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+        if v := q.Get(name); v!="" {
+            t, err := h.parseTime(v, name=="to")
+            if err!=nil { problem.Write(w, r, problem.Invalid(problem.Field(name, "must be an RFC 3339 timestamp or a YYYY-MM-DD date"))); return }
+            *dst = t
+        }
+    }
+    id, err := h.accountID(r)
+    if err!=nil { problem.Write(w, r, err); return }
+    if v := q.Get("type"); v!="" { f.Types = strings.Split(v, ",") }
+    for name, dst := range map[string]**float64{"min_amount": &f.MinAmount, "max_amount": &f.MaxAmount} {
+        if v := q.Get(name); v!="" {
+            n, err := strconv.ParseFloat(v, 64)
+            if err!=nil { problem.Write(w, r, problem.Invalid(problem.Field(name, "must be a number"))); return }
+            *dst = &n
+        }
+    }
+    p, err := page.FromQuery(q, page.Desc)
+    if err!=nil { problem.Write(w, r, err); return }
+    list, err := h.repo.ListForAccount(id, f, p)
+    if err!=nil { problem.Write(w, r, err); return }
+    json.NewEncoder(w).Encode(page.New(list, p, (*Transaction).Key))
 }
 
-func StartNotificationWorker(rdb *redis.Client, dbConn *sql.DB) {
-    ctx := context.Background()
-    for {
-        res, err := rdb.BRPop(ctx, 0, "notifications").Result()
-        if err!=nil { time.Sleep(1*time.Second); continue }
+// parseTime accepts an RFC 3339 timestamp or a date. A date is the start of
+// that day in the bank's time zone, or its end when endOfDay is set, as for
+// the balance as_of parameter.
+func (h *Handler) parseTime(v string, endOfDay bool) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, v); err==nil { return t, nil }
+    d, err := time.ParseInLocation(calendar.DateLayout, v, h.loc)
+    if err!=nil { return time.Time{}, err }
+    if endOfDay { return d.AddDate(0, 0, 1).Add(-time.Nanosecond), nil }
+    return d, nil
+}
+
+// accountID takes the account from the path, or from account_id on the
+// legacy route.
+func (h *Handler) accountID(r *http.Request) (int, error) {
+    if n := r.PathValue("number"); n!="" {
+        id, err := h.repo.AccountID(n)
+        if err==sql.ErrNoRows { return 0, problem.NotFound("account not found") }
+        return id, err
+    }
+    aid := r.URL.Query().Get("account_id")
+    id, err := strconv.Atoi(aid)
+    if aid=="" || err!=nil { return 0, problem.Invalid(problem.Field("account_id", "must be an account id")) }
+    return id, nil
+}
+
+var notificationsProcessed = metrics.Default.NewCounter("rtcb_notifications_processed_total",
+    "Notifications taken off the queue, by type and outcome.", "type", "outcome")
+
+// notificationPoll bounds each blocking pop so the worker notices shutdown.
+const notificationPoll = 2 * time.Second
+
+// StartNotificationWorker processes queued notifications until ctx is
+// cancelled. A notification taken off the queue is always processed to the
+// end; one that arrives as shutdown begins is pushed back to the head of
+// the queue for the next start. Every poll is reported to hb.
+func StartNotificationWorker(ctx context.Context, rdb *redis.Client, dbConn *sql.DB, hb *health.Heartbeat) {
+    // pop and process on a context that shutdown does not cancel, so a
+    // message is never dropped between Redis and the worker
+    jobCtx := context.WithoutCancel(ctx)
+    for ctx.Err() == nil {
+        res, err := rdb.BRPop(jobCtx, notificationPoll, "notifications").Result()
+        if err == redis.Nil { hb.Beat(); continue }
+        if err!=nil {
+            hb.Fail(err)
+            select { case <-ctx.Done(): case <-time.After(1*time.Second): }
+            continue
+        }
+        hb.Beat()
         if len(res) < 2 { continue }
-        payload := res[1]
-        logrus.Infof("processing notification: %s", payload)
+        if ctx.Err() != nil {
+            if err := rdb.RPush(jobCtx, "notifications", res[1]).Err(); err != nil {
+                logrus.Errorf("requeue notification on shutdown: %v: %s", err, redact.String(res[1]))
+            }
+            return
+        }
+        processNotification(jobCtx, res[1])
+    }
+}
+
+func processNotification(ctx context.Context, payload string) {
+    // continue the log trail and trace of the request or job that queued it
+    var meta struct{ RequestID string `json:"request_id"`; Traceparent string `json:"traceparent"`; Type string `json:"type"` }
+    if err := json.Unmarshal([]byte(payload), &meta); err != nil || meta.Type == "" {
+        notificationsProcessed.Inc("unknown", "invalid")
+        logrus.Warnf("dropping malformed notification: %s", redact.String(payload))
+        return
     }
+    if meta.RequestID != "" { ctx = logging.WithRequestID(ctx, meta.RequestID) }
+    ctx, span := trace.Start(trace.Extract(ctx, meta.Traceparent), "notification "+meta.Type, trace.KindConsumer,
+        trace.String("messaging.system", "redis"), trace.String("messaging.destination.name", "notifications"))
+    defer span.End()
+    logging.From(ctx).Infof("processing notification: %s", redact.String(payload))
+    notificationsProcessed.Inc(meta.Type, "processed")
 }
@@ -2,7 +2,14 @@ package transaction
 
 import (
     "database/sql"
+    "fmt"
+    "strings"
     "time"
+
+    "github.com/lib/pq"
+
+    "github.com/example/real_time_core_banking_v9/internal/db"
+    "github.com/example/real_time_core_banking_v9/internal/page"
 )
 
 type Repo struct { db *sql.DB }
@@ -14,18 +21,68 @@ type Transaction struct {
     Amount float64 `json:"amount"`
     Type string `json:"type"`
     Narration string `json:"narration"`
+    Counterparty string `json:"counterparty,omitempty"`
+    BookingDate string `json:"booking_date"`
+    ValueDate string `json:"value_date"`
     CreatedAt time.Time `json:"created_at"`
 }
 
-func (r *Repo) ListForAccount(accountID int, from, to string) ([]*Transaction, error) {
-    rows, err := r.db.Query("SELECT id,account_id,amount,type,narration,created_at FROM transactions WHERE account_id=$1 AND created_at BETWEEN $2 AND $3 ORDER BY created_at DESC", accountID, from, to)
+// Filter narrows a transaction listing to creation times between From and
+// To. The other fields match everything when zero.
+type Filter struct {
+    From, To time.Time
+    Types []string
+    MinAmount, MaxAmount *float64
+    Text string
+    Counterparty string
+}
+
+// Key returns the keyset position of t for pagination.
+func (t *Transaction) Key() page.Cursor {
+    return page.Cursor{Key: t.CreatedAt.Format(time.RFC3339Nano), ID: t.ID}
+}
+
+// AccountID resolves an account number to the id transactions refer to.
+func (r *Repo) AccountID(number string) (int, error) {
+    var id int
+    err := r.db.QueryRow("SELECT id FROM accounts WHERE account_number=$1", number).Scan(&id)
+    return id, err
+}
+
+// ListForAccount returns one page of an account's transactions created
+// between f.From and f.To, ordered by creation time. It fetches p.Limit+1
+// rows so the caller can tell whether another page follows.
+func (r *Repo) ListForAccount(accountID int, f Filter, p page.Params) ([]*Transaction, error) {
+    where := []string{"t.account_id = $1", "t.created_at BETWEEN $2 AND $3"}
+    args := []interface{}{accountID, f.From, f.To}
+    add := func(cond string, v interface{}) {
+        args = append(args, v)
+        where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+    }
+    if len(f.Types) > 0 { add("t.type = ANY(?)", pq.Array(f.Types)) }
+    if f.MinAmount != nil { add("t.amount >= ?", *f.MinAmount) }
+    if f.MaxAmount != nil { add("t.amount <= ?", *f.MaxAmount) }
+    if f.Text != "" { add("t.narration ILIKE '%' || ? || '%'", db.LikeEscape(f.Text)) }
+    if f.Counterparty != "" { add("c.account_number = ?", f.Counterparty) }
+    if p.After != nil {
+        at, err := time.Parse(time.RFC3339Nano, p.After.Key)
+        if err != nil { return nil, page.ErrBadCursor }
+        args = append(args, at, p.After.ID)
+        where = append(where, fmt.Sprintf("(t.created_at, t.id) %s ($%d, $%d)", p.Cmp(), len(args)-1, len(args)))
+    }
+    args = append(args, p.Limit+1)
+    query := fmt.Sprintf(`SELECT t.id,t.account_id,t.amount,COALESCE(t.type,''),COALESCE(t.narration,''),COALESCE(c.account_number,''),
+        COALESCE(to_char(t.booking_date,'YYYY-MM-DD'),''),COALESCE(to_char(t.value_date,'YYYY-MM-DD'),''),t.created_at
+        FROM transactions t LEFT JOIN accounts c ON c.id = t.related_account_id
+        WHERE %s ORDER BY t.created_at %s, t.id %s LIMIT $%d`, strings.Join(where, " AND "), p.Dir(), p.Dir(), len(args))
+    rows, err := r.db.Query(query, args...)
     if err!=nil { return nil, err }
     defer rows.Close()
     var out []*Transaction
     for rows.Next() {
         t := &Transaction{}
-        if err := rows.Scan(&t.ID,&t.AccountID,&t.Amount,&t.Type,&t.Narration,&t.CreatedAt); err!=nil { return nil, err }
+        if err := rows.Scan(&t.ID,&t.AccountID,&t.Amount,&t.Type,&t.Narration,&t.Counterparty,&t.BookingDate,&t.ValueDate,&t.CreatedAt); err!=nil { return nil, err }
         out = append(out, t)
     }
-    return out, nil
+    return out, rows.Err()
 }